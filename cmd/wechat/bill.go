@@ -0,0 +1,58 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/chanxuehong/wechat/mch"
+	"github.com/chanxuehong/wechat/mch/pay"
+)
+
+// bill download: 下载对账单.
+func billDownload(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("bill download")
+	billDate := fs.String("date", "", "bill date, format: 20060102")
+	billType := fs.String("type", "ALL", "bill type: ALL, SUCCESS, REFUND, REVOKED")
+	deviceInfo := fs.String("device", "", "device info, optional")
+	out := fs.String("out", "", "output file, default stdout")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if *billDate == "" {
+		return errors.New("-date is required")
+	}
+	if cfg.AppId == "" || cfg.MchId == "" || cfg.MchAPIKey == "" {
+		return errors.New("appid, mch_id and mch_apikey are required, see WECHAT_APPID, WECHAT_MCH_ID and WECHAT_MCH_APIKEY")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	req := map[string]string{
+		"appid":     cfg.AppId,
+		"mch_id":    cfg.MchId,
+		"nonce_str": hex.EncodeToString(nonce),
+		"bill_date": *billDate,
+		"bill_type": *billType,
+	}
+	if *deviceInfo != "" {
+		req["device_info"] = *deviceInfo
+	}
+	req["sign"] = mch.Sign(req, cfg.MchAPIKey, nil)
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return
+	}
+	defer w.Close()
+
+	_, err = pay.DownloadBillToWriter(w, req, nil)
+	return
+}
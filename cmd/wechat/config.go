@@ -0,0 +1,169 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 命令行工具的配置.
+//  同一个公众号的 access_token 只能由一个中控服务器获取, 重新获取会让生产环境正在使用的 access_token 失效,
+//  所以默认只读取生产环境的 access_token, 按下面的优先级:
+//  1. AccessToken: 直接使用该 access_token;
+//  2. TokenServerURL: 从生产环境的中控服务器读取, 见 NewTokenServerURLAccessTokenServer;
+//  3. UseAppSecret 为 true 时才用 AppId 和 AppSecret 获取 access_token, 仅用于没有中控服务器的公众号(比如测试号).
+type Config struct {
+	AppId          string `json:"appid"`            // 公众号的 AppId
+	AppSecret      string `json:"app_secret"`       // 公众号的 AppSecret
+	AccessToken    string `json:"access_token"`     // 公众号的 access_token
+	TokenServerURL string `json:"token_server_url"` // 生产环境中控服务器读取 access_token 的 URL
+	UseAppSecret   bool   `json:"use_app_secret"`   // 是否允许用 AppSecret 获取 access_token
+	MchId          string `json:"mch_id"`           // 微信支付的商户号
+	MchAPIKey      string `json:"mch_apikey"`       // 微信支付的 API密钥
+
+	tokenServer mp.AccessTokenServer
+}
+
+// 读取配置, filename 为空则读取环境变量 WECHAT_CONFIG 指定的文件, 都为空则只读取环境变量.
+func LoadConfig(filename string) (cfg *Config, err error) {
+	cfg = &Config{}
+
+	if filename == "" {
+		filename = os.Getenv("WECHAT_CONFIG")
+	}
+	if filename != "" {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	setFromEnv(&cfg.AppId, "WECHAT_APPID")
+	setFromEnv(&cfg.AppSecret, "WECHAT_APPSECRET")
+	setFromEnv(&cfg.AccessToken, "WECHAT_ACCESS_TOKEN")
+	setFromEnv(&cfg.TokenServerURL, "WECHAT_TOKEN_SERVER")
+	setFromEnv(&cfg.MchId, "WECHAT_MCH_ID")
+	setFromEnv(&cfg.MchAPIKey, "WECHAT_MCH_APIKEY")
+	if v := os.Getenv("WECHAT_USE_APPSECRET"); v != "" {
+		if cfg.UseAppSecret, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.New("invalid WECHAT_USE_APPSECRET: " + v)
+		}
+	}
+	return
+}
+
+func setFromEnv(field *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*field = v
+	}
+}
+
+// 公众号的 access_token 中控服务器, 第一次调用时创建, 见 Config.
+func (cfg *Config) AccessTokenServer() (srv mp.AccessTokenServer, err error) {
+	if cfg.tokenServer == nil {
+		switch {
+		case cfg.AccessToken != "":
+			cfg.tokenServer = staticAccessTokenServer(cfg.AccessToken)
+		case cfg.TokenServerURL != "":
+			cfg.tokenServer = NewTokenServerURLAccessTokenServer(cfg.TokenServerURL, nil)
+		case cfg.UseAppSecret:
+			if cfg.AppId == "" || cfg.AppSecret == "" {
+				return nil, errors.New("appid and app_secret are required with -use-appsecret, see WECHAT_APPID and WECHAT_APPSECRET")
+			}
+			cfg.tokenServer = mp.NewDefaultAccessTokenServer(cfg.AppId, cfg.AppSecret, nil)
+		default:
+			return nil, errors.New("access_token is required, see -access-token, -token-server and -use-appsecret")
+		}
+	}
+	return cfg.tokenServer, nil
+}
+
+// 关闭创建的 access_token 中控服务器.
+func (cfg *Config) Close() {
+	if closer, ok := cfg.tokenServer.(io.Closer); ok {
+		closer.Close()
+	}
+	cfg.tokenServer = nil
+}
+
+var errReadOnlyAccessToken = errors.New("access_token is read-only, get a new one from the production token server")
+
+// 固定的 access_token, 不会刷新.
+type staticAccessTokenServer string
+
+func (srv staticAccessTokenServer) Token() (string, error) {
+	return string(srv), nil
+}
+func (srv staticAccessTokenServer) TokenRefresh() (string, error) {
+	return "", errReadOnlyAccessToken
+}
+func (srv staticAccessTokenServer) TagCE90001AFE9C11E48611A4DB30FED8E1() {}
+
+// 从生产环境中控服务器读取 access_token 的 AccessTokenServer, 只读, 不会到微信服务器获取 access_token.
+//  GET url 返回 {"access_token": "ACCESS_TOKEN"}; TokenRefresh 重新读取一次, 由中控服务器决定是否刷新.
+type TokenServerURLAccessTokenServer struct {
+	url        string
+	httpClient *http.Client
+	token      string
+}
+
+// 创建一个新的 TokenServerURLAccessTokenServer, httpClient 为 nil 则用 http.DefaultClient.
+func NewTokenServerURLAccessTokenServer(url string, httpClient *http.Client) *TokenServerURLAccessTokenServer {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &TokenServerURLAccessTokenServer{
+		url:        url,
+		httpClient: httpClient,
+	}
+}
+
+func (srv *TokenServerURLAccessTokenServer) TagCE90001AFE9C11E48611A4DB30FED8E1() {}
+
+func (srv *TokenServerURLAccessTokenServer) Token() (token string, err error) {
+	if srv.token != "" {
+		return srv.token, nil
+	}
+	return srv.TokenRefresh()
+}
+
+func (srv *TokenServerURLAccessTokenServer) TokenRefresh() (token string, err error) {
+	httpResp, err := srv.httpClient.Get(srv.url)
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http.Status: %s", httpResp.Status)
+		return
+	}
+
+	var result struct {
+		Token string `json:"access_token"`
+	}
+	if err = json.NewDecoder(httpResp.Body).Decode(&result); err != nil {
+		return
+	}
+	if result.Token == "" {
+		err = errors.New("empty access_token from " + srv.url)
+		return
+	}
+	srv.token = result.Token
+	return srv.token, nil
+}
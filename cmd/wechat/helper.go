@@ -0,0 +1,67 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/chanxuehong/wechat/json"
+)
+
+// 创建子命令的 FlagSet, 出错时打印用法并返回 error 而不是退出.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// 打开输出文件, name 为空或者为 "-" 时输出到 os.Stdout.
+func createOutput(name string) (io.WriteCloser, error) {
+	if name == "" || name == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(name)
+}
+
+// 读取输入文件, name 为 "-" 时读取 os.Stdin.
+func readInput(name string) ([]byte, error) {
+	switch name {
+	case "":
+		return nil, errors.New("-file is required")
+	case "-":
+		return ioutil.ReadAll(os.Stdin)
+	default:
+		return ioutil.ReadFile(name)
+	}
+}
+
+// 读取 JSON 格式的输入文件到 v.
+func readJSONInput(name string, v interface{}) (err error) {
+	data, err := readInput(name)
+	if err != nil {
+		return
+	}
+	return json.Unmarshal(data, v)
+}
+
+// 以缩进的 JSON 格式输出 v 到 os.Stdout.
+func printJSON(v interface{}) (err error) {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	_, err = os.Stdout.Write(data)
+	return
+}
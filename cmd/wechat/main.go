@@ -0,0 +1,128 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// wechat 是日常运维公众号和微信支付商户号的命令行工具.
+//
+//  用法:
+//      wechat [-config file] [-access-token token | -token-server url | -use-appsecret] <command> <subcommand> [arguments]
+//
+//  命令:
+//      menu     pull | push -file menu.json | delete
+//      user     export [-out users.jsonl] [-lang zh_CN]
+//      material count | list -type image | backup -dir backup
+//      template send -file msg.json
+//      custom   text -to openid -content text | image -to openid -media mediaid
+//      qrcode   create [-scene 123 | -scene-str str] [-expire 604800] [-out qrcode.jpg]
+//      bill     download -date 20160102 [-type ALL] [-out bill.csv]
+//
+//  配置文件为 JSON 格式, 字段见 Config; 环境变量会覆盖配置文件中对应的值, 命令行参数会覆盖环境变量:
+//      WECHAT_CONFIG, WECHAT_APPID, WECHAT_APPSECRET, WECHAT_ACCESS_TOKEN, WECHAT_TOKEN_SERVER,
+//      WECHAT_USE_APPSECRET, WECHAT_MCH_ID, WECHAT_MCH_APIKEY
+//
+//  NOTE: 默认不会用 AppSecret 获取 access_token, 因为这会让生产环境中控服务器的 access_token 失效;
+//  请用 -access-token 或者 -token-server 使用生产环境的 access_token, 只有没有中控服务器的公众号才用 -use-appsecret.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// 一个子命令的实现, args 为子命令后面的参数.
+type commandFunc func(cfg *Config, args []string) error
+
+var commands = map[string]map[string]commandFunc{
+	"menu": {
+		"pull":   menuPull,
+		"push":   menuPush,
+		"delete": menuDelete,
+	},
+	"user": {
+		"export": userExport,
+	},
+	"material": {
+		"count":  materialCount,
+		"list":   materialList,
+		"backup": materialBackup,
+	},
+	"template": {
+		"send": templateSend,
+	},
+	"custom": {
+		"text":  customText,
+		"image": customImage,
+	},
+	"qrcode": {
+		"create": qrcodeCreate,
+	},
+	"bill": {
+		"download": billDownload,
+	},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: wechat [-config file] [-access-token token | -token-server url | -use-appsecret] <command> <subcommand> [arguments]
+
+commands:
+    menu     pull | push -file menu.json | delete
+    user     export [-out users.jsonl] [-lang zh_CN]
+    material count | list -type image | backup -dir backup
+    template send -file msg.json
+    custom   text -to openid -content text | image -to openid -media mediaid
+    qrcode   create [-scene 123 | -scene-str str] [-expire 604800] [-out qrcode.jpg]
+    bill     download -date 20160102 [-type ALL] [-out bill.csv]
+
+environment:
+    WECHAT_CONFIG, WECHAT_APPID, WECHAT_APPSECRET, WECHAT_ACCESS_TOKEN, WECHAT_TOKEN_SERVER,
+    WECHAT_USE_APPSECRET, WECHAT_MCH_ID, WECHAT_MCH_APIKEY
+
+-use-appsecret invalidates the access_token of the production token server,
+use it only for accounts without one (e.g. test accounts).`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	configFile := flag.String("config", "", "config file, default $WECHAT_CONFIG")
+	accessToken := flag.String("access-token", "", "access_token to use, default $WECHAT_ACCESS_TOKEN")
+	tokenServer := flag.String("token-server", "", `URL of the production token server returning {"access_token":"..."}, default $WECHAT_TOKEN_SERVER`)
+	useAppSecret := flag.Bool("use-appsecret", false, "get access_token with appid and app_secret, invalidates the production access_token")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]][args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "wechat: unknown command %q\n", args[0]+" "+args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := LoadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wechat:", err)
+		os.Exit(1)
+	}
+	if *accessToken != "" {
+		cfg.AccessToken = *accessToken
+	}
+	if *tokenServer != "" {
+		cfg.TokenServerURL = *tokenServer
+	}
+	if *useAppSecret {
+		cfg.UseAppSecret = true
+	}
+	defer cfg.Close()
+
+	if err = cmd(cfg, args[2:]); err != nil {
+		cfg.Close()
+		fmt.Fprintln(os.Stderr, "wechat:", err)
+		os.Exit(1)
+	}
+}
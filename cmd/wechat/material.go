@@ -0,0 +1,194 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mp/material"
+)
+
+const materialPageSize = 20 // 获取素材列表每次最多 20 个
+
+func newMaterialClient(cfg *Config) (*material.Client, error) {
+	srv, err := cfg.AccessTokenServer()
+	if err != nil {
+		return nil, err
+	}
+	return material.NewClient(srv, nil), nil
+}
+
+// material count: 输出各类永久素材的总数.
+func materialCount(cfg *Config, args []string) (err error) {
+	if err = newFlagSet("material count").Parse(args); err != nil {
+		return
+	}
+	clt, err := newMaterialClient(cfg)
+	if err != nil {
+		return
+	}
+
+	info, err := clt.GetMaterialCount()
+	if err != nil {
+		return
+	}
+	return printJSON(info)
+}
+
+// material list: 输出某一类永久素材的列表, 每行一个 JSON.
+func materialList(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("material list")
+	materialType := fs.String("type", material.MaterialTypeImage, "material type: image, video, voice, news")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	clt, err := newMaterialClient(cfg)
+	if err != nil {
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	if *materialType == material.MaterialTypeNews {
+		return eachNews(clt, func(info *material.NewsInfo) error {
+			return encoder.Encode(info)
+		})
+	}
+	return eachMaterial(clt, *materialType, func(info *material.MaterialInfo) error {
+		return encoder.Encode(info)
+	})
+}
+
+// material backup: 备份所有永久素材到目录 dir.
+//  图片和语音保存为原文件, 视频保存视频信息的 JSON(包括下载地址), 图文保存为 JSON;
+//  dir/index.jsonl 记录所有素材的基本信息.
+func materialBackup(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("material backup")
+	dir := fs.String("dir", "", "backup directory")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if *dir == "" {
+		return fmt.Errorf("-dir is required")
+	}
+	clt, err := newMaterialClient(cfg)
+	if err != nil {
+		return
+	}
+
+	for _, materialType := range []string{material.MaterialTypeImage, material.MaterialTypeVoice, material.MaterialTypeVideo, material.MaterialTypeNews} {
+		if err = os.MkdirAll(filepath.Join(*dir, materialType), 0755); err != nil {
+			return
+		}
+	}
+	index, err := os.Create(filepath.Join(*dir, "index.jsonl"))
+	if err != nil {
+		return
+	}
+	defer index.Close()
+	encoder := json.NewEncoder(index)
+
+	for _, materialType := range []string{material.MaterialTypeImage, material.MaterialTypeVoice} {
+		err = eachMaterial(clt, materialType, func(info *material.MaterialInfo) (err error) {
+			name := filepath.Join(*dir, materialType, info.MediaId+filepath.Ext(info.Name))
+			if _, err = clt.DownloadMaterial(info.MediaId, name); err != nil {
+				return
+			}
+			return encoder.Encode(&backupIndex{Type: materialType, File: name, MaterialInfo: info})
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	err = eachMaterial(clt, material.MaterialTypeVideo, func(info *material.MaterialInfo) (err error) {
+		video, err := clt.GetVideo(info.MediaId)
+		if err != nil {
+			return
+		}
+		name := filepath.Join(*dir, material.MaterialTypeVideo, info.MediaId+".json")
+		if err = writeJSONFile(name, video); err != nil {
+			return
+		}
+		return encoder.Encode(&backupIndex{Type: material.MaterialTypeVideo, File: name, MaterialInfo: info})
+	})
+	if err != nil {
+		return
+	}
+
+	return eachNews(clt, func(info *material.NewsInfo) (err error) {
+		name := filepath.Join(*dir, material.MaterialTypeNews, info.MediaId+".json")
+		if err = writeJSONFile(name, info); err != nil {
+			return
+		}
+		return encoder.Encode(&backupIndex{
+			Type: material.MaterialTypeNews,
+			File: name,
+			MaterialInfo: &material.MaterialInfo{
+				MediaId:    info.MediaId,
+				UpdateTime: info.UpdateTime,
+			},
+		})
+	})
+}
+
+// material backup 生成的 index.jsonl 里的一条记录.
+type backupIndex struct {
+	Type string `json:"type"`
+	File string `json:"file"`
+	*material.MaterialInfo
+}
+
+func writeJSONFile(name string, v interface{}) (err error) {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// 遍历某一类(图文除外)永久素材.
+func eachMaterial(clt *material.Client, materialType string, fn func(*material.MaterialInfo) error) (err error) {
+	iter, err := clt.MaterialIterator(materialType, 0, materialPageSize)
+	if err != nil {
+		return
+	}
+	for iter.HasNext() {
+		items, err := iter.NextPage()
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if err = fn(&items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
+
+// 遍历图文永久素材.
+func eachNews(clt *material.Client, fn func(*material.NewsInfo) error) (err error) {
+	iter, err := clt.NewsIterator(0, materialPageSize)
+	if err != nil {
+		return
+	}
+	for iter.HasNext() {
+		items, err := iter.NextPage()
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if err = fn(&items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,111 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/chanxuehong/wechat/mp/menu"
+)
+
+func newMenuClient(cfg *Config) (*menu.Client, error) {
+	srv, err := cfg.AccessTokenServer()
+	if err != nil {
+		return nil, err
+	}
+	return menu.NewClient(srv, nil), nil
+}
+
+// menu pull 输出的格式, menu push 也接受这个格式, 用于备份和恢复.
+type menuBackup struct {
+	Menu             *menu.Menu  `json:"menu"`
+	ConditionalMenus []menu.Menu `json:"conditionalmenu,omitempty"`
+}
+
+// menu pull: 以 JSON 格式输出当前的自定义菜单和个性化菜单, 输出可以直接用于 menu push.
+func menuPull(cfg *Config, args []string) (err error) {
+	if err = newFlagSet("menu pull").Parse(args); err != nil {
+		return
+	}
+	clt, err := newMenuClient(cfg)
+	if err != nil {
+		return
+	}
+
+	m, conditionalMenus, err := clt.GetMenu()
+	if err != nil {
+		return
+	}
+	return printJSON(&menuBackup{
+		Menu:             m,
+		ConditionalMenus: conditionalMenus,
+	})
+}
+
+// menu push: 用 JSON 文件里的菜单创建自定义菜单.
+//  文件格式可以是 menu pull 的输出, 此时先创建自定义菜单, 再依次创建个性化菜单;
+//  也可以是 menu.Menu, 如果有 matchrule 则创建个性化菜单, 否则创建自定义菜单.
+func menuPush(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("menu push")
+	file := fs.String("file", "", "menu JSON file, - for stdin")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	var input struct {
+		menu.Menu                    // menu.Menu 格式
+		BackupMenu       *menu.Menu  `json:"menu"`            // menu pull 输出的格式
+		ConditionalMenus []menu.Menu `json:"conditionalmenu"` // menu pull 输出的格式
+	}
+	if err = readJSONInput(*file, &input); err != nil {
+		return
+	}
+	clt, err := newMenuClient(cfg)
+	if err != nil {
+		return
+	}
+
+	if input.BackupMenu == nil {
+		m := input.Menu
+		if m.MatchRule != nil {
+			menuId, err := clt.CreateConditionalMenu(&m)
+			if err != nil {
+				return err
+			}
+			fmt.Println("menuid:", menuId)
+			return nil
+		}
+		return clt.CreateMenu(m)
+	}
+
+	// 创建自定义菜单会删除所有的个性化菜单, 所以先创建自定义菜单
+	m := *input.BackupMenu
+	m.MenuId = 0
+	if err = clt.CreateMenu(m); err != nil {
+		return
+	}
+	for _, m := range input.ConditionalMenus {
+		m.MenuId = 0
+		menuId, err := clt.CreateConditionalMenu(&m)
+		if err != nil {
+			return err
+		}
+		fmt.Println("menuid:", menuId)
+	}
+	return
+}
+
+// menu delete: 删除自定义菜单(包括个性化菜单).
+func menuDelete(cfg *Config, args []string) (err error) {
+	if err = newFlagSet("menu delete").Parse(args); err != nil {
+		return
+	}
+	clt, err := newMenuClient(cfg)
+	if err != nil {
+		return
+	}
+	return clt.DeleteMenu()
+}
@@ -0,0 +1,85 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chanxuehong/wechat/mp/message/custom"
+	"github.com/chanxuehong/wechat/mp/message/template"
+)
+
+// template send: 发送 JSON 文件里的模板消息, 文件格式同 template.TemplateMessage.
+func templateSend(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("template send")
+	file := fs.String("file", "", "template message JSON file, - for stdin")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	var msg template.TemplateMessage
+	if err = readJSONInput(*file, &msg); err != nil {
+		return
+	}
+	srv, err := cfg.AccessTokenServer()
+	if err != nil {
+		return
+	}
+
+	msgid, err := template.NewClient(srv, nil).Send(&msg)
+	if err != nil {
+		return
+	}
+	fmt.Println("msgid:", msgid)
+	return
+}
+
+func newCustomClient(cfg *Config) (*custom.Client, error) {
+	srv, err := cfg.AccessTokenServer()
+	if err != nil {
+		return nil, err
+	}
+	return custom.NewClient(srv, nil), nil
+}
+
+// custom text: 发送文本客服消息.
+func customText(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("custom text")
+	toUser := fs.String("to", "", "openid of the receiver")
+	content := fs.String("content", "", "text content")
+	kfAccount := fs.String("kf", "", "kf account, optional")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if *toUser == "" || *content == "" {
+		return errors.New("-to and -content are required")
+	}
+	clt, err := newCustomClient(cfg)
+	if err != nil {
+		return
+	}
+	return clt.SendText(custom.NewText(*toUser, *content, *kfAccount))
+}
+
+// custom image: 发送图片客服消息.
+func customImage(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("custom image")
+	toUser := fs.String("to", "", "openid of the receiver")
+	mediaId := fs.String("media", "", "media id of the image")
+	kfAccount := fs.String("kf", "", "kf account, optional")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if *toUser == "" || *mediaId == "" {
+		return errors.New("-to and -media are required")
+	}
+	clt, err := newCustomClient(cfg)
+	if err != nil {
+		return
+	}
+	return clt.SendImage(custom.NewImage(*toUser, *mediaId, *kfAccount))
+}
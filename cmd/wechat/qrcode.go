@@ -0,0 +1,69 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chanxuehong/wechat/mp/account"
+)
+
+// qrcode create: 创建二维码, 输出 ticket 和 url, 指定 -out 则同时下载二维码图片.
+//  指定 -expire 为临时二维码, 否则为永久二维码.
+func qrcodeCreate(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("qrcode create")
+	sceneId := fs.Uint("scene", 0, "scene id")
+	sceneString := fs.String("scene-str", "", "scene string, permanent qrcode only")
+	expireSeconds := fs.Int("expire", 0, "expire seconds of temporary qrcode, 0 for permanent qrcode")
+	out := fs.String("out", "", "download the qrcode image to this file")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if (*sceneId == 0) == (*sceneString == "") {
+		return errors.New("exactly one of -scene and -scene-str is required")
+	}
+
+	srv, err := cfg.AccessTokenServer()
+	if err != nil {
+		return
+	}
+	clt := account.NewClient(srv, nil)
+
+	var qrcode *account.PermanentQRCode
+	switch {
+	case *expireSeconds > 0:
+		if *sceneString != "" {
+			return errors.New("-scene-str is not supported by temporary qrcode")
+		}
+		tmp, err := clt.CreateTemporaryQRCode(uint32(*sceneId), *expireSeconds)
+		if err != nil {
+			return err
+		}
+		qrcode = &tmp.PermanentQRCode
+	case *sceneString != "":
+		if qrcode, err = clt.CreatePermanentQRCodeWithSceneString(*sceneString); err != nil {
+			return
+		}
+	default:
+		if qrcode, err = clt.CreatePermanentQRCode(uint32(*sceneId)); err != nil {
+			return
+		}
+	}
+	if err = printJSON(qrcode); err != nil {
+		return
+	}
+
+	if *out == "" {
+		return
+	}
+	if _, err = clt.QRCodeDownload(qrcode.Ticket, *out); err != nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "qrcode saved to", *out)
+	return
+}
@@ -0,0 +1,72 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mp/user"
+)
+
+const userInfoBatchGetLimit = 100 // 批量获取用户基本信息每次最多 100 个
+
+// user export: 导出所有关注者的基本信息, 每行一个 JSON.
+func userExport(cfg *Config, args []string) (err error) {
+	fs := newFlagSet("user export")
+	out := fs.String("out", "", "output file, default stdout")
+	lang := fs.String("lang", user.Language_zh_CN, "language: zh_CN, zh_TW, en")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	srv, err := cfg.AccessTokenServer()
+	if err != nil {
+		return
+	}
+	clt := user.NewClient(srv, nil)
+
+	iter, err := clt.UserIterator("")
+	if err != nil {
+		return
+	}
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return
+	}
+	defer w.Close()
+
+	encoder := json.NewEncoder(w)
+	for iter.HasNext() {
+		openIdList, err := iter.NextPage()
+		if err != nil {
+			return err
+		}
+
+		for len(openIdList) > 0 {
+			n := len(openIdList)
+			if n > userInfoBatchGetLimit {
+				n = userInfoBatchGetLimit
+			}
+			req := make([]user.UserInfoBatchGetRequestItem, n)
+			for i := range req {
+				req[i].OpenId = openIdList[i]
+				req[i].Language = *lang
+			}
+			openIdList = openIdList[n:]
+
+			userInfoList, err := clt.UserInfoBatchGet(req)
+			if err != nil {
+				return err
+			}
+			for i := range userInfoList {
+				if err = encoder.Encode(&userInfoList[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,95 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// wechatcrypt 校验并解密抓取到的回调请求, 说明具体是哪一项检查失败.
+//
+//  用法:
+//      wechatcrypt -token TOKEN -aeskey ENCODING_AES_KEY [-appid APPID] [-touser TO_USER_NAME] \
+//          -url 'https://example.com/callback?signature=...&timestamp=...' [-body body.xml]
+//
+//  -url 可以是完整的 URL, 也可以只是查询字符串; -body 为 - 表示从 os.Stdin 读取.
+//  -token, -aeskey 没有指定时读取环境变量 WECHAT_TOKEN, WECHAT_ENCODING_AES_KEY.
+//  所有检查通过时输出解密后的消息, 退出码为 0; 否则退出码为 1.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/chanxuehong/wechat/msgcrypto"
+)
+
+func main() {
+	token := flag.String("token", os.Getenv("WECHAT_TOKEN"), "Token, default $WECHAT_TOKEN")
+	encodingAESKey := flag.String("aeskey", os.Getenv("WECHAT_ENCODING_AES_KEY"), "EncodingAESKey, default $WECHAT_ENCODING_AES_KEY")
+	appId := flag.String("appid", "", "AppId (CorpId for corp), optional")
+	toUserName := flag.String("touser", "", "the original id of the account (CorpId for corp), optional")
+	rawURL := flag.String("url", "", "the callback URL or its query string")
+	bodyFile := flag.String("body", "", "file of the http body, - for stdin, empty for GET requests")
+	flag.Parse()
+
+	if *token == "" || *rawURL == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	query, err := parseQuery(*rawURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wechatcrypt: invalid -url:", err)
+		os.Exit(2)
+	}
+
+	var body []byte
+	switch *bodyFile {
+	case "":
+	case "-":
+		body, err = ioutil.ReadAll(os.Stdin)
+	default:
+		body, err = ioutil.ReadFile(*bodyFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wechatcrypt: read -body failed:", err)
+		os.Exit(2)
+	}
+
+	report := msgcrypto.Diagnose(&msgcrypto.Callback{
+		Token:          *token,
+		EncodingAESKey: *encodingAESKey,
+		AppId:          *appId,
+		ToUserName:     *toUserName,
+		Query:          query,
+		Body:           body,
+	})
+
+	for _, check := range report.Checks {
+		status := "ok  "
+		if !check.OK {
+			status = "FAIL"
+		}
+		fmt.Printf("[%s] %-15s %s\n", status, check.Name, check.Detail)
+	}
+
+	if failure := report.FirstFailure(); failure != nil {
+		fmt.Printf("\ncheck %s failed: %s\n", failure.Name, failure.Detail)
+		os.Exit(1)
+	}
+
+	if report.Encrypted {
+		fmt.Printf("\nappid: %s\n", report.AppId)
+	}
+	fmt.Printf("\n%s\n", report.RawMsgXML)
+}
+
+// 解析完整的 URL 或者查询字符串.
+func parseQuery(rawURL string) (url.Values, error) {
+	if i := strings.IndexByte(rawURL, '?'); i >= 0 {
+		rawURL = rawURL[i+1:]
+	}
+	return url.ParseQuery(rawURL)
+}
@@ -8,6 +8,7 @@
 package corp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -17,6 +18,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/chanxuehong/wechat/internal/daemon"
 	"github.com/chanxuehong/wechat/json"
 )
 
@@ -39,6 +41,7 @@ type AccessTokenServer interface {
 }
 
 var _ AccessTokenServer = (*DefaultAccessTokenServer)(nil)
+var _ TokenStatusServer = (*DefaultAccessTokenServer)(nil)
 
 // AccessTokenServer 的简单实现.
 //  NOTE:
@@ -50,7 +53,8 @@ type DefaultAccessTokenServer struct {
 	corpSecret string
 	httpClient *http.Client
 
-	resetTickerChan chan time.Duration // 用于重置 tokenDaemon 里的 ticker
+	tokenDaemon     *daemon.Daemon  // 定时刷新 access_token 的后台 goroutine
+	refreshNotifier RefreshNotifier // 刷新事件的订阅列表
 
 	tokenGet struct {
 		sync.Mutex
@@ -60,7 +64,13 @@ type DefaultAccessTokenServer struct {
 
 	tokenCache struct {
 		sync.RWMutex
-		Token string
+		Token     string
+		ExpiresAt int64 // Token 的过期时间, unixtime
+	}
+
+	tokenStatus struct {
+		sync.Mutex
+		TokenServerStatus // ExpiresAt, DaemonRunning 在 Status 里计算
 	}
 }
 
@@ -72,13 +82,13 @@ func NewDefaultAccessTokenServer(corpId, corpSecret string, clt *http.Client) (s
 	}
 
 	srv = &DefaultAccessTokenServer{
-		corpId:          corpId,
-		corpSecret:      corpSecret,
-		httpClient:      clt,
-		resetTickerChan: make(chan time.Duration),
+		corpId:     corpId,
+		corpSecret: corpSecret,
+		httpClient: clt,
 	}
 
-	go srv.tokenDaemon(time.Hour * 24) // 启动 tokenDaemon
+	srv.tokenDaemon = daemon.New(srv.daemonRefresh)
+	srv.tokenDaemon.Start(time.Hour * 24) // 启动 tokenDaemon
 	return
 }
 
@@ -87,51 +97,95 @@ func (srv *DefaultAccessTokenServer) Tag6D89F2E2FE9811E49EAAA4DB30FED8E1() {}
 func (srv *DefaultAccessTokenServer) Token() (token string, err error) {
 	srv.tokenCache.RLock()
 	token = srv.tokenCache.Token
+	expiresAt := srv.tokenCache.ExpiresAt
 	srv.tokenCache.RUnlock()
 
-	if token != "" {
+	// 刷新失败时在过期之前继续使用旧的 access_token
+	if token != "" && time.Now().Unix() < expiresAt {
 		return
 	}
 	return srv.TokenRefresh()
 }
 
 func (srv *DefaultAccessTokenServer) TokenRefresh() (token string, err error) {
-	accessTokenInfo, cached, err := srv.getToken()
+	accessTokenInfo, cached, err := srv.refreshToken()
 	if err != nil {
 		return
 	}
 	if !cached {
-		srv.resetTickerChan <- time.Duration(accessTokenInfo.ExpiresIn) * time.Second
+		srv.tokenDaemon.Reset(time.Duration(accessTokenInfo.ExpiresIn) * time.Second)
 	}
 	token = accessTokenInfo.Token
 	return
 }
 
-func (srv *DefaultAccessTokenServer) tokenDaemon(tickDuration time.Duration) {
-NEW_TICK_DURATION:
-	ticker := time.NewTicker(tickDuration)
-
-	for {
-		select {
-		case tickDuration = <-srv.resetTickerChan:
-			ticker.Stop()
-			goto NEW_TICK_DURATION
-
-		case <-ticker.C:
-			accessTokenInfo, cached, err := srv.getToken()
-			if err != nil {
-				break
-			}
-			if !cached {
-				newTickDuration := time.Duration(accessTokenInfo.ExpiresIn) * time.Second
-				if tickDuration != newTickDuration {
-					tickDuration = newTickDuration
-					ticker.Stop()
-					goto NEW_TICK_DURATION
-				}
-			}
-		}
+// 启动(重启)后台定时刷新 access_token 的 goroutine, NewDefaultAccessTokenServer 已经启动过一次.
+//  如果已经在运行则什么都不做.
+func (srv *DefaultAccessTokenServer) Start() {
+	srv.tokenDaemon.Start(srv.daemonPeriod())
+}
+
+// 停止后台定时刷新 access_token 的 goroutine, 并等待正在进行的刷新完成.
+//  如果 ctx 在这之前结束则返回 ctx.Err();
+//  Stop 之后仍然可以调用 Token, TokenRefresh, 也可以调用 Start 重新启动.
+func (srv *DefaultAccessTokenServer) Stop(ctx context.Context) error {
+	return srv.tokenDaemon.Stop(ctx)
+}
+
+// 同 Stop(context.Background()).
+func (srv *DefaultAccessTokenServer) Close() error {
+	return srv.Stop(context.Background())
+}
+
+// 订阅刷新 access_token 的事件, 返回取消订阅的函数, 比如 appsecret 被重置导致刷新失败时告警.
+//  见 RefreshNotifier.Subscribe.
+func (srv *DefaultAccessTokenServer) Subscribe(fn func(*RefreshEvent)) (unsubscribe func()) {
+	return srv.refreshNotifier.Subscribe(fn)
+}
+
+// 返回中控服务器当前的状态, 用于排查问题, 见 NewTokenStatusHandler.
+func (srv *DefaultAccessTokenServer) Status() (status TokenServerStatus) {
+	srv.tokenStatus.Lock()
+	status = srv.tokenStatus.TokenServerStatus
+	srv.tokenStatus.Unlock()
+
+	srv.tokenCache.RLock()
+	expiresAt := srv.tokenCache.ExpiresAt
+	srv.tokenCache.RUnlock()
+
+	if expiresAt > 0 {
+		status.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+	status.DaemonRunning = srv.tokenDaemon.IsRunning()
+	return
+}
+
+// 后台 goroutine 第一次刷新的时间间隔, 为当前 access_token 剩余的有效时间, 如果没有则为 24 小时.
+func (srv *DefaultAccessTokenServer) daemonPeriod() time.Duration {
+	srv.tokenGet.Lock()
+	lastTimestamp := srv.tokenGet.LastTimestamp
+	expiresIn := srv.tokenGet.LastTokenInfo.ExpiresIn
+	srv.tokenGet.Unlock()
+
+	if lastTimestamp == 0 {
+		return time.Hour * 24
 	}
+	if period := time.Duration(lastTimestamp+expiresIn-time.Now().Unix()) * time.Second; period > 0 {
+		return period
+	}
+	return time.Second
+}
+
+// 后台 goroutine 的刷新函数, 返回下一次刷新的时间间隔.
+func (srv *DefaultAccessTokenServer) daemonRefresh() (next time.Duration, err error) {
+	tokenInfo, cached, err := srv.refreshToken()
+	if err != nil {
+		return
+	}
+	if !cached {
+		next = time.Duration(tokenInfo.ExpiresIn) * time.Second
+	}
+	return
 }
 
 type accessTokenInfo struct {
@@ -139,6 +193,33 @@ type accessTokenInfo struct {
 	ExpiresIn int64  `json:"expires_in"` // 有效时间, seconds
 }
 
+// 同 getToken, 在没有命中收敛缓存时更新状态并通知刷新事件的订阅者.
+func (srv *DefaultAccessTokenServer) refreshToken() (token accessTokenInfo, cached bool, err error) {
+	if token, cached, err = srv.getToken(); cached {
+		return
+	}
+	timeNow := time.Now()
+
+	srv.tokenStatus.Lock()
+	if err != nil {
+		srv.tokenStatus.LastError = err.Error()
+		srv.tokenStatus.LastErrorTime = timeNow
+		srv.tokenStatus.ErrorCount++
+	} else {
+		srv.tokenStatus.LastRefreshTime = timeNow
+		srv.tokenStatus.LastError = ""
+		srv.tokenStatus.RefreshCount++
+	}
+	srv.tokenStatus.Unlock()
+
+	srv.refreshNotifier.Notify(&RefreshEvent{
+		Time:      timeNow,
+		ExpiresIn: token.ExpiresIn,
+		Err:       err,
+	})
+	return
+}
+
 // 从微信服务器获取 access_token.
 //  同一时刻只能一个 goroutine 进入, 防止没必要的重复获取.
 func (srv *DefaultAccessTokenServer) getToken() (token accessTokenInfo, cached bool, err error) {
@@ -163,18 +244,11 @@ func (srv *DefaultAccessTokenServer) getToken() (token accessTokenInfo, cached b
 		"&corpsecret=" + url.QueryEscape(srv.corpSecret)
 	httpResp, err := srv.httpClient.Get(_url)
 	if err != nil {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
 		return
 	}
 	defer httpResp.Body.Close()
 
 	if httpResp.StatusCode != http.StatusOK {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = fmt.Errorf("http.Status: %s", httpResp.Status)
 		return
 	}
@@ -186,9 +260,6 @@ func (srv *DefaultAccessTokenServer) getToken() (token accessTokenInfo, cached b
 
 	respBody, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
 		return
 	}
 
@@ -196,17 +267,10 @@ func (srv *DefaultAccessTokenServer) getToken() (token accessTokenInfo, cached b
 	LogInfoln("[WECHAT_DEBUG] response json:", string(respBody))
 
 	if err = json.Unmarshal(respBody, &result); err != nil {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
 		return
 	}
 
 	if result.ErrCode != ErrCodeOK {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = &result.Error
 		return
 	}
@@ -214,10 +278,6 @@ func (srv *DefaultAccessTokenServer) getToken() (token accessTokenInfo, cached b
 	// 由于网络的延时, access_token 过期时间留了一个缓冲区
 	switch {
 	case result.ExpiresIn > 31556952: // 60*60*24*365.2425
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = errors.New("expires_in too large: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	case result.ExpiresIn > 60*60:
@@ -229,10 +289,6 @@ func (srv *DefaultAccessTokenServer) getToken() (token accessTokenInfo, cached b
 	case result.ExpiresIn > 60:
 		result.ExpiresIn -= 10
 	default:
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = errors.New("expires_in too small: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	}
@@ -244,6 +300,7 @@ func (srv *DefaultAccessTokenServer) getToken() (token accessTokenInfo, cached b
 	// 更新缓存
 	srv.tokenCache.Lock()
 	srv.tokenCache.Token = result.accessTokenInfo.Token
+	srv.tokenCache.ExpiresAt = timeNowUnix + result.accessTokenInfo.ExpiresIn
 	srv.tokenCache.Unlock()
 
 	token = result.accessTokenInfo
@@ -0,0 +1,221 @@
+package corp
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+func testAESKey(id string, b byte, activatedAt, expiresAt time.Time) AESKey {
+	key := AESKey{
+		Id:          id,
+		ActivatedAt: activatedAt,
+		ExpiresAt:   expiresAt,
+	}
+	for i := range key.Key {
+		key.Key[i] = b
+	}
+	return key
+}
+
+func testKeyIds(keys []AESKey) string {
+	ids := make([]string, len(keys))
+	for i := range keys {
+		ids[i] = keys[i].Id
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestAESKeyRingValidKeys(t *testing.T) {
+	timeNow := time.Now()
+	ring := NewAESKeyRing(
+		testAESKey("future", 1, timeNow.Add(time.Hour), time.Time{}),
+		testAESKey("current", 2, timeNow.Add(-time.Hour), time.Time{}),
+		testAESKey("expired", 3, time.Time{}, timeNow.Add(-time.Minute)),
+		testAESKey("last", 4, time.Time{}, timeNow.Add(time.Hour)),
+	)
+
+	if have := testKeyIds(ring.ValidKeys(timeNow)); have != "current,last" {
+		t.Errorf("TestAESKeyRingValidKeys failed, have: %s, want: current,last\n", have)
+	}
+	if have := testKeyIds(ring.ValidKeys(timeNow.Add(time.Hour * 2))); have != "future,current" {
+		t.Errorf("TestAESKeyRingValidKeys failed, have: %s, want: future,current\n", have)
+	}
+	if key, ok := ring.CurrentKey(); !ok || key.Id != "current" {
+		t.Errorf("TestAESKeyRingValidKeys failed, have CurrentKey: %s, want: current\n", key.Id)
+	}
+	if have := len(ring.Keys()); have != 4 {
+		t.Errorf("TestAESKeyRingValidKeys failed, have len(Keys()): %d, want: 4\n", have)
+	}
+}
+
+func TestAESKeyRingDecrypt(t *testing.T) {
+	timeNow := time.Now()
+	current := testAESKey("current", 1, time.Time{}, time.Time{})
+	last := testAESKey("last", 2, time.Time{}, timeNow.Add(time.Hour))
+	expired := testAESKey("expired", 3, time.Time{}, timeNow.Add(-time.Minute))
+	ring := NewAESKeyRing(current, last, expired)
+
+	random := []byte("0123456789abcdef")
+	msg := []byte("<xml><Content>hello</Content></xml>")
+
+	for _, key := range []AESKey{current, last} {
+		ciphertext := util.AESEncryptMsg(random, msg, "wx1234567890", key.Key)
+		_, rawXMLMsg, appId, haveKey, err := ring.Decrypt(ciphertext)
+		if err != nil {
+			t.Errorf("TestAESKeyRingDecrypt failed, key: %s, err: %s\n", key.Id, err)
+			continue
+		}
+		if haveKey.Id != key.Id {
+			t.Errorf("TestAESKeyRingDecrypt failed, have key: %s, want: %s\n", haveKey.Id, key.Id)
+		}
+		if string(rawXMLMsg) != string(msg) || string(appId) != "wx1234567890" {
+			t.Errorf("TestAESKeyRingDecrypt failed, have msg: %s, appid: %s\n", rawXMLMsg, appId)
+		}
+	}
+
+	// 过期的 Key 不再用于解密
+	ciphertext := util.AESEncryptMsg(random, msg, "wx1234567890", expired.Key)
+	if _, _, _, haveKey, err := ring.Decrypt(ciphertext); err == nil {
+		t.Errorf("TestAESKeyRingDecrypt failed, decrypted by: %s, want error\n", haveKey.Id)
+	}
+}
+
+func TestAESKeyRingAddKey(t *testing.T) {
+	timeNow := time.Now()
+	activatedAt := timeNow.Add(-time.Hour)
+	expiresSoon := timeNow.Add(time.Minute)
+	ring := NewAESKeyRing(
+		testAESKey("k1", 1, activatedAt, time.Time{}),
+		testAESKey("k2", 2, time.Time{}, expiresSoon),
+		testAESKey("expired", 3, time.Time{}, timeNow.Add(-time.Minute)),
+	)
+
+	if !ring.AddKey(testAESKey("k3", 3, time.Time{}, time.Time{}), 0) {
+		t.Fatal("TestAESKeyRingAddKey failed, AddKey returned false")
+	}
+	keys := ring.Keys()
+	if have := testKeyIds(keys); have != "k3,k1,k2" {
+		t.Fatalf("TestAESKeyRingAddKey failed, have: %s, want: k3,k1,k2\n", have)
+	}
+	if !keys[1].ActivatedAt.Equal(activatedAt) || !keys[1].ExpiresAt.IsZero() || !keys[2].ExpiresAt.Equal(expiresSoon) {
+		t.Errorf("TestAESKeyRingAddKey failed, activation or expiry changed: %+v\n", keys)
+	}
+
+	// 当前的 Key 重复添加什么都不做
+	if ring.AddKey(testAESKey("k3-again", 3, time.Time{}, time.Time{}), time.Hour) {
+		t.Error("TestAESKeyRingAddKey failed, AddKey of the current key returned true")
+	}
+
+	// othersTTL 只会提前原来的 Key 的过期时间
+	if !ring.AddKey(testAESKey("k4", 4, time.Time{}, time.Time{}), time.Hour) {
+		t.Fatal("TestAESKeyRingAddKey failed, AddKey returned false")
+	}
+	keys = ring.Keys()
+	if have := testKeyIds(keys); have != "k4,k3,k1,k2" {
+		t.Fatalf("TestAESKeyRingAddKey failed, have: %s, want: k4,k3,k1,k2\n", have)
+	}
+	for _, key := range keys[1:3] {
+		if key.ExpiresAt.IsZero() || key.ExpiresAt.After(time.Now().Add(time.Hour)) {
+			t.Errorf("TestAESKeyRingAddKey failed, key %s ExpiresAt: %s\n", key.Id, key.ExpiresAt)
+		}
+	}
+	if !keys[3].ExpiresAt.Equal(expiresSoon) {
+		t.Errorf("TestAESKeyRingAddKey failed, key k2 ExpiresAt: %s, want: %s\n", keys[3].ExpiresAt, expiresSoon)
+	}
+}
+
+func TestDefaultAgentServerUpdateAESKey(t *testing.T) {
+	handler := MessageHandlerFunc(func(w http.ResponseWriter, r *Request) {})
+	key1 := testAESKey("", 1, time.Time{}, time.Time{})
+	key2 := testAESKey("", 2, time.Time{}, time.Time{})
+	srv := NewDefaultAgentServer("wx1234567890", 1, "token", key1.Key[:], handler)
+
+	// 配置源设置的 Key 及其有效期不会被 UpdateAESKey 丢弃
+	external := testAESKey("external", 9, time.Time{}, time.Now().Add(time.Hour))
+	srv.AESKeyRing().SetKeys(key1, external)
+
+	if err := srv.UpdateAESKey(key2.Key[:]); err != nil {
+		t.Fatal(err)
+	}
+	keys := srv.AESKeyRing().Keys()
+	if len(keys) != 3 || keys[0].Key != key2.Key || keys[1].Key != key1.Key || keys[2].Id != "external" || !keys[2].ExpiresAt.Equal(external.ExpiresAt) {
+		t.Fatalf("TestDefaultAgentServerUpdateAESKey failed, have keys: %+v\n", keys)
+	}
+	if srv.CurrentAESKey() != key2.Key {
+		t.Error("TestDefaultAgentServerUpdateAESKey failed, CurrentAESKey is not the new key")
+	}
+	if last, valid := srv.LastAESKey(); !valid || last != key1.Key {
+		t.Error("TestDefaultAgentServerUpdateAESKey failed, LastAESKey is not the old key")
+	}
+	if err := srv.UpdateAESKey(key2.Key[:]); err != nil || len(srv.AESKeyRing().Keys()) != 3 {
+		t.Error("TestDefaultAgentServerUpdateAESKey failed, updating the current key changed the ring")
+	}
+	if err := srv.UpdateAESKey(key2.Key[:16]); err == nil {
+		t.Error("TestDefaultAgentServerUpdateAESKey failed, want error for short key")
+	}
+
+	// 和配置源的刷新并发
+	source := AESKeySourceFunc(func() ([]AESKey, error) {
+		return []AESKey{external}, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			key := testAESKey("", byte(i), time.Time{}, time.Time{})
+			srv.UpdateAESKeyWithTTL(key.Key[:], time.Minute)
+		}(i)
+		go func() {
+			defer wg.Done()
+			srv.AESKeyRing().Refresh(source)
+		}()
+	}
+	wg.Wait()
+}
+
+// 换下来的 Key 过期之后不再用于解密, 也不会一直留在 AESKeyRing 里.
+func TestDefaultAgentServerRotatedKeyExpires(t *testing.T) {
+	handler := MessageHandlerFunc(func(w http.ResponseWriter, r *Request) {})
+	key1 := testAESKey("", 1, time.Time{}, time.Time{})
+	key2 := testAESKey("", 2, time.Time{}, time.Time{})
+	srv := NewDefaultAgentServer("wx1234567890", 1, "token", key1.Key[:], handler)
+
+	// UpdateAESKey 给原来的 Key 设置默认的有效时间
+	if err := srv.UpdateAESKey(key2.Key[:]); err != nil {
+		t.Fatal(err)
+	}
+	keys := srv.AESKeyRing().Keys()
+	if len(keys) != 2 || keys[1].Key != key1.Key || keys[1].ExpiresAt.IsZero() || keys[1].ExpiresAt.After(time.Now().Add(DefaultLastAESKeyTTL)) {
+		t.Fatalf("TestDefaultAgentServerRotatedKeyExpires failed, have keys: %+v\n", keys)
+	}
+
+	random := []byte("0123456789abcdef")
+	msg := []byte("<xml><Content>hello</Content></xml>")
+	for i := 3; i <= 5; i++ {
+		key := testAESKey("", byte(i), time.Time{}, time.Time{})
+		if err := srv.UpdateAESKeyWithTTL(key.Key[:], time.Millisecond*20); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 30)
+
+		ciphertext := util.AESEncryptMsg(random, msg, "wx1234567890", key2.Key)
+		if _, _, _, _, err := srv.AESKeyRing().Decrypt(ciphertext); err == nil {
+			t.Errorf("TestDefaultAgentServerRotatedKeyExpires failed, rotated-out key still decrypts\n")
+		}
+		ciphertext = util.AESEncryptMsg(random, msg, "wx1234567890", key.Key)
+		if _, _, _, _, err := srv.AESKeyRing().Decrypt(ciphertext); err != nil {
+			t.Errorf("TestDefaultAgentServerRotatedKeyExpires failed, current key: %v\n", err)
+		}
+		key2 = key
+	}
+	// 过期的 Key 在更新时被移除
+	if n := len(srv.AESKeyRing().Keys()); n != 2 {
+		t.Errorf("TestDefaultAgentServerRotatedKeyExpires failed, have len(Keys()): %d, want: 2\n", n)
+	}
+}
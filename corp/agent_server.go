@@ -6,9 +6,8 @@
 package corp
 
 import (
-	"bytes"
 	"errors"
-	"sync"
+	"time"
 )
 
 type AgentServer interface {
@@ -23,16 +22,14 @@ type AgentServer interface {
 }
 
 var _ AgentServer = (*DefaultAgentServer)(nil)
+var _ AESKeyRingServer = (*DefaultAgentServer)(nil)
 
 type DefaultAgentServer struct {
 	corpId  string
 	agentId int64
 	token   string
 
-	rwmutex           sync.RWMutex
-	currentAESKey     [32]byte // 当前的 AES Key
-	lastAESKey        [32]byte // 最后一个 AES Key
-	isLastAESKeyValid bool     // lastAESKey 是否有效, 如果 lastAESKey 是 zero 则无效
+	aesKeyRing *AESKeyRing
 
 	messageHandler MessageHandler
 }
@@ -52,7 +49,10 @@ func NewDefaultAgentServer(corpId string, agentId int64, token string, aesKey []
 		token:          token,
 		messageHandler: handler,
 	}
-	copy(srv.currentAESKey[:], aesKey)
+
+	var key AESKey
+	copy(key.Key[:], aesKey)
+	srv.aesKeyRing = NewAESKeyRing(key)
 	return
 }
 
@@ -69,33 +69,43 @@ func (srv *DefaultAgentServer) MessageHandler() MessageHandler {
 	return srv.messageHandler
 }
 func (srv *DefaultAgentServer) CurrentAESKey() (key [32]byte) {
-	srv.rwmutex.RLock()
-	key = srv.currentAESKey
-	srv.rwmutex.RUnlock()
+	if aesKey, ok := srv.aesKeyRing.CurrentKey(); ok {
+		key = aesKey.Key
+	}
 	return
 }
 func (srv *DefaultAgentServer) LastAESKey() (key [32]byte, valid bool) {
-	srv.rwmutex.RLock()
-	key = srv.lastAESKey
-	valid = srv.isLastAESKeyValid
-	srv.rwmutex.RUnlock()
+	if keys := srv.aesKeyRing.ValidKeys(time.Now()); len(keys) > 1 {
+		key = keys[1].Key
+		valid = true
+	}
 	return
 }
 
+// 返回 AESKeyRing, 可以通过它设置多个 AES 加密 Key 及其有效期, 或者从外部配置源刷新.
+func (srv *DefaultAgentServer) AESKeyRing() *AESKeyRing {
+	return srv.aesKeyRing
+}
+
+// 更新 AES 加密 Key, 新的 Key 立即生效, 原来的 Key 最晚在 DefaultLastAESKeyTTL 之后过期.
+//  同 UpdateAESKeyWithTTL(aesKey, 0).
 func (srv *DefaultAgentServer) UpdateAESKey(aesKey []byte) (err error) {
+	return srv.UpdateAESKeyWithTTL(aesKey, 0)
+}
+
+// 更新 AES 加密 Key, 新的 Key 立即生效, 原来的 Key 最晚在 lastKeyTTL 之后过期, 见 AESKeyRing.AddKey.
+//  lastKeyTTL <= 0 时使用 DefaultLastAESKeyTTL, 过期的 Key 在下一次更新时被移除, 不会一直累积.
+//  在 AESKeyRing 的锁里完成, 和 AESKeyRing.SetKeys, AESKeyRing.Refresh 并发安全.
+func (srv *DefaultAgentServer) UpdateAESKeyWithTTL(aesKey []byte, lastKeyTTL time.Duration) (err error) {
 	if len(aesKey) != 32 {
 		return errors.New("the length of aesKey must equal to 32")
 	}
 
-	srv.rwmutex.Lock()
-	defer srv.rwmutex.Unlock()
-
-	if bytes.Equal(aesKey, srv.currentAESKey[:]) {
-		return
+	var key AESKey
+	copy(key.Key[:], aesKey)
+	if lastKeyTTL <= 0 {
+		lastKeyTTL = DefaultLastAESKeyTTL
 	}
-
-	srv.isLastAESKeyValid = true
-	srv.lastAESKey = srv.currentAESKey
-	copy(srv.currentAESKey[:], aesKey)
+	srv.aesKeyRing.AddKey(key, lastKeyTTL)
 	return
 }
@@ -0,0 +1,188 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package corp
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrAgentServerNotFound = errors.New("agent server not found")
+
+// AgentServer 的注册表, MultiAgentServerFrontend 通过它根据 serverKey 查找 AgentServer,
+// 比如从数据库里加载企业号应用的配置然后创建 AgentServer.
+type AgentServerRegistry interface {
+	// 根据 serverKey 查找 AgentServer, 没有找到返回 ErrAgentServerNotFound.
+	AgentServer(serverKey string) (AgentServer, error)
+}
+
+type AgentServerRegistryFunc func(serverKey string) (AgentServer, error)
+
+func (fn AgentServerRegistryFunc) AgentServer(serverKey string) (AgentServer, error) {
+	return fn(serverKey)
+}
+
+var _ AgentServerRegistry = (*CachedAgentServerRegistry)(nil)
+
+// 带缓存的 AgentServerRegistry, 缓存底层 AgentServerRegistry 查找到的 AgentServer.
+//  企业号应用的配置修改后调用 Invalidate 使缓存失效.
+//  没有找到的 serverKey 也会缓存一小段时间, 新增应用后同样调用 Invalidate; 同一个 serverKey 同时只查找一次.
+type CachedAgentServerRegistry struct {
+	registry AgentServerRegistry
+	ttl      time.Duration
+
+	rwmutex  sync.RWMutex
+	cacheMap map[string]cachedAgentServer
+	inflight map[string]*cachedAgentServerCall // 正在查找的 serverKey, 同一个 serverKey 同时只查找一次
+}
+
+type cachedAgentServer struct {
+	server    AgentServer // nil 表示没有找到
+	expiresAt time.Time   // 零值表示不过期
+}
+
+type cachedAgentServerCall struct {
+	done        chan struct{}
+	server      AgentServer
+	err         error
+	invalidated bool // 查找期间调用了 Invalidate, 结果不能缓存
+}
+
+// 没有找到的 serverKey 也缓存一段时间, 避免不存在的 serverKey 的请求每次都查找底层 AgentServerRegistry.
+const agentServerNotFoundTTL = time.Second * 10
+
+// 创建一个新的 CachedAgentServerRegistry.
+//  ttl 为缓存的有效时间, <=0 表示一直有效, 直到调用 Invalidate.
+func NewCachedAgentServerRegistry(registry AgentServerRegistry, ttl time.Duration) *CachedAgentServerRegistry {
+	if registry == nil {
+		panic("nil AgentServerRegistry")
+	}
+	return &CachedAgentServerRegistry{
+		registry: registry,
+		ttl:      ttl,
+		cacheMap: make(map[string]cachedAgentServer),
+		inflight: make(map[string]*cachedAgentServerCall),
+	}
+}
+
+func (registry *CachedAgentServerRegistry) AgentServer(serverKey string) (server AgentServer, err error) {
+	registry.rwmutex.RLock()
+	cache, ok := registry.cacheMap[serverKey]
+	registry.rwmutex.RUnlock()
+
+	if ok && (cache.expiresAt.IsZero() || time.Now().Before(cache.expiresAt)) {
+		if server = cache.server; server == nil {
+			err = ErrAgentServerNotFound
+		}
+		return
+	}
+
+	// 同一个 serverKey 同时只查找一次
+	registry.rwmutex.Lock()
+	if call := registry.inflight[serverKey]; call != nil {
+		registry.rwmutex.Unlock()
+		<-call.done
+		return call.server, call.err
+	}
+	call := &cachedAgentServerCall{
+		done: make(chan struct{}),
+		err:  errors.New("find AgentServer panicked"), // 查找 panic 时等待的 goroutine 得到这个错误
+	}
+	registry.inflight[serverKey] = call
+	registry.rwmutex.Unlock()
+
+	defer func() {
+		registry.rwmutex.Lock()
+		if registry.inflight[serverKey] == call {
+			delete(registry.inflight, serverKey)
+		}
+		if !call.invalidated {
+			registry.store(serverKey, call.server, call.err)
+		}
+		registry.rwmutex.Unlock()
+		close(call.done)
+	}()
+
+	call.server, call.err = registry.registry.AgentServer(serverKey)
+	if call.err == nil && call.server == nil {
+		call.err = ErrAgentServerNotFound
+	}
+	return call.server, call.err
+}
+
+// 缓存查找的结果, 其他错误不缓存, 调用者需要持有 registry.rwmutex 的写锁.
+func (registry *CachedAgentServerRegistry) store(serverKey string, server AgentServer, err error) {
+	var cache cachedAgentServer
+	switch {
+	case err == nil:
+		cache.server = server
+		if registry.ttl > 0 {
+			cache.expiresAt = time.Now().Add(registry.ttl)
+		}
+	case err == ErrAgentServerNotFound:
+		ttl := agentServerNotFoundTTL
+		if registry.ttl > 0 && registry.ttl < ttl {
+			ttl = registry.ttl
+		}
+		cache.expiresAt = time.Now().Add(ttl)
+	default:
+		return
+	}
+	registry.cacheMap[serverKey] = cache
+}
+
+// 使 serverKey 对应的缓存失效.
+func (registry *CachedAgentServerRegistry) Invalidate(serverKey string) {
+	registry.rwmutex.Lock()
+	delete(registry.cacheMap, serverKey)
+	if call := registry.inflight[serverKey]; call != nil {
+		call.invalidated = true
+		delete(registry.inflight, serverKey)
+	}
+	registry.rwmutex.Unlock()
+}
+
+// 使所有的缓存失效.
+func (registry *CachedAgentServerRegistry) InvalidateAll() {
+	registry.rwmutex.Lock()
+	registry.cacheMap = make(map[string]cachedAgentServer)
+	for _, call := range registry.inflight {
+		call.invalidated = true
+	}
+	registry.inflight = make(map[string]*cachedAgentServerCall)
+	registry.rwmutex.Unlock()
+}
+
+// 从 http 请求中获取索引 AgentServer 的 key, 获取不到返回空字符串.
+type AgentServerKeyFunc func(r *http.Request, queryValues url.Values) (serverKey string)
+
+// 从回调 URL 的查询参数获取 serverKey, 例如 name == "agent_server":
+//  http://www.xxx.com/weixin?agent_server=1234567890 的 serverKey 为 1234567890.
+func QueryAgentServerKey(name string) AgentServerKeyFunc {
+	return func(r *http.Request, queryValues url.Values) string {
+		return queryValues.Get(name)
+	}
+}
+
+// 从回调 URL 的路径获取 serverKey, 取 prefix 后面的第一段, 例如 prefix == "/weixin/":
+//  http://www.xxx.com/weixin/1234567890 的 serverKey 为 1234567890.
+func PathAgentServerKey(prefix string) AgentServerKeyFunc {
+	return func(r *http.Request, queryValues url.Values) string {
+		path := r.URL.Path
+		if !strings.HasPrefix(path, prefix) {
+			return ""
+		}
+		path = path[len(prefix):]
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			path = path[:i]
+		}
+		return path
+	}
+}
@@ -0,0 +1,80 @@
+package corp
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testRegistryAgentServer struct {
+	AgentServer
+	key string
+}
+
+// 记录查找次数的 AgentServerRegistry, servers 里没有的 serverKey 返回 nil, nil.
+type testAgentServerRegistry struct {
+	calls   int32
+	block   chan struct{} // 不为 nil 时查找等待它关闭
+	servers map[string]AgentServer
+}
+
+func (registry *testAgentServerRegistry) AgentServer(serverKey string) (AgentServer, error) {
+	atomic.AddInt32(&registry.calls, 1)
+	if registry.block != nil {
+		<-registry.block
+	}
+	return registry.servers[serverKey], nil
+}
+
+func TestCachedAgentServerRegistryNotFound(t *testing.T) {
+	registry := &testAgentServerRegistry{servers: map[string]AgentServer{}}
+	cached := NewCachedAgentServerRegistry(registry, 0)
+
+	for i := 0; i < 3; i++ {
+		if server, err := cached.AgentServer("1"); err != ErrAgentServerNotFound || server != nil {
+			t.Errorf("TestCachedAgentServerRegistryNotFound failed, have: %v, %v, want: %v\n", server, err, ErrAgentServerNotFound)
+		}
+	}
+	if n := atomic.LoadInt32(&registry.calls); n != 1 {
+		t.Errorf("TestCachedAgentServerRegistryNotFound failed, have calls: %d, want: 1\n", n)
+	}
+
+	server := &testRegistryAgentServer{key: "1"}
+	registry.servers["1"] = server
+	cached.Invalidate("1")
+	if have, err := cached.AgentServer("1"); err != nil || have != server {
+		t.Errorf("TestCachedAgentServerRegistryNotFound failed, have: %v, %v\n", have, err)
+	}
+}
+
+func TestCachedAgentServerRegistryConcurrent(t *testing.T) {
+	server := &testRegistryAgentServer{key: "1"}
+	registry := &testAgentServerRegistry{
+		block:   make(chan struct{}),
+		servers: map[string]AgentServer{"1": server},
+	}
+	cached := NewCachedAgentServerRegistry(registry, 0)
+
+	var wg sync.WaitGroup
+	results := make([]AgentServer, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cached.AgentServer("1")
+		}(i)
+	}
+	time.Sleep(time.Millisecond * 50) // 让其他 goroutine 都等待在 inflight 上
+	close(registry.block)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&registry.calls); n != 1 {
+		t.Errorf("TestCachedAgentServerRegistryConcurrent failed, have calls: %d, want: 1\n", n)
+	}
+	for i, have := range results {
+		if have != server {
+			t.Errorf("TestCachedAgentServerRegistryConcurrent failed, result %d: %v\n", i, have)
+		}
+	}
+}
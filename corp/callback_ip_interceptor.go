@@ -0,0 +1,164 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package corp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/daemon"
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+// 微信服务器 IP 地址列表的获取接口, *Client 实现了该接口.
+type CallbackIPGetter interface {
+	GetCallbackIP() (ipList []string, err error)
+}
+
+var _ CallbackIPGetter = (*Client)(nil)
+
+var _ Interceptor = (*CallbackIPInterceptor)(nil)
+
+// 只允许微信服务器的 IP 访问回调 URL 的 Interceptor.
+//  微信服务器的 IP 地址列表通过 GetCallbackIP 获取, 后台每隔 refreshPeriod 刷新一次;
+//  在成功获取之前(比如启动时无法访问微信服务器)使用静态的 IP 地址列表.
+type CallbackIPInterceptor struct {
+	getter         CallbackIPGetter
+	errHandler     ErrorHandler
+	staticIPSet    *util.IPSet
+	trustedProxies *util.IPSet
+	refreshPeriod  time.Duration
+
+	ipDaemon *daemon.Daemon // 定时刷新微信服务器 IP 地址列表的后台 goroutine
+
+	ipCache struct {
+		sync.RWMutex
+		IPSet *util.IPSet // 最后一次成功获取的 IP 地址列表, nil 表示还没有成功获取过
+	}
+}
+
+// 创建一个新的 CallbackIPInterceptor, 并且在后台获取微信服务器的 IP 地址列表.
+//  staticIPList:   静态的 IP 地址列表, 成功获取微信服务器的 IP 地址列表之前使用, 可以为 nil;
+//  trustedProxies: 受信任的反向代理的 IP 地址列表, 如果请求来自这些地址, 则根据 X-Forwarded-For 判断来源 IP,
+//                  为 nil 则忽略 X-Forwarded-For;
+//  refreshPeriod:  刷新微信服务器 IP 地址列表的时间间隔, <=0 则为 1 小时;
+//  errHandler:     拒绝请求时调用, 可以为 nil.
+//  列表里的每一项可以是单个 IP 或者 CIDR.
+//  NOTE: 静态列表和获取的列表都为空时拒绝所有的请求.
+func NewCallbackIPInterceptor(getter CallbackIPGetter, staticIPList, trustedProxies []string,
+	refreshPeriod time.Duration, errHandler ErrorHandler) (itc *CallbackIPInterceptor, err error) {
+
+	if getter == nil {
+		panic("nil CallbackIPGetter")
+	}
+	if errHandler == nil {
+		errHandler = DefaultErrorHandler
+	}
+	if refreshPeriod <= 0 {
+		refreshPeriod = time.Hour
+	}
+
+	staticIPSet, err := util.ParseIPSet(staticIPList)
+	if err != nil {
+		return
+	}
+	var trustedProxySet *util.IPSet
+	if trustedProxies != nil {
+		if trustedProxySet, err = util.ParseIPSet(trustedProxies); err != nil {
+			return
+		}
+	}
+
+	itc = &CallbackIPInterceptor{
+		getter:         getter,
+		errHandler:     errHandler,
+		staticIPSet:    staticIPSet,
+		trustedProxies: trustedProxySet,
+		refreshPeriod:  refreshPeriod,
+	}
+
+	itc.ipDaemon = daemon.New(itc.daemonRefresh)
+	itc.ipDaemon.Start(time.Second) // 启动 ipDaemon, 尽快获取第一次
+	return
+}
+
+func (itc *CallbackIPInterceptor) Intercept(w http.ResponseWriter, r *http.Request, queryValues url.Values) (shouldContinue bool) {
+	ip := util.RemoteIP(r, itc.trustedProxies)
+	if ip == nil {
+		itc.errHandler.ServeError(w, r, errors.New("invalid remote address: "+r.RemoteAddr))
+		return false
+	}
+	if !itc.ipSet().Contains(ip) {
+		itc.errHandler.ServeError(w, r, errors.New("callback ip not allowed: "+ip.String()))
+		return false
+	}
+	return true
+}
+
+// 立即到微信服务器刷新 IP 地址列表.
+func (itc *CallbackIPInterceptor) Refresh() (err error) {
+	ipList, err := itc.getter.GetCallbackIP()
+	if err != nil {
+		return
+	}
+	ipSet, err := util.ParseIPSet(ipList)
+	if err != nil {
+		return
+	}
+	if ipSet.Len() == 0 {
+		return errors.New("empty callback ip list")
+	}
+
+	itc.ipCache.Lock()
+	itc.ipCache.IPSet = ipSet
+	itc.ipCache.Unlock()
+	return
+}
+
+// 启动(重启)后台定时刷新 IP 地址列表的 goroutine, NewCallbackIPInterceptor 已经启动过一次.
+//  如果已经在运行则什么都不做.
+func (itc *CallbackIPInterceptor) Start() {
+	itc.ipDaemon.Start(itc.refreshPeriod)
+}
+
+// 停止后台定时刷新 IP 地址列表的 goroutine, 并等待正在进行的刷新完成.
+//  如果 ctx 在这之前结束则返回 ctx.Err(). Stop 之后继续使用最后一次获取的 IP 地址列表.
+func (itc *CallbackIPInterceptor) Stop(ctx context.Context) error {
+	return itc.ipDaemon.Stop(ctx)
+}
+
+// 同 Stop(context.Background()).
+func (itc *CallbackIPInterceptor) Close() error {
+	return itc.Stop(context.Background())
+}
+
+// 当前使用的 IP 地址列表.
+func (itc *CallbackIPInterceptor) ipSet() *util.IPSet {
+	itc.ipCache.RLock()
+	ipSet := itc.ipCache.IPSet
+	itc.ipCache.RUnlock()
+
+	if ipSet == nil {
+		return itc.staticIPSet
+	}
+	return ipSet
+}
+
+// 后台 goroutine 的刷新函数.
+//  失败时也返回 refreshPeriod, 这样重试的时间间隔按指数退避增长到 refreshPeriod 为止,
+//  而不是一直按 NewCallbackIPInterceptor 启动时的 1 秒重试.
+func (itc *CallbackIPInterceptor) daemonRefresh() (next time.Duration, err error) {
+	next = itc.refreshPeriod
+	if err = itc.Refresh(); err != nil {
+		LogInfoln("[WECHAT] refresh callback ip list failed:", err)
+		return
+	}
+	return
+}
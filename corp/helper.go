@@ -59,3 +59,8 @@ func WriteResponse(w http.ResponseWriter, r *Request, msg interface{}) (err erro
 
 	return xml.NewEncoder(w).Encode(&responseHttpBody)
 }
+
+// 回复消息给微信服务器, 同 WriteResponse(w, r, msg).
+func (r *Request) WriteResponse(w http.ResponseWriter, msg interface{}) (err error) {
+	return WriteResponse(w, r, msg)
+}
@@ -0,0 +1,95 @@
+package corp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testInterceptorErrors []error
+
+func (errs *testInterceptorErrors) ServeError(w http.ResponseWriter, r *http.Request, err error) {
+	*errs = append(*errs, err)
+}
+
+func TestInterceptorChain(t *testing.T) {
+	var calls []string
+	interceptor := func(name string, shouldContinue bool) Interceptor {
+		return InterceptorFunc(func(w http.ResponseWriter, r *http.Request, queryValues url.Values) bool {
+			calls = append(calls, name)
+			return shouldContinue
+		})
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	chain := InterceptorChain{interceptor("a", true), nil, interceptor("b", false), interceptor("c", true)}
+	if chain.Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Errorf("TestInterceptorChain failed, want stop\n")
+	}
+	if have := strings.Join(calls, ","); have != "a,b" {
+		t.Errorf("TestInterceptorChain failed, have: %s, want: %s\n", have, "a,b")
+	}
+}
+
+func TestMaxBodySizeInterceptor(t *testing.T) {
+	var errs testInterceptorErrors
+	interceptor := NewMaxBodySizeInterceptor(8, &errs)
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("0123456789"))
+	if interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Errorf("TestMaxBodySizeInterceptor failed, large body allowed\n")
+	}
+	if len(errs) != 1 || errs[0] != ErrRequestBodyTooLarge {
+		t.Errorf("TestMaxBodySizeInterceptor failed, have errors: %v\n", errs)
+	}
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	var errs testInterceptorErrors
+	interceptor, err := NewRateLimitInterceptor(0.001, 1, nil, &errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, false} {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = "1.2.3.4:1234"
+		if have := interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query()); have != want {
+			t.Errorf("TestRateLimitInterceptor failed, request %d, have: %t, want: %t\n", i, have, want)
+		}
+	}
+	if len(errs) != 1 || errs[0] != ErrTooManyRequests {
+		t.Errorf("TestRateLimitInterceptor failed, have errors: %v\n", errs)
+	}
+}
+
+func TestRequestCheckInterceptor(t *testing.T) {
+	tests := []struct {
+		method string
+		query  string
+		body   string
+		want   bool
+	}{
+		{"GET", "msg_signature=s&timestamp=1&nonce=n&echostr=e", "", true},
+		{"GET", "msg_signature=s&timestamp=1&nonce=n", "", false},
+		{"POST", "msg_signature=s&timestamp=1&nonce=n", "<xml/>", true},
+		{"POST", "msg_signature=s&timestamp=1&nonce=n", "", false},
+		{"POST", "signature=s&timestamp=1&nonce=n", "<xml/>", false}, // 企业号只有安全模式
+		{"POST", "msg_signature=s&timestamp=abc&nonce=n", "<xml/>", false},
+		{"POST", "msg_signature=s&timestamp=1", "<xml/>", false},
+		{"DELETE", "msg_signature=s&timestamp=1&nonce=n", "<xml/>", false},
+	}
+
+	for _, test := range tests {
+		var errs testInterceptorErrors
+		interceptor := NewRequestCheckInterceptor(&errs)
+		r := httptest.NewRequest(test.method, "/?"+test.query, strings.NewReader(test.body))
+		if have := interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query()); have != test.want {
+			t.Errorf("TestRequestCheckInterceptor failed, %s %s, have: %t, want: %t\n", test.method, test.query, have, test.want)
+		}
+		if test.want == (len(errs) != 0) {
+			t.Errorf("TestRequestCheckInterceptor failed, %s %s, have errors: %v\n", test.method, test.query, errs)
+		}
+	}
+}
@@ -25,8 +25,12 @@ import (
 //  来增加一个 AgentServer 来处理 agent_server=1234567890 的消息(事件).
 //
 //  MultiAgentServerFrontend 并发安全, 可以在运行中动态增加和删除 AgentServer.
+//
+//  如果 AgentServer 很多(比如配置保存在数据库里), 可以用 NewMultiAgentServerFrontendWithRegistry 创建,
+//  通过 AgentServerRegistry 查找 AgentServer, 也可以根据 URL 的路径来索引 AgentServer, 见 PathAgentServerKey.
 type MultiAgentServerFrontend struct {
-	urlAgentServerQueryName string
+	serverKeyFunc AgentServerKeyFunc
+	registry      AgentServerRegistry // 可以为 nil
 
 	errHandler  ErrorHandler
 	interceptor Interceptor
@@ -48,10 +52,37 @@ func NewMultiAgentServerFrontend(urlAgentServerQueryName string, errHandler Erro
 	}
 
 	return &MultiAgentServerFrontend{
-		urlAgentServerQueryName: urlAgentServerQueryName,
-		errHandler:              errHandler,
-		interceptor:             interceptor,
-		agentServerMap:          make(map[string]AgentServer),
+		serverKeyFunc:  QueryAgentServerKey(urlAgentServerQueryName),
+		errHandler:     errHandler,
+		interceptor:    interceptor,
+		agentServerMap: make(map[string]AgentServer),
+	}
+}
+
+// NewMultiAgentServerFrontendWithRegistry 创建一个通过 AgentServerRegistry 查找 AgentServer 的 MultiAgentServerFrontend.
+//  registry:      AgentServer 的注册表, 通过 SetAgentServer 增加的 AgentServer 优先
+//  serverKeyFunc: 从请求中获取索引 AgentServer 的 key, 见 QueryAgentServerKey, PathAgentServerKey
+//  errHandler:    错误处理 handler, 可以为 nil
+//  interceptor:   拦截器, 可以为 nil
+func NewMultiAgentServerFrontendWithRegistry(registry AgentServerRegistry, serverKeyFunc AgentServerKeyFunc,
+	errHandler ErrorHandler, interceptor Interceptor) *MultiAgentServerFrontend {
+
+	if registry == nil {
+		panic("nil AgentServerRegistry")
+	}
+	if serverKeyFunc == nil {
+		panic("nil AgentServerKeyFunc")
+	}
+	if errHandler == nil {
+		errHandler = DefaultErrorHandler
+	}
+
+	return &MultiAgentServerFrontend{
+		serverKeyFunc:  serverKeyFunc,
+		registry:       registry,
+		errHandler:     errHandler,
+		interceptor:    interceptor,
+		agentServerMap: make(map[string]AgentServer),
 	}
 }
 
@@ -92,9 +123,9 @@ func (frontend *MultiAgentServerFrontend) ServeHTTP(w http.ResponseWriter, r *ht
 		return
 	}
 
-	serverKey := queryValues.Get(frontend.urlAgentServerQueryName)
+	serverKey := frontend.serverKeyFunc(r, queryValues)
 	if serverKey == "" {
-		err := fmt.Errorf("the url query value with name %s is empty", frontend.urlAgentServerQueryName)
+		err := errors.New("can not get the agent server key from request url: " + r.URL.String())
 		frontend.errHandler.ServeError(w, r, err)
 		return
 	}
@@ -103,8 +134,15 @@ func (frontend *MultiAgentServerFrontend) ServeHTTP(w http.ResponseWriter, r *ht
 	agentServer := frontend.agentServerMap[serverKey]
 	frontend.rwmutex.RUnlock()
 
+	if agentServer == nil && frontend.registry != nil {
+		if agentServer, err = frontend.registry.AgentServer(serverKey); err != nil && err != ErrAgentServerNotFound {
+			frontend.errHandler.ServeError(w, r, err)
+			return
+		}
+	}
+
 	if agentServer == nil {
-		err := fmt.Errorf("Not found AgentServer for %s == %s", frontend.urlAgentServerQueryName, serverKey)
+		err := fmt.Errorf("Not found AgentServer for agent server key == %s", serverKey)
 		frontend.errHandler.ServeError(w, r, err)
 		return
 	}
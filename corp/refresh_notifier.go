@@ -0,0 +1,100 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package corp
+
+import (
+	"sync"
+	"time"
+)
+
+// 中控服务器到微信服务器刷新 access_token(ticket) 的事件.
+type RefreshEvent struct {
+	Time      time.Time // 刷新的时间
+	ExpiresIn int64     // 刷新成功时新 access_token(ticket) 的有效时间, seconds
+	Err       error     // 刷新失败的错误, nil 表示刷新成功
+}
+
+// 刷新事件的订阅列表, 中控服务器用它来通知订阅者, 比如 appsecret 被重置导致刷新失败时告警.
+//  RefreshNotifier 的零值可以直接使用, 并发安全.
+//  订阅者在单独的 goroutine 里按事件发生的顺序调用, 不会阻塞刷新的 goroutine.
+type RefreshNotifier struct {
+	rwmutex   sync.RWMutex
+	nextId    int64
+	listeners map[int64]func(*RefreshEvent)
+
+	queueMutex  sync.Mutex
+	queue       []*RefreshEvent // 还没有通知的事件
+	dispatching bool            // 是否有 goroutine 在通知 queue 里的事件
+}
+
+// 订阅刷新事件, 返回取消订阅的函数.
+//  fn 在通知的 goroutine 里调用, 同一时刻只有一个 fn 在运行, 所以不要在 fn 里做耗时的操作;
+//  fn 里可以调用中控服务器的任何方法, 包括 TokenRefresh, Stop, Close.
+func (n *RefreshNotifier) Subscribe(fn func(*RefreshEvent)) (unsubscribe func()) {
+	if fn == nil {
+		panic("nil fn")
+	}
+
+	n.rwmutex.Lock()
+	if n.listeners == nil {
+		n.listeners = make(map[int64]func(*RefreshEvent))
+	}
+	id := n.nextId
+	n.nextId++
+	n.listeners[id] = fn
+	n.rwmutex.Unlock()
+
+	return func() {
+		n.rwmutex.Lock()
+		delete(n.listeners, id)
+		n.rwmutex.Unlock()
+	}
+}
+
+// 通知所有的订阅者, 不会等待订阅者处理完成.
+func (n *RefreshNotifier) Notify(event *RefreshEvent) {
+	n.queueMutex.Lock()
+	n.queue = append(n.queue, event)
+	if n.dispatching {
+		n.queueMutex.Unlock()
+		return
+	}
+	n.dispatching = true
+	n.queueMutex.Unlock()
+
+	go n.dispatch()
+}
+
+// 按顺序通知 queue 里的事件, 直到 queue 为空.
+func (n *RefreshNotifier) dispatch() {
+	for {
+		n.queueMutex.Lock()
+		if len(n.queue) == 0 {
+			n.dispatching = false
+			n.queueMutex.Unlock()
+			return
+		}
+		event := n.queue[0]
+		n.queue[0] = nil
+		n.queue = n.queue[1:]
+		n.queueMutex.Unlock()
+
+		n.notify(event)
+	}
+}
+
+func (n *RefreshNotifier) notify(event *RefreshEvent) {
+	n.rwmutex.RLock()
+	listeners := make([]func(*RefreshEvent), 0, len(n.listeners))
+	for _, fn := range n.listeners {
+		listeners = append(listeners, fn)
+	}
+	n.rwmutex.RUnlock()
+
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
@@ -0,0 +1,52 @@
+package corp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshNotifierOrder(t *testing.T) {
+	var n RefreshNotifier // 零值可以直接使用
+
+	events := make(chan int64, 10)
+	block := make(chan struct{})
+	unsubscribe := n.Subscribe(func(event *RefreshEvent) {
+		<-block
+		events <- event.ExpiresIn
+	})
+
+	// 订阅者阻塞时 Notify 也不会阻塞
+	notified := make(chan struct{})
+	go func() {
+		for i := int64(1); i <= 5; i++ {
+			n.Notify(&RefreshEvent{ExpiresIn: i})
+		}
+		close(notified)
+	}()
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatalf("TestRefreshNotifierOrder failed, Notify blocked by subscriber\n")
+	}
+	close(block)
+
+	for want := int64(1); want <= 5; want++ {
+		select {
+		case have := <-events:
+			if have != want {
+				t.Errorf("TestRefreshNotifierOrder failed, have: %d, want: %d\n", have, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("TestRefreshNotifierOrder failed, event %d not delivered\n", want)
+		}
+	}
+
+	unsubscribe()
+	n.Notify(&RefreshEvent{Err: errors.New("refresh failed")})
+	select {
+	case have := <-events:
+		t.Errorf("TestRefreshNotifierOrder failed, event delivered after unsubscribe: %d\n", have)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
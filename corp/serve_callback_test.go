@@ -0,0 +1,62 @@
+package corp
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+func TestServeCallback(t *testing.T) {
+	handler := MessageHandlerFunc(func(w http.ResponseWriter, r *Request) {
+		io.WriteString(w, "reply:"+r.MixedMsg.Content)
+	})
+	aesKey := testAESKey("", 1, time.Time{}, time.Time{})
+	srv := NewDefaultAgentServer("wx1234567890", 1, "token", aesKey.Key[:], handler)
+	random := []byte("0123456789abcdef")
+
+	// 首次验证
+	echostr := base64.StdEncoding.EncodeToString(util.AESEncryptMsg(random, []byte("echo"), "wx1234567890", aesKey.Key))
+	queryValues := url.Values{
+		"msg_signature": {util.MsgSign("token", "1460000000", "nonce", echostr)},
+		"timestamp":     {"1460000000"},
+		"nonce":         {"nonce"},
+		"echostr":       {echostr},
+	}
+	reply, statusCode, err := ServeCallback("GET", queryValues, nil, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "echo" || statusCode != http.StatusOK {
+		t.Errorf("TestServeCallback failed, have: %s, %d, want: echo, 200\n", reply, statusCode)
+	}
+
+	// 消息处理
+	msg := "<xml><ToUserName>wx1234567890</ToUserName><FromUserName>u</FromUserName><CreateTime>1</CreateTime><MsgType>text</MsgType><Content>hi</Content><AgentID>1</AgentID></xml>"
+	encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg(random, []byte(msg), "wx1234567890", aesKey.Key))
+	queryValues = url.Values{
+		"msg_signature": {util.MsgSign("token", "1460000000", "nonce", encryptedMsg)},
+		"timestamp":     {"1460000000"},
+		"nonce":         {"nonce"},
+	}
+	body := []byte("<xml><ToUserName>wx1234567890</ToUserName><AgentID>1</AgentID><Encrypt>" + encryptedMsg + "</Encrypt></xml>")
+	if reply, _, err = ServeCallback("POST", queryValues, body, srv); err != nil || string(reply) != "reply:hi" {
+		t.Errorf("TestServeCallback failed, have: %s, %v, want: reply:hi\n", reply, err)
+	}
+
+	queryValues.Set("msg_signature", "bad")
+	if reply, statusCode, err = ServeCallback("POST", queryValues, body, srv); err == nil || reply != nil || statusCode != http.StatusBadRequest {
+		t.Errorf("TestServeCallback failed, have: %s, %d, %v, want signature error\n", reply, statusCode, err)
+	}
+
+	for _, method := range []string{"PUT", "DELETE", ""} {
+		reply, statusCode, err = ServeCallback(method, queryValues, body, srv)
+		if err == nil || reply != nil || statusCode != http.StatusBadRequest {
+			t.Errorf("TestServeCallback failed, method: %q, have: %s, %d, %v, want error\n", method, reply, statusCode, err)
+		}
+	}
+}
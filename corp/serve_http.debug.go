@@ -12,6 +12,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -38,7 +39,14 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 	LogInfoln("[WECHAT_DEBUG] request remote-addr:", r.RemoteAddr)
 	LogInfoln("[WECHAT_DEBUG] request user-agent:", r.UserAgent())
 
-	switch r.Method {
+	serve(w, r, r.Method, r.Body, queryValues, srv, errHandler)
+}
+
+// ServeHTTP 的实现, r 可以为 nil, 见 ServeCallback.
+func serve(w http.ResponseWriter, r *http.Request, method string, body io.Reader,
+	queryValues url.Values, srv AgentServer, errHandler ErrorHandler) {
+
+	switch method {
 	case "POST": // 消息处理
 		msgSignature1 := queryValues.Get("msg_signature")
 		if msgSignature1 == "" {
@@ -65,7 +73,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			return
 		}
 
-		reqBody, err := ioutil.ReadAll(r.Body)
+		reqBody, err := ioutil.ReadAll(body)
 		if err != nil {
 			errHandler.ServeError(w, r, err)
 			return
@@ -117,23 +125,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			return
 		}
 
-		aesKey := srv.CurrentAESKey()
-		random, rawMsgXML, aesAppId, err := util.AESDecryptMsg(encryptedMsgBytes, aesKey)
+		random, rawMsgXML, aesAppId, aesKey, err := AESDecryptMsg(srv, encryptedMsgBytes)
 		if err != nil {
-			// 尝试用上一次的 AESKey 来解密
-			lastAESKey, isLastAESKeyValid := srv.LastAESKey()
-			if !isLastAESKeyValid {
-				errHandler.ServeError(w, r, err)
-				return
-			}
-
-			aesKey = lastAESKey // NOTE
-
-			random, rawMsgXML, aesAppId, err = util.AESDecryptMsg(encryptedMsgBytes, aesKey)
-			if err != nil {
-				errHandler.ServeError(w, r, err)
-				return
-			}
+			errHandler.ServeError(w, r, err)
+			return
 		}
 		if haveCorpId != string(aesAppId) {
 			err = fmt.Errorf("the RequestHttpBody's ToUserName(==%s) mismatch the CorpId with aes encrypt(==%s)", haveCorpId, aesAppId)
@@ -188,10 +183,11 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			RawMsgXML: rawMsgXML,
 			MixedMsg:  &mixedMsg,
 
-			AESKey:  aesKey,
-			Random:  random,
-			CorpId:  haveCorpId,
-			AgentId: haveAgentId,
+			AESKey:   aesKey.Key,
+			AESKeyId: aesKey.Id,
+			Random:   random,
+			CorpId:   haveCorpId,
+			AgentId:  haveAgentId,
 		}
 		srv.MessageHandler().ServeMessage(w, req)
 
@@ -249,5 +245,8 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 		}
 
 		w.Write(echostr)
+
+	default:
+		errHandler.ServeError(w, r, errors.New("Not expect Request.Method: "+method))
 	}
 }
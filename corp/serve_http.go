@@ -12,6 +12,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -33,7 +34,14 @@ type RequestHttpBody struct {
 // ServeHTTP 处理 http 消息请求
 //  NOTE: 调用者保证所有参数有效
 func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, srv AgentServer, errHandler ErrorHandler) {
-	switch r.Method {
+	serve(w, r, r.Method, r.Body, queryValues, srv, errHandler)
+}
+
+// ServeHTTP 的实现, r 可以为 nil, 见 ServeCallback.
+func serve(w http.ResponseWriter, r *http.Request, method string, body io.Reader,
+	queryValues url.Values, srv AgentServer, errHandler ErrorHandler) {
+
+	switch method {
 	case "POST": // 消息处理
 		msgSignature1 := queryValues.Get("msg_signature")
 		if msgSignature1 == "" {
@@ -62,7 +70,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 
 		// 解析 RequestHttpBody
 		var requestHttpBody RequestHttpBody
-		if err := xml.NewDecoder(r.Body).Decode(&requestHttpBody); err != nil {
+		if err := xml.NewDecoder(body).Decode(&requestHttpBody); err != nil {
 			errHandler.ServeError(w, r, err)
 			return
 		}
@@ -105,23 +113,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			return
 		}
 
-		aesKey := srv.CurrentAESKey()
-		random, rawMsgXML, aesAppId, err := util.AESDecryptMsg(encryptedMsgBytes, aesKey)
+		random, rawMsgXML, aesAppId, aesKey, err := AESDecryptMsg(srv, encryptedMsgBytes)
 		if err != nil {
-			// 尝试用上一次的 AESKey 来解密
-			lastAESKey, isLastAESKeyValid := srv.LastAESKey()
-			if !isLastAESKeyValid {
-				errHandler.ServeError(w, r, err)
-				return
-			}
-
-			aesKey = lastAESKey // NOTE
-
-			random, rawMsgXML, aesAppId, err = util.AESDecryptMsg(encryptedMsgBytes, aesKey)
-			if err != nil {
-				errHandler.ServeError(w, r, err)
-				return
-			}
+			errHandler.ServeError(w, r, err)
+			return
 		}
 		if haveCorpId != string(aesAppId) {
 			err = fmt.Errorf("the RequestHttpBody's ToUserName(==%s) mismatch the CorpId with aes encrypt(==%s)", haveCorpId, aesAppId)
@@ -174,10 +169,11 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			RawMsgXML: rawMsgXML,
 			MixedMsg:  &mixedMsg,
 
-			AESKey:  aesKey,
-			Random:  random,
-			CorpId:  haveCorpId,
-			AgentId: haveAgentId,
+			AESKey:   aesKey.Key,
+			AESKeyId: aesKey.Id,
+			Random:   random,
+			CorpId:   haveCorpId,
+			AgentId:  haveAgentId,
 		}
 		srv.MessageHandler().ServeMessage(w, req)
 
@@ -235,5 +231,8 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 		}
 
 		w.Write(echostr)
+
+	default:
+		errHandler.ServeError(w, r, errors.New("Not expect Request.Method: "+method))
 	}
 }
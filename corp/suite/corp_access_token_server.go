@@ -6,15 +6,18 @@
 package suite
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/chanxuehong/wechat/corp"
+	"github.com/chanxuehong/wechat/internal/daemon"
 )
 
 var _ corp.AccessTokenServer = (*CorpAccessTokenServer)(nil)
+var _ corp.TokenStatusServer = (*CorpAccessTokenServer)(nil)
 
 // corp.AccessTokenServer 的简单实现.
 //  NOTE:
@@ -22,21 +25,32 @@ var _ corp.AccessTokenServer = (*CorpAccessTokenServer)(nil)
 //  2. 因为 CorpAccessTokenServer 同时也是一个简单的中控服务器, 而不是仅仅实现 corp.AccessTokenServer 接口,
 //     所以整个系统只能存在一个 CorpAccessTokenServer 实例!
 type CorpAccessTokenServer struct {
-	client        *Client
-	authCorpId    string
-	permanentCode string
+	client     *Client
+	authCorpId string
+	storage    PermanentCodeStorage // 可以为 nil
 
-	resetTickerChan chan time.Duration // 用于重置 tokenDaemon 里的 ticker
+	storageMutex sync.Mutex // 串行化 SetPermanentCode, 保存到 storage 时不持有 tokenGet 锁
+
+	tokenDaemon     *daemon.Daemon       // 定时刷新 access_token 的后台 goroutine
+	refreshNotifier corp.RefreshNotifier // 刷新事件的订阅列表
 
 	tokenGet struct {
 		sync.Mutex
 		LastTokenInfo CorpAccessTokenInfo // 最后一次成功从微信服务器获取的 access_token 信息
 		LastTimestamp int64               // 最后一次成功从微信服务器获取 access_token 的时间戳
+
+		PermanentCode string // 授权企业的永久授权码
 	}
 
 	tokenCache struct {
 		sync.RWMutex
-		Token string
+		Token     string
+		ExpiresAt int64 // Token 的过期时间, unixtime
+	}
+
+	tokenStatus struct {
+		sync.Mutex
+		corp.TokenServerStatus // ExpiresAt, DaemonRunning 在 Status 里计算
 	}
 }
 
@@ -47,13 +61,40 @@ func NewCorpAccessTokenServer(clt *Client, authCorpId, permanentCode string) (sr
 	}
 
 	srv = &CorpAccessTokenServer{
-		client:          clt,
-		authCorpId:      authCorpId,
-		permanentCode:   permanentCode,
-		resetTickerChan: make(chan time.Duration),
+		client:     clt,
+		authCorpId: authCorpId,
+	}
+	srv.tokenGet.PermanentCode = permanentCode
+
+	srv.tokenDaemon = daemon.New(srv.daemonRefresh)
+	srv.tokenDaemon.Start(time.Hour * 24) // 启动 tokenDaemon
+	return
+}
+
+// 创建一个新的 CorpAccessTokenServer, 永久授权码从 storage 读取, SetPermanentCode 时同时保存到 storage.
+//  企业第一次授权时先调用 Client.GetAndSavePermanentCode 保存永久授权码.
+func NewCorpAccessTokenServerWithStorage(clt *Client, authCorpId string, storage PermanentCodeStorage) (srv *CorpAccessTokenServer, err error) {
+	if clt == nil {
+		panic("nil Client")
+	}
+	if storage == nil {
+		panic("nil PermanentCodeStorage")
+	}
+
+	permanentCode, err := storage.LoadPermanentCode(authCorpId)
+	if err != nil {
+		return
+	}
+
+	srv = &CorpAccessTokenServer{
+		client:     clt,
+		authCorpId: authCorpId,
+		storage:    storage,
 	}
+	srv.tokenGet.PermanentCode = permanentCode
 
-	go srv.tokenDaemon(time.Hour * 24) // 启动 tokenDaemon
+	srv.tokenDaemon = daemon.New(srv.daemonRefresh)
+	srv.tokenDaemon.Start(time.Hour * 24) // 启动 tokenDaemon
 	return
 }
 
@@ -62,51 +103,125 @@ func (srv *CorpAccessTokenServer) Tag6D89F2E2FE9811E49EAAA4DB30FED8E1() {}
 func (srv *CorpAccessTokenServer) Token() (token string, err error) {
 	srv.tokenCache.RLock()
 	token = srv.tokenCache.Token
+	expiresAt := srv.tokenCache.ExpiresAt
 	srv.tokenCache.RUnlock()
 
-	if token != "" {
+	// 刷新失败时在过期之前继续使用旧的 access_token
+	if token != "" && time.Now().Unix() < expiresAt {
 		return
 	}
 	return srv.TokenRefresh()
 }
 
 func (srv *CorpAccessTokenServer) TokenRefresh() (token string, err error) {
-	tokenInfo, cached, err := srv.getToken()
+	tokenInfo, cached, err := srv.refreshToken()
 	if err != nil {
 		return
 	}
 	if !cached {
-		srv.resetTickerChan <- time.Duration(tokenInfo.ExpiresIn) * time.Second
+		srv.tokenDaemon.Reset(time.Duration(tokenInfo.ExpiresIn) * time.Second)
 	}
 	token = tokenInfo.Token
 	return
 }
 
-func (srv *CorpAccessTokenServer) tokenDaemon(tickDuration time.Duration) {
-NEW_TICK_DURATION:
-	ticker := time.NewTicker(tickDuration)
-
-	for {
-		select {
-		case tickDuration = <-srv.resetTickerChan:
-			ticker.Stop()
-			goto NEW_TICK_DURATION
-
-		case <-ticker.C:
-			tokenInfo, cached, err := srv.getToken()
-			if err != nil {
-				break
-			}
-			if !cached {
-				newTickDuration := time.Duration(tokenInfo.ExpiresIn) * time.Second
-				if tickDuration != newTickDuration {
-					tickDuration = newTickDuration
-					ticker.Stop()
-					goto NEW_TICK_DURATION
-				}
-			}
+// 启动(重启)后台定时刷新 access_token 的 goroutine, NewCorpAccessTokenServer 已经启动过一次.
+//  如果已经在运行则什么都不做.
+func (srv *CorpAccessTokenServer) Start() {
+	srv.tokenDaemon.Start(srv.daemonPeriod())
+}
+
+// 停止后台定时刷新 access_token 的 goroutine, 并等待正在进行的刷新完成.
+//  如果 ctx 在这之前结束则返回 ctx.Err();
+//  Stop 之后仍然可以调用 Token, TokenRefresh, 也可以调用 Start 重新启动.
+func (srv *CorpAccessTokenServer) Stop(ctx context.Context) error {
+	return srv.tokenDaemon.Stop(ctx)
+}
+
+// 同 Stop(context.Background()).
+func (srv *CorpAccessTokenServer) Close() error {
+	return srv.Stop(context.Background())
+}
+
+// 订阅刷新 access_token 的事件, 返回取消订阅的函数, 比如 appsecret 被重置导致刷新失败时告警.
+//  见 corp.RefreshNotifier.Subscribe.
+func (srv *CorpAccessTokenServer) Subscribe(fn func(*corp.RefreshEvent)) (unsubscribe func()) {
+	return srv.refreshNotifier.Subscribe(fn)
+}
+
+// 返回中控服务器当前的状态, 用于排查问题, 见 corp.NewTokenStatusHandler.
+func (srv *CorpAccessTokenServer) Status() (status corp.TokenServerStatus) {
+	srv.tokenStatus.Lock()
+	status = srv.tokenStatus.TokenServerStatus
+	srv.tokenStatus.Unlock()
+
+	srv.tokenCache.RLock()
+	expiresAt := srv.tokenCache.ExpiresAt
+	srv.tokenCache.RUnlock()
+
+	if expiresAt > 0 {
+		status.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+	status.DaemonRunning = srv.tokenDaemon.IsRunning()
+	return
+}
+
+// 获取当前的永久授权码.
+func (srv *CorpAccessTokenServer) PermanentCode() (permanentCode string) {
+	srv.tokenGet.Lock()
+	permanentCode = srv.tokenGet.PermanentCode
+	srv.tokenGet.Unlock()
+	return
+}
+
+// 设置新的永久授权码, 比如企业重新授权之后, 如果有 PermanentCodeStorage 则先保存.
+//  保存失败时返回错误, 当前的永久授权码不变.
+func (srv *CorpAccessTokenServer) SetPermanentCode(permanentCode string) (err error) {
+	if permanentCode == "" {
+		return errors.New("empty permanent_code")
+	}
+
+	srv.storageMutex.Lock()
+	defer srv.storageMutex.Unlock()
+
+	if srv.storage != nil {
+		if err = srv.storage.SavePermanentCode(srv.authCorpId, permanentCode); err != nil {
+			return
 		}
 	}
+
+	srv.tokenGet.Lock()
+	srv.tokenGet.PermanentCode = permanentCode
+	srv.tokenGet.Unlock()
+	return
+}
+
+// 后台 goroutine 第一次刷新的时间间隔, 为当前 access_token 剩余的有效时间, 如果没有则为 24 小时.
+func (srv *CorpAccessTokenServer) daemonPeriod() time.Duration {
+	srv.tokenGet.Lock()
+	lastTimestamp := srv.tokenGet.LastTimestamp
+	expiresIn := srv.tokenGet.LastTokenInfo.ExpiresIn
+	srv.tokenGet.Unlock()
+
+	if lastTimestamp == 0 {
+		return time.Hour * 24
+	}
+	if period := time.Duration(lastTimestamp+expiresIn-time.Now().Unix()) * time.Second; period > 0 {
+		return period
+	}
+	return time.Second
+}
+
+// 后台 goroutine 的刷新函数, 返回下一次刷新的时间间隔.
+func (srv *CorpAccessTokenServer) daemonRefresh() (next time.Duration, err error) {
+	tokenInfo, cached, err := srv.refreshToken()
+	if err != nil {
+		return
+	}
+	if !cached {
+		next = time.Duration(tokenInfo.ExpiresIn) * time.Second
+	}
+	return
 }
 
 type CorpAccessTokenInfo struct {
@@ -114,6 +229,33 @@ type CorpAccessTokenInfo struct {
 	ExpiresIn int64  `json:"expires_in"` // 有效时间, seconds
 }
 
+// 同 getToken, 在没有命中收敛缓存时更新状态并通知刷新事件的订阅者.
+func (srv *CorpAccessTokenServer) refreshToken() (token CorpAccessTokenInfo, cached bool, err error) {
+	if token, cached, err = srv.getToken(); cached {
+		return
+	}
+	timeNow := time.Now()
+
+	srv.tokenStatus.Lock()
+	if err != nil {
+		srv.tokenStatus.LastError = err.Error()
+		srv.tokenStatus.LastErrorTime = timeNow
+		srv.tokenStatus.ErrorCount++
+	} else {
+		srv.tokenStatus.LastRefreshTime = timeNow
+		srv.tokenStatus.LastError = ""
+		srv.tokenStatus.RefreshCount++
+	}
+	srv.tokenStatus.Unlock()
+
+	srv.refreshNotifier.Notify(&corp.RefreshEvent{
+		Time:      timeNow,
+		ExpiresIn: token.ExpiresIn,
+		Err:       err,
+	})
+	return
+}
+
 // 从微信服务器获取 corp_access_token.
 //  同一时刻只能一个 goroutine 进入, 防止没必要的重复获取.
 func (srv *CorpAccessTokenServer) getToken() (token CorpAccessTokenInfo, cached bool, err error) {
@@ -140,7 +282,7 @@ func (srv *CorpAccessTokenServer) getToken() (token CorpAccessTokenInfo, cached
 	}{
 		SuiteId:       srv.client.SuiteId,
 		AuthCorpId:    srv.authCorpId,
-		PermanentCode: srv.permanentCode,
+		PermanentCode: srv.tokenGet.PermanentCode,
 	}
 
 	var result struct {
@@ -150,17 +292,10 @@ func (srv *CorpAccessTokenServer) getToken() (token CorpAccessTokenInfo, cached
 
 	incompleteURL := "https://qyapi.weixin.qq.com/cgi-bin/service/get_corp_token?suite_access_token="
 	if err = srv.client.PostJSON(incompleteURL, &request, &result); err != nil {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
 		return
 	}
 
 	if result.ErrCode != corp.ErrCodeOK {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = &result.Error
 		return
 	}
@@ -168,10 +303,6 @@ func (srv *CorpAccessTokenServer) getToken() (token CorpAccessTokenInfo, cached
 	// 由于网络的延时, corp_access_token 过期时间留了一个缓冲区
 	switch {
 	case result.ExpiresIn > 31556952: // 60*60*24*365.2425
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = errors.New("expires_in too large: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	case result.ExpiresIn > 60*60:
@@ -183,10 +314,6 @@ func (srv *CorpAccessTokenServer) getToken() (token CorpAccessTokenInfo, cached
 	case result.ExpiresIn > 60:
 		result.ExpiresIn -= 10
 	default:
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = errors.New("expires_in too small: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	}
@@ -198,6 +325,7 @@ func (srv *CorpAccessTokenServer) getToken() (token CorpAccessTokenInfo, cached
 	// 更新缓存
 	srv.tokenCache.Lock()
 	srv.tokenCache.Token = result.CorpAccessTokenInfo.Token
+	srv.tokenCache.ExpiresAt = timeNowUnix + result.CorpAccessTokenInfo.ExpiresIn
 	srv.tokenCache.Unlock()
 
 	token = result.CorpAccessTokenInfo
@@ -0,0 +1,110 @@
+package suite
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSuiteTokenServer struct{}
+
+func (testSuiteTokenServer) TagBD6F157DFE9811E48A29A4DB30FED8E1() {}
+func (testSuiteTokenServer) Token() (string, error)               { return "test-token", nil }
+func (testSuiteTokenServer) TokenRefresh() (string, error)        { return "test-token", nil }
+
+// 可以模拟保存失败和阻塞的 PermanentCodeStorage.
+type testPermanentCodeStorage struct {
+	mutex  sync.Mutex
+	codes  map[string]string
+	fail   bool
+	saving chan struct{} // 不为 nil 时, 进入 SavePermanentCode 时通知
+	block  chan struct{} // 不为 nil 时, SavePermanentCode 等待它关闭
+}
+
+func (storage *testPermanentCodeStorage) LoadPermanentCode(authCorpId string) (string, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	permanentCode, ok := storage.codes[authCorpId]
+	if !ok {
+		return "", ErrPermanentCodeNotFound
+	}
+	return permanentCode, nil
+}
+
+func (storage *testPermanentCodeStorage) SavePermanentCode(authCorpId, permanentCode string) error {
+	storage.mutex.Lock()
+	fail, saving, block := storage.fail, storage.saving, storage.block
+	storage.mutex.Unlock()
+
+	if saving != nil {
+		saving <- struct{}{}
+	}
+	if block != nil {
+		<-block
+	}
+	if fail {
+		return errors.New("test save error")
+	}
+
+	storage.mutex.Lock()
+	storage.codes[authCorpId] = permanentCode
+	storage.mutex.Unlock()
+	return nil
+}
+
+func TestCorpAccessTokenServerSetPermanentCode(t *testing.T) {
+	storage := &testPermanentCodeStorage{codes: map[string]string{"wxcorp": "pc-old"}}
+	srv, err := NewCorpAccessTokenServerWithStorage(NewClient("tj0000000000000000", testSuiteTokenServer{}, nil), "wxcorp", storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	if have := srv.PermanentCode(); have != "pc-old" {
+		t.Errorf("TestCorpAccessTokenServerSetPermanentCode failed, have: %s, want: %s\n", have, "pc-old")
+	}
+
+	// 保存失败时不改变当前的永久授权码
+	storage.fail = true
+	if err = srv.SetPermanentCode("pc-new"); err == nil {
+		t.Errorf("TestCorpAccessTokenServerSetPermanentCode failed, want save error\n")
+	}
+	if have := srv.PermanentCode(); have != "pc-old" {
+		t.Errorf("TestCorpAccessTokenServerSetPermanentCode failed, have: %s, want: %s\n", have, "pc-old")
+	}
+	storage.fail = false
+
+	// 保存的时候不持有 tokenGet 锁
+	storage.saving = make(chan struct{})
+	storage.block = make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.SetPermanentCode("pc-new")
+	}()
+	<-storage.saving
+
+	haveChan := make(chan string, 1)
+	go func() {
+		haveChan <- srv.PermanentCode()
+	}()
+	select {
+	case have := <-haveChan:
+		if have != "pc-old" {
+			t.Errorf("TestCorpAccessTokenServerSetPermanentCode failed, have: %s, want: %s\n", have, "pc-old")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("TestCorpAccessTokenServerSetPermanentCode failed, PermanentCode blocked by SavePermanentCode\n")
+	}
+
+	close(storage.block)
+	if err = <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	if have := srv.PermanentCode(); have != "pc-new" {
+		t.Errorf("TestCorpAccessTokenServerSetPermanentCode failed, have: %s, want: %s\n", have, "pc-new")
+	}
+	if have, _ := storage.LoadPermanentCode("wxcorp"); have != "pc-new" {
+		t.Errorf("TestCorpAccessTokenServerSetPermanentCode failed, have saved: %s, want: %s\n", have, "pc-new")
+	}
+}
@@ -35,9 +35,10 @@ type Request struct {
 	RawMsgXML []byte        // 消息的"明文"XML 文本
 	MixedMsg  *MixedMessage // RawMsgXML 解析后的消息
 
-	AESKey  [32]byte // 当前消息 AES 加密的 key
-	Random  []byte   // 当前消息加密时所用的 random, 16 bytes
-	SuiteId string   // 当前消息的套件ID
+	AESKey   [32]byte // 当前消息 AES 加密的 key
+	AESKeyId string   // 解密当前消息的 AES Key 的 Id, 见 AESKeyRing
+	Random   []byte   // 当前消息加密时所用的 random, 16 bytes
+	SuiteId  string   // 当前消息的套件ID
 
 }
 
@@ -0,0 +1,34 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package suite
+
+import (
+	"errors"
+)
+
+var ErrPermanentCodeNotFound = errors.New("permanent_code not found")
+
+// 授权企业永久授权码(permanent_code)的持久化存储.
+type PermanentCodeStorage interface {
+	// 读取授权企业的永久授权码, 不存在时返回 ErrPermanentCodeNotFound.
+	LoadPermanentCode(authCorpId string) (permanentCode string, err error)
+
+	// 保存授权企业新的永久授权码, 比如企业重新授权之后.
+	SavePermanentCode(authCorpId, permanentCode string) (err error)
+}
+
+// 用临时授权码换取永久授权码, 并保存到 storage.
+func (clt *Client) GetAndSavePermanentCode(authCode string, storage PermanentCodeStorage) (info *PermanentCodeInfo, err error) {
+	if storage == nil {
+		err = errors.New("nil PermanentCodeStorage")
+		return
+	}
+	if info, err = clt.GetPermanentCode(authCode); err != nil {
+		return
+	}
+	err = storage.SavePermanentCode(info.AuthCorpInfo.CorpId, info.PermanentCode)
+	return
+}
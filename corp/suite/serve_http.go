@@ -92,23 +92,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			return
 		}
 
-		aesKey := srv.CurrentAESKey()
-		random, rawMsgXML, aesSuiteId, err := util.AESDecryptMsg(encryptedMsgBytes, aesKey)
+		random, rawMsgXML, aesSuiteId, aesKey, err := corp.AESDecryptMsg(srv, encryptedMsgBytes)
 		if err != nil {
-			// 尝试用上一次的 AESKey 来解密
-			lastAESKey, isLastAESKeyValid := srv.LastAESKey()
-			if !isLastAESKeyValid {
-				errHandler.ServeError(w, r, err)
-				return
-			}
-
-			aesKey = lastAESKey // NOTE
-
-			random, rawMsgXML, aesSuiteId, err = util.AESDecryptMsg(encryptedMsgBytes, aesKey)
-			if err != nil {
-				errHandler.ServeError(w, r, err)
-				return
-			}
+			errHandler.ServeError(w, r, err)
+			return
 		}
 		if haveSuiteId != string(aesSuiteId) {
 			err = fmt.Errorf("the RequestHttpBody's ToUserName(==%s) mismatch the SuiteId with aes encrypt(==%s)", haveSuiteId, aesSuiteId)
@@ -144,9 +131,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			RawMsgXML: rawMsgXML,
 			MixedMsg:  &mixedMsg,
 
-			AESKey:  aesKey,
-			Random:  random,
-			SuiteId: haveSuiteId,
+			AESKey:   aesKey.Key,
+			AESKeyId: aesKey.Id,
+			Random:   random,
+			SuiteId:  haveSuiteId,
 		}
 		srv.MessageHandler().ServeMessage(w, req)
 
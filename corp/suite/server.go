@@ -6,9 +6,10 @@
 package suite
 
 import (
-	"bytes"
 	"errors"
-	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/corp"
 )
 
 type Server interface {
@@ -22,15 +23,13 @@ type Server interface {
 }
 
 var _ Server = (*DefaultServer)(nil)
+var _ corp.AESKeyRingServer = (*DefaultServer)(nil)
 
 type DefaultServer struct {
 	suiteId    string
 	suiteToken string
 
-	rwmutex           sync.RWMutex
-	currentAESKey     [32]byte // 当前的 AES Key
-	lastAESKey        [32]byte // 最后一个 AES Key
-	isLastAESKeyValid bool     // lastAESKey 是否有效, 如果 lastAESKey 是 zero 则无效
+	aesKeyRing *corp.AESKeyRing
 
 	messageHandler MessageHandler
 }
@@ -49,7 +48,10 @@ func NewDefaultServer(suiteId, suiteToken string, AESKey []byte, handler Message
 		suiteToken:     suiteToken,
 		messageHandler: handler,
 	}
-	copy(srv.currentAESKey[:], AESKey)
+
+	var key corp.AESKey
+	copy(key.Key[:], AESKey)
+	srv.aesKeyRing = corp.NewAESKeyRing(key)
 	return
 }
 
@@ -63,33 +65,43 @@ func (srv *DefaultServer) MessageHandler() MessageHandler {
 	return srv.messageHandler
 }
 func (srv *DefaultServer) CurrentAESKey() (key [32]byte) {
-	srv.rwmutex.RLock()
-	key = srv.currentAESKey
-	srv.rwmutex.RUnlock()
+	if aesKey, ok := srv.aesKeyRing.CurrentKey(); ok {
+		key = aesKey.Key
+	}
 	return
 }
 func (srv *DefaultServer) LastAESKey() (key [32]byte, valid bool) {
-	srv.rwmutex.RLock()
-	key = srv.lastAESKey
-	valid = srv.isLastAESKeyValid
-	srv.rwmutex.RUnlock()
+	if keys := srv.aesKeyRing.ValidKeys(time.Now()); len(keys) > 1 {
+		key = keys[1].Key
+		valid = true
+	}
 	return
 }
 
+// 返回 AESKeyRing, 可以通过它设置多个 AES 加密 Key 及其有效期, 或者从外部配置源刷新.
+func (srv *DefaultServer) AESKeyRing() *corp.AESKeyRing {
+	return srv.aesKeyRing
+}
+
+// 更新 AES 加密 Key, 新的 Key 立即生效, 原来的 Key 最晚在 corp.DefaultLastAESKeyTTL 之后过期.
+//  同 UpdateAESKeyWithTTL(aesKey, 0).
 func (srv *DefaultServer) UpdateAESKey(aesKey []byte) (err error) {
+	return srv.UpdateAESKeyWithTTL(aesKey, 0)
+}
+
+// 更新 AES 加密 Key, 新的 Key 立即生效, 原来的 Key 最晚在 lastKeyTTL 之后过期, 见 AESKeyRing.AddKey.
+//  lastKeyTTL <= 0 时使用 corp.DefaultLastAESKeyTTL, 过期的 Key 在下一次更新时被移除, 不会一直累积.
+//  在 AESKeyRing 的锁里完成, 和 AESKeyRing.SetKeys, AESKeyRing.Refresh 并发安全.
+func (srv *DefaultServer) UpdateAESKeyWithTTL(aesKey []byte, lastKeyTTL time.Duration) (err error) {
 	if len(aesKey) != 32 {
 		return errors.New("the length of aesKey must equal to 32")
 	}
 
-	srv.rwmutex.Lock()
-	defer srv.rwmutex.Unlock()
-
-	if bytes.Equal(aesKey, srv.currentAESKey[:]) {
-		return
+	var key corp.AESKey
+	copy(key.Key[:], aesKey)
+	if lastKeyTTL <= 0 {
+		lastKeyTTL = corp.DefaultLastAESKeyTTL
 	}
-
-	srv.isLastAESKeyValid = true
-	srv.lastAESKey = srv.currentAESKey
-	copy(srv.currentAESKey[:], aesKey)
+	srv.aesKeyRing.AddKey(key, lastKeyTTL)
 	return
 }
@@ -0,0 +1,160 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package suite
+
+import (
+	"time"
+
+	"github.com/chanxuehong/wechat/corp"
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+// 微信服务器每隔 20 分钟推送一次 suite_ticket, 超过这个时间没有更新说明推送出了问题.
+const DefaultSuiteTicketStaleAfter = time.Minute * 60
+
+// 保存的 suite_ticket.
+type SuiteTicket struct {
+	Ticket    string    `json:"ticket"`
+	UpdatedAt time.Time `json:"updated_at"` // 最后一次收到推送的时间
+}
+
+// suite_ticket 的存储, 比如文件, redis, 数据库; 多个副本共享同一个存储即可共享 suite_ticket.
+type SuiteTicketStore interface {
+	// 读取套件的 suite_ticket, 不存在时返回 ErrNotFound.
+	LoadSuiteTicket(suiteId string) (ticket *SuiteTicket, err error)
+
+	// 保存套件的 suite_ticket.
+	SaveSuiteTicket(suiteId string, ticket *SuiteTicket) (err error)
+}
+
+var _ TicketGetter = (*StoreSuiteTicketCache)(nil)
+
+// 基于 SuiteTicketStore 的 TicketGetter, 重启后不丢失 suite_ticket.
+//  suite_ticket 缓存在内存里, 只有内存里没有或者已经过时才读取 SuiteTicketStore, 见 util.TicketCache.
+//  读取到的 suite_ticket 超过 staleAfter 没有更新时记录日志并通知 OnStale 回调, 但是仍然返回它.
+type StoreSuiteTicketCache struct {
+	cache *util.TicketCache
+
+	// suite_ticket 过时的回调, 可以为 nil, 需要在使用之前设置.
+	OnStale func(suiteId string, ticket *SuiteTicket)
+}
+
+// 创建一个新的 StoreSuiteTicketCache, staleAfter <= 0 时为 DefaultSuiteTicketStaleAfter.
+func NewStoreSuiteTicketCache(store SuiteTicketStore, staleAfter time.Duration) *StoreSuiteTicketCache {
+	if store == nil {
+		panic("nil SuiteTicketStore")
+	}
+	if staleAfter <= 0 {
+		staleAfter = DefaultSuiteTicketStaleAfter
+	}
+	cache := &StoreSuiteTicketCache{}
+	cache.cache = util.NewTicketCache(suiteTicketStore{store}, staleAfter, cache.onStale)
+	return cache
+}
+
+// 创建一个基于文件的 StoreSuiteTicketCache, 见 NewFileSuiteTicketStore.
+func NewFileSuiteTicketCache(dir string, staleAfter time.Duration) (cache *StoreSuiteTicketCache, err error) {
+	store, err := NewFileSuiteTicketStore(dir)
+	if err != nil {
+		return
+	}
+	cache = NewStoreSuiteTicketCache(store, staleAfter)
+	return
+}
+
+func (cache *StoreSuiteTicketCache) TagEF8503CCFE9811E4959AA4DB30FED8E1() {}
+
+// 保存微信服务器推送过来的 suite_ticket.
+func (cache *StoreSuiteTicketCache) SetSuiteTicket(suiteId string, ticket string) (err error) {
+	return cache.cache.Set(suiteId, ticket)
+}
+
+func (cache *StoreSuiteTicketCache) GetSuiteTicket(suiteId string) (ticket string, err error) {
+	suiteTicket, err := cache.cache.Get(suiteId)
+	if err != nil {
+		return "", suiteTicketError(err)
+	}
+	ticket = suiteTicket.Ticket
+	return
+}
+
+// 返回套件的 suite_ticket 以及它是否过时.
+func (cache *StoreSuiteTicketCache) Status(suiteId string) (ticket *SuiteTicket, stale bool, err error) {
+	suiteTicket, stale, err := cache.cache.Status(suiteId)
+	if err != nil {
+		return nil, false, suiteTicketError(err)
+	}
+	ticket = (*SuiteTicket)(suiteTicket)
+	return
+}
+
+func (cache *StoreSuiteTicketCache) onStale(suiteId string, ticket *util.Ticket) {
+	corp.LogInfoln("[WECHAT] suite_ticket is stale, suiteid:", suiteId, "updated_at:", ticket.UpdatedAt)
+	if cache.OnStale != nil {
+		cache.OnStale(suiteId, (*SuiteTicket)(ticket))
+	}
+}
+
+func suiteTicketError(err error) error {
+	if err == util.ErrTicketNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// 把 SuiteTicketStore 适配为 util.TicketStore.
+type suiteTicketStore struct {
+	store SuiteTicketStore
+}
+
+func (store suiteTicketStore) LoadTicket(suiteId string) (ticket *util.Ticket, err error) {
+	suiteTicket, err := store.store.LoadSuiteTicket(suiteId)
+	if err != nil {
+		if err == ErrNotFound {
+			err = util.ErrTicketNotFound
+		}
+		return
+	}
+	ticket = (*util.Ticket)(suiteTicket)
+	return
+}
+
+func (store suiteTicketStore) SaveTicket(suiteId string, ticket *util.Ticket) (err error) {
+	return store.store.SaveSuiteTicket(suiteId, (*SuiteTicket)(ticket))
+}
+
+var _ SuiteTicketStore = (*FileSuiteTicketStore)(nil)
+
+// 基于文件的 SuiteTicketStore, 每个套件一个 JSON 文件: dir/suiteId.json.
+//  多个副本挂载同一个目录(比如 NFS)即可共享 suite_ticket.
+type FileSuiteTicketStore struct {
+	store *util.FileTicketStore
+}
+
+// 创建一个新的 FileSuiteTicketStore, 目录不存在则创建.
+func NewFileSuiteTicketStore(dir string) (store *FileSuiteTicketStore, err error) {
+	fileStore, err := util.NewFileTicketStore(dir)
+	if err != nil {
+		return
+	}
+	store = &FileSuiteTicketStore{
+		store: fileStore,
+	}
+	return
+}
+
+func (store *FileSuiteTicketStore) LoadSuiteTicket(suiteId string) (ticket *SuiteTicket, err error) {
+	t, err := store.store.LoadTicket(suiteId)
+	if err != nil {
+		return nil, suiteTicketError(err)
+	}
+	ticket = (*SuiteTicket)(t)
+	return
+}
+
+func (store *FileSuiteTicketStore) SaveSuiteTicket(suiteId string, ticket *SuiteTicket) (err error) {
+	return store.store.SaveTicket(suiteId, (*util.Ticket)(ticket))
+}
@@ -0,0 +1,54 @@
+package suite
+
+import (
+	"testing"
+	"time"
+)
+
+// 缓存的行为见 internal/util 的 TestTicketCache*, 这里只测试类型和错误的转换.
+func TestStoreSuiteTicketCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileSuiteTicketCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.GetSuiteTicket("tj0000000000000000"); err != ErrNotFound {
+		t.Errorf("TestStoreSuiteTicketCache failed, have: %v, want: %v\n", err, ErrNotFound)
+	}
+	if _, _, err = cache.Status("tj0000000000000000"); err != ErrNotFound {
+		t.Errorf("TestStoreSuiteTicketCache failed, have: %v, want: %v\n", err, ErrNotFound)
+	}
+
+	// 过时的 suite_ticket 通知 OnStale
+	store, err := NewFileSuiteTicketStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.LoadSuiteTicket("tj0000000000000000"); err != ErrNotFound {
+		t.Errorf("TestStoreSuiteTicketCache failed, have: %v, want: %v\n", err, ErrNotFound)
+	}
+	updatedAt := time.Now().Add(-time.Hour * 2)
+	if err = store.SaveSuiteTicket("tj0000000000000000", &SuiteTicket{Ticket: "ticket@@@old", UpdatedAt: updatedAt}); err != nil {
+		t.Fatal(err)
+	}
+	var staleTicket *SuiteTicket
+	cache.OnStale = func(suiteId string, ticket *SuiteTicket) {
+		staleTicket = ticket
+	}
+	if ticket, err := cache.GetSuiteTicket("tj0000000000000000"); err != nil || ticket != "ticket@@@old" {
+		t.Errorf("TestStoreSuiteTicketCache failed, have: %s, %v, want: %s\n", ticket, err, "ticket@@@old")
+	}
+	if staleTicket == nil || !staleTicket.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("TestStoreSuiteTicketCache failed, have OnStale: %+v\n", staleTicket)
+	}
+
+	if err = cache.SetSuiteTicket("tj0000000000000000", "ticket@@@new"); err != nil {
+		t.Fatal(err)
+	}
+	if ticket, stale, err := cache.Status("tj0000000000000000"); err != nil || stale || ticket.Ticket != "ticket@@@new" {
+		t.Errorf("TestStoreSuiteTicketCache failed, have: %+v, %t, %v\n", ticket, stale, err)
+	}
+	if ticket, err := store.LoadSuiteTicket("tj0000000000000000"); err != nil || ticket.Ticket != "ticket@@@new" {
+		t.Errorf("TestStoreSuiteTicketCache failed, have saved: %+v, %v\n", ticket, err)
+	}
+}
@@ -0,0 +1,11 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 把微信服务器推送过来的消息(事件)转换为 JSON 转发给内部服务.
+//
+//  微信只允许配置一个回调 URL, 如果有多个内部服务需要处理消息(事件), 可以用 Forwarder 转发:
+//  按 MsgType/Event 过滤后 POST 到各个 Webhook, 失败重试, 重试失败的写入死信文件;
+//  可以指定一个主服务(Primary), 同步等待它的回复作为给微信服务器的回复.
+package forward
@@ -0,0 +1,263 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package forward
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+var ErrForwarderClosed = errors.New("forwarder closed")
+
+// 内部服务的 Webhook 配置.
+type Webhook struct {
+	URL      string   // POST 的 URL, body 为消息的 JSON
+	MsgTypes []string // 只转发这些 MsgType 的消息, 为空表示不过滤, 不区分大小写
+	Events   []string // 只转发这些 Event 的事件(MsgType 为 event), 为空表示不过滤, 不区分大小写
+
+	// 是否是主服务, 至多只能有一个.
+	//  主服务同步调用并且不重试, 它回复的 body 作为给微信服务器的回复.
+	Primary bool
+}
+
+func (hook *Webhook) match(msgType, event string) bool {
+	if len(hook.MsgTypes) > 0 && !containsFold(hook.MsgTypes, msgType) {
+		return false
+	}
+	if len(hook.Events) > 0 && msgType == "event" && !containsFold(hook.Events, event) {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, str string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, str) {
+			return true
+		}
+	}
+	return false
+}
+
+// 死信文件里的一条记录, JSON Lines 格式.
+type DeadLetter struct {
+	Time    time.Time       `json:"time"`
+	URL     string          `json:"url"`
+	MsgType string          `json:"msg_type,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+	Error   string          `json:"error"`
+}
+
+// 消息(事件)转发器, 并发安全.
+type Forwarder struct {
+	webhooks   []Webhook
+	httpClient *http.Client
+	maxRetries int
+
+	mutex  sync.Mutex
+	closed bool           // 是否已经调用了 Close
+	wg     sync.WaitGroup // 正在进行的异步转发, 只在 mutex 里并且 closed 为 false 时 Add
+
+	deadLetterMutex sync.Mutex
+	deadLetterFile  *os.File // 可以为 nil
+}
+
+// 创建一个新的 Forwarder.
+//  httpClient:     POST 到 Webhook 使用的 http.Client, 为 nil 则用 http.DefaultClient,
+//                  NOTE: 微信服务器等待回复的时间为 5 秒, 如果有主服务请设置合适的 Timeout
+//  maxRetries:     非主服务转发失败后重试的次数, 重试的时间间隔从 1 秒开始指数增长
+//  deadLetterFile: 重试之后仍然失败的消息追加到这个文件, 为空表示丢弃
+func NewForwarder(webhooks []Webhook, httpClient *http.Client, maxRetries int, deadLetterFile string) (fwd *Forwarder, err error) {
+	if len(webhooks) == 0 {
+		return nil, errors.New("empty webhooks")
+	}
+	hasPrimary := false
+	for i := range webhooks {
+		if webhooks[i].URL == "" {
+			return nil, errors.New("empty Webhook.URL")
+		}
+		if webhooks[i].Primary {
+			if hasPrimary {
+				return nil, errors.New("more than one primary Webhook")
+			}
+			hasPrimary = true
+		}
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	fwd = &Forwarder{
+		webhooks:   append([]Webhook(nil), webhooks...),
+		httpClient: httpClient,
+		maxRetries: maxRetries,
+	}
+	if deadLetterFile != "" {
+		if fwd.deadLetterFile, err = os.OpenFile(deadLetterFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// 是否配置了主服务.
+func (fwd *Forwarder) HasPrimary() bool {
+	for i := range fwd.webhooks {
+		if fwd.webhooks[i].Primary {
+			return true
+		}
+	}
+	return false
+}
+
+// 转发消息, payload 为消息的 JSON.
+//  非主服务异步转发; 如果主服务匹配该消息, 则同步等待并返回主服务回复的 body, 失败返回 err.
+//  Close 之后返回 ErrForwarderClosed.
+func (fwd *Forwarder) Forward(msgType, event string, payload []byte) (primaryReply []byte, err error) {
+	primaryReply, _, err = fwd.forward(msgType, event, payload)
+	return
+}
+
+// 同 Forward, hasPrimary 表示是否有主服务匹配该消息.
+func (fwd *Forwarder) forward(msgType, event string, payload []byte) (primaryReply []byte, hasPrimary bool, err error) {
+	var primary *Webhook
+	var hooks []*Webhook
+	for i := range fwd.webhooks {
+		hook := &fwd.webhooks[i]
+		if !hook.match(msgType, event) {
+			continue
+		}
+		if hook.Primary {
+			primary = hook
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+
+	fwd.mutex.Lock()
+	if fwd.closed {
+		fwd.mutex.Unlock()
+		err = ErrForwarderClosed
+		return
+	}
+	fwd.wg.Add(len(hooks))
+	fwd.mutex.Unlock()
+
+	for _, hook := range hooks {
+		go func(url string) {
+			defer fwd.wg.Done()
+			fwd.deliver(url, msgType, event, payload)
+		}(hook.URL)
+	}
+
+	if primary == nil {
+		return
+	}
+	hasPrimary = true
+	primaryReply, err = fwd.post(primary.URL, payload)
+	return
+}
+
+// 停止接受新的消息, 等待正在进行的异步转发(包括重试)完成, 然后关闭死信文件.
+//  如果 ctx 在这之前结束则返回 ctx.Err(), 此时不关闭死信文件, 可以再次调用 Close 等待.
+func (fwd *Forwarder) Close(ctx context.Context) (err error) {
+	fwd.mutex.Lock()
+	fwd.closed = true
+	fwd.mutex.Unlock()
+
+	doneChan := make(chan struct{})
+	go func() {
+		fwd.wg.Wait()
+		close(doneChan)
+	}()
+
+	select {
+	case <-doneChan:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	fwd.deadLetterMutex.Lock()
+	defer fwd.deadLetterMutex.Unlock()
+
+	if fwd.deadLetterFile != nil {
+		err = fwd.deadLetterFile.Close()
+		fwd.deadLetterFile = nil
+	}
+	return
+}
+
+// 转发到非主服务, 失败则重试, 重试之后仍然失败则写入死信文件.
+func (fwd *Forwarder) deliver(url, msgType, event string, payload []byte) {
+	backoff := time.Second
+	_, err := fwd.post(url, payload)
+	for i := 0; err != nil && i < fwd.maxRetries; i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		_, err = fwd.post(url, payload)
+	}
+	if err == nil {
+		return
+	}
+
+	mp.LogInfoln("[WECHAT] forward to", url, "failed:", err)
+	fwd.writeDeadLetter(&DeadLetter{
+		Time:    time.Now(),
+		URL:     url,
+		MsgType: msgType,
+		Event:   event,
+		Payload: json.RawMessage(payload),
+		Error:   err.Error(),
+	})
+}
+
+func (fwd *Forwarder) post(url string, payload []byte) (respBody []byte, err error) {
+	httpResp, err := fwd.httpClient.Post(url, "application/json; charset=utf-8", bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		err = fmt.Errorf("http.Status: %s", httpResp.Status)
+		return
+	}
+	return ioutil.ReadAll(httpResp.Body)
+}
+
+func (fwd *Forwarder) writeDeadLetter(letter *DeadLetter) {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		mp.LogInfoln("[WECHAT] marshal dead letter failed:", err)
+		return
+	}
+	line = append(line, '\n')
+
+	fwd.deadLetterMutex.Lock()
+	defer fwd.deadLetterMutex.Unlock()
+
+	if fwd.deadLetterFile == nil {
+		return
+	}
+	if _, err = fwd.deadLetterFile.Write(line); err != nil {
+		mp.LogInfoln("[WECHAT] write dead letter failed:", err)
+	}
+}
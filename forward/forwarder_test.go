@@ -0,0 +1,224 @@
+package forward
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mch"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 记录收到的 payload 的 Webhook 服务.
+type testWebhook struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	payloads []string
+}
+
+func newTestWebhook(statusCode int, reply string) *testWebhook {
+	hook := &testWebhook{}
+	hook.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		hook.mutex.Lock()
+		hook.payloads = append(hook.payloads, string(body))
+		hook.mutex.Unlock()
+		w.WriteHeader(statusCode)
+		io.WriteString(w, reply)
+	}))
+	return hook
+}
+
+func (hook *testWebhook) Payloads() []string {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	return append([]string(nil), hook.payloads...)
+}
+
+func TestForwarderFanOut(t *testing.T) {
+	primary := newTestWebhook(http.StatusOK, "<xml><Content>primary</Content></xml>")
+	defer primary.Close()
+	all := newTestWebhook(http.StatusOK, "ignored")
+	defer all.Close()
+	events := newTestWebhook(http.StatusOK, "")
+	defer events.Close()
+
+	fwd, err := NewForwarder([]Webhook{
+		{URL: primary.URL, MsgTypes: []string{"text"}, Primary: true},
+		{URL: all.URL},
+		{URL: events.URL, MsgTypes: []string{"EVENT"}, Events: []string{"subscribe"}},
+	}, nil, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := fwd.Forward("text", "", []byte(`{"MsgType":"text"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "<xml><Content>primary</Content></xml>" {
+		t.Errorf("TestForwarderFanOut failed, have reply: %s\n", reply)
+	}
+	// 主服务不匹配时不等待, 也没有回复
+	if reply, err = fwd.Forward("event", "SUBSCRIBE", []byte(`{"MsgType":"event"}`)); err != nil || reply != nil {
+		t.Errorf("TestForwarderFanOut failed, have: %s, %v\n", reply, err)
+	}
+	fwd.Forward("event", "unsubscribe", []byte(`{"MsgType":"event","Event":"unsubscribe"}`))
+
+	if err = fwd.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if have := strings.Join(primary.Payloads(), "|"); have != `{"MsgType":"text"}` {
+		t.Errorf("TestForwarderFanOut failed, primary have: %s\n", have)
+	}
+	if have := len(all.Payloads()); have != 3 {
+		t.Errorf("TestForwarderFanOut failed, webhook without filter have %d payloads, want: 3\n", have)
+	}
+	if have := strings.Join(events.Payloads(), "|"); have != `{"MsgType":"event"}` {
+		t.Errorf("TestForwarderFanOut failed, event webhook have: %s\n", have)
+	}
+}
+
+func TestForwarderPrimaryFailure(t *testing.T) {
+	primary := newTestWebhook(http.StatusInternalServerError, "")
+	defer primary.Close()
+
+	fwd, err := NewForwarder([]Webhook{{URL: primary.URL, Primary: true}}, nil, 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwd.Close(context.Background())
+
+	if _, err = fwd.Forward("text", "", []byte(`{}`)); err == nil {
+		t.Error("TestForwarderPrimaryFailure failed, want error")
+	}
+	// 主服务不重试
+	if n := len(primary.Payloads()); n != 1 {
+		t.Errorf("TestForwarderPrimaryFailure failed, primary have %d requests, want: 1\n", n)
+	}
+
+	// 主服务失败时公众号消息不回复
+	handler := NewMPMessageHandler(fwd)
+	w := httptest.NewRecorder()
+	handler.ServeMessage(w, &mp.Request{MixedMsg: &mp.MixedMessage{MessageHeader: mp.MessageHeader{MsgType: "text"}}})
+	if w.Body.Len() != 0 {
+		t.Errorf("TestForwarderPrimaryFailure failed, have reply: %s\n", w.Body.Bytes())
+	}
+}
+
+// 支付通知只有主服务同步处理成功才回复 SUCCESS.
+func TestMchMessageHandler(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("TestMchMessageHandler failed, want panic without primary")
+			}
+		}()
+		fwd, _ := NewForwarder([]Webhook{{URL: "http://127.0.0.1/"}}, nil, 0, "")
+		NewMchMessageHandler(fwd)
+	}()
+
+	ok := newTestWebhook(http.StatusOK, "")
+	defer ok.Close()
+	failed := newTestWebhook(http.StatusBadGateway, "")
+	defer failed.Close()
+
+	tests := []struct {
+		hook Webhook
+		want string
+	}{
+		{Webhook{URL: ok.URL, Primary: true}, mch.ReturnCodeSuccess},
+		{Webhook{URL: failed.URL, Primary: true}, mch.ReturnCodeFail},
+		{Webhook{URL: ok.URL, MsgTypes: []string{"text"}, Primary: true}, mch.ReturnCodeFail}, // 主服务不匹配支付通知
+	}
+	for _, test := range tests {
+		fwd, err := NewForwarder([]Webhook{test.hook}, nil, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		NewMchMessageHandler(fwd).ServeMessage(w, &mch.Request{Msg: map[string]string{"out_trade_no": "1"}})
+		fwd.Close(context.Background())
+
+		if have := w.Body.String(); !strings.Contains(have, "<return_code>"+test.want+"</return_code>") {
+			t.Errorf("TestMchMessageHandler failed, webhook: %+v, have: %s, want: %s\n", test.hook, have, test.want)
+		}
+	}
+	if have := strings.Join(ok.Payloads(), "|"); have != `{"out_trade_no":"1"}` {
+		t.Errorf("TestMchMessageHandler failed, primary have: %s\n", have)
+	}
+}
+
+// Close 等待正在进行的重试, 重试失败的写入死信文件; Close 之后不再转发.
+func TestForwarderClose(t *testing.T) {
+	var mutex sync.Mutex
+	var calls int
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		calls++
+		mutex.Unlock()
+		return nil, io.ErrUnexpectedEOF
+	})
+	deadLetterFile := filepath.Join(t.TempDir(), "dead.jsonl")
+	fwd, err := NewForwarder([]Webhook{{URL: "http://webhook.invalid/"}}, &http.Client{Transport: transport}, 1, deadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = fwd.Forward("text", "", []byte(`{"MsgType":"text"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重试要等 1 秒, ctx 先结束
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err = fwd.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("TestForwarderClose failed, have: %v, want: %v\n", err, context.DeadlineExceeded)
+	}
+	if _, err = fwd.Forward("text", "", []byte(`{}`)); err != ErrForwarderClosed {
+		t.Errorf("TestForwarderClose failed, have: %v, want: %v\n", err, ErrForwarderClosed)
+	}
+	if err = fwd.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	if calls != 2 {
+		t.Errorf("TestForwarderClose failed, have calls: %d, want: 2\n", calls)
+	}
+	mutex.Unlock()
+
+	file, err := os.Open(deadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err = json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) != 1 || letters[0].MsgType != "text" || string(letters[0].Payload) != `{"MsgType":"text"}` || letters[0].Error == "" {
+		t.Errorf("TestForwarderClose failed, have dead letters: %+v\n", letters)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
@@ -0,0 +1,140 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package forward
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/chanxuehong/wechat/corp"
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mch"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 主服务回复的明文消息 XML, 用于安全模式下重新加密.
+type rawReply struct {
+	XMLName  struct{} `xml:"xml"`
+	InnerXML []byte   `xml:",innerxml"`
+}
+
+func parseRawReply(reply []byte) (msg *rawReply, err error) {
+	msg = &rawReply{}
+	if err = xml.Unmarshal(reply, msg); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 创建一个转发公众号消息(事件)的 mp.MessageHandler, 转发的 JSON 为 Request.MixedMsg.
+//  主服务回复明文的消息 XML(空 body 表示不回复), 安全模式下自动加密后回复给微信服务器.
+func NewMPMessageHandler(fwd *Forwarder) mp.MessageHandler {
+	if fwd == nil {
+		panic("nil Forwarder")
+	}
+	return mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {
+		payload, err := json.Marshal(r.MixedMsg)
+		if err != nil {
+			mp.LogInfoln("[WECHAT] forward: marshal message failed:", err)
+			return
+		}
+		reply, err := fwd.Forward(r.MixedMsg.MsgType, r.MixedMsg.Event, payload)
+		if err != nil {
+			mp.LogInfoln("[WECHAT] forward to primary failed:", err)
+			return
+		}
+		if reply = bytes.TrimSpace(reply); len(reply) == 0 {
+			return
+		}
+
+		switch r.EncryptType {
+		case "aes":
+			msg, err := parseRawReply(reply)
+			if err != nil {
+				mp.LogInfoln("[WECHAT] forward: invalid primary reply:", err)
+				return
+			}
+			if err = mp.WriteAESResponse(w, r, msg); err != nil {
+				mp.LogInfoln("[WECHAT] forward: write response failed:", err)
+			}
+		default:
+			w.Write(reply)
+		}
+	})
+}
+
+// 创建一个转发企业号消息(事件)的 corp.MessageHandler, 转发的 JSON 为 Request.MixedMsg.
+//  主服务回复明文的消息 XML(空 body 表示不回复), 自动加密后回复给微信服务器.
+func NewCorpMessageHandler(fwd *Forwarder) corp.MessageHandler {
+	if fwd == nil {
+		panic("nil Forwarder")
+	}
+	return corp.MessageHandlerFunc(func(w http.ResponseWriter, r *corp.Request) {
+		payload, err := json.Marshal(r.MixedMsg)
+		if err != nil {
+			corp.LogInfoln("[WECHAT] forward: marshal message failed:", err)
+			return
+		}
+		reply, err := fwd.Forward(r.MixedMsg.MsgType, r.MixedMsg.Event, payload)
+		if err != nil {
+			corp.LogInfoln("[WECHAT] forward to primary failed:", err)
+			return
+		}
+		if reply = bytes.TrimSpace(reply); len(reply) == 0 {
+			return
+		}
+
+		msg, err := parseRawReply(reply)
+		if err != nil {
+			corp.LogInfoln("[WECHAT] forward: invalid primary reply:", err)
+			return
+		}
+		if err = corp.WriteResponse(w, r, msg); err != nil {
+			corp.LogInfoln("[WECHAT] forward: write response failed:", err)
+		}
+	})
+}
+
+// 创建一个转发微信支付通知的 mch.MessageHandler, 转发的 JSON 为 Request.Msg.
+//  NOTE: 支付通知没有 MsgType 和 Event, 配置了 MsgTypes 的 Webhook 收不到支付通知.
+//  回复 SUCCESS 之后微信支付不再重发通知, 所以 fwd 必须有主服务, 只有主服务同步处理成功才回复 SUCCESS:
+//  原样回复主服务的 body 给微信服务器(为空则回复 SUCCESS), 主服务失败或者不匹配该通知则回复 FAIL.
+func NewMchMessageHandler(fwd *Forwarder) mch.MessageHandler {
+	if fwd == nil {
+		panic("nil Forwarder")
+	}
+	if !fwd.HasPrimary() {
+		panic("Forwarder without primary Webhook")
+	}
+	return mch.MessageHandlerFunc(func(w http.ResponseWriter, r *mch.Request) {
+		payload, err := json.Marshal(r.Msg)
+		if err != nil {
+			mch.LogInfoln("[WECHAT] forward: marshal message failed:", err)
+			return
+		}
+		reply, hasPrimary, err := fwd.forward("", "", payload)
+		if err == nil && !hasPrimary {
+			err = errors.New("primary Webhook does not match the notification")
+		}
+		if err != nil {
+			mch.LogInfoln("[WECHAT] forward to primary failed:", err)
+			xml.NewEncoder(w).Encode(&mch.Error{
+				ReturnCode: mch.ReturnCodeFail,
+				ReturnMsg:  "forward failed",
+			})
+			return
+		}
+		if reply = bytes.TrimSpace(reply); len(reply) > 0 {
+			w.Write(reply)
+			return
+		}
+		xml.NewEncoder(w).Encode(&mch.Error{
+			ReturnCode: mch.ReturnCodeSuccess,
+		})
+	})
+}
@@ -0,0 +1,199 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package daemon
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// 刷新失败后重试的时间间隔从 MinBackoff 开始指数增长, 最大为 MaxBackoff
+	MinBackoff = time.Second * 5
+	MaxBackoff = time.Minute * 5
+
+	// 每次刷新的时间间隔随机提前至多 JitterPercent%, 避免大量帐号同时刷新
+	JitterPercent = 10
+)
+
+// Daemon 管理中控服务器里定时刷新 access_token(ticket) 的后台 goroutine.
+//  Daemon 可以多次 Start, Stop, 并发安全.
+//  刷新的时间间隔会随机提前一点(jitter), 刷新失败则按指数退避重试, 但是不会晚于原定的刷新时间.
+type Daemon struct {
+	// 刷新函数, 返回下一次刷新的时间间隔, 如果 next <= 0 则保持当前的时间间隔不变.
+	// 刷新失败时 next > 0 同样会更新时间间隔, 重试的时间间隔不会超过它; 这样 Start 时用很短的时间间隔尽快刷新第一次,
+	// 第一次失败后也不会一直按这个很短的时间间隔重试.
+	refresh func() (next time.Duration, err error)
+
+	mutex     sync.Mutex
+	resetChan chan time.Duration // 用于重置后台 goroutine 里的 timer, 缓冲为 1, 只保留最新的时间间隔
+	stopChan  chan struct{}      // 关闭表示通知后台 goroutine 退出
+	doneChan  chan struct{}      // 关闭表示后台 goroutine 已经退出
+	isRunning bool
+}
+
+// 创建一个新的 Daemon, 需要调用 Start 才会启动后台 goroutine.
+func New(refresh func() (next time.Duration, err error)) *Daemon {
+	if refresh == nil {
+		panic("nil refresh function")
+	}
+	return &Daemon{
+		refresh: refresh,
+	}
+}
+
+// 启动后台 goroutine, period 为第一次刷新的时间间隔.
+//  如果后台 goroutine 已经在运行则什么都不做.
+//  如果上一次 Stop 没有等到后台 goroutine 退出(正在刷新), 新的后台 goroutine 会等它退出之后才开始计时,
+//  保证同时只有一个刷新; Start 本身不会等待.
+func (d *Daemon) Start(period time.Duration) {
+	if period <= 0 {
+		panic("period must be positive")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.isRunning {
+		return
+	}
+	prevDoneChan := d.doneChan
+	d.isRunning = true
+	d.resetChan = make(chan time.Duration, 1)
+	d.stopChan = make(chan struct{})
+	d.doneChan = make(chan struct{})
+
+	go d.run(prevDoneChan, period, d.resetChan, d.stopChan, d.doneChan)
+}
+
+// 通知后台 goroutine 退出, 并等待其退出(等待正在进行的刷新完成).
+//  如果 ctx 在后台 goroutine 退出前结束则返回 ctx.Err(), 此时后台 goroutine 仍然会在刷新完成后退出.
+//  Stop 之后可以再次 Start.
+func (d *Daemon) Stop(ctx context.Context) error {
+	d.mutex.Lock()
+	if !d.isRunning {
+		d.mutex.Unlock()
+		return nil
+	}
+	d.isRunning = false
+	close(d.stopChan)
+	doneChan := d.doneChan
+	d.mutex.Unlock()
+
+	select {
+	case <-doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 后台 goroutine 是否在运行.
+func (d *Daemon) IsRunning() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.isRunning
+}
+
+// 重置后台 goroutine 下一次刷新的时间间隔, 如果后台 goroutine 没有运行则什么都不做.
+//  Reset 不会阻塞, 可以在刷新函数里调用; 后台 goroutine 还没有处理的 period 会被新的覆盖.
+func (d *Daemon) Reset(period time.Duration) {
+	if period <= 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.isRunning {
+		return
+	}
+	for {
+		select {
+		case d.resetChan <- period:
+			return
+		default:
+		}
+		select { // 丢弃还没有处理的 period
+		case <-d.resetChan:
+		default:
+		}
+	}
+}
+
+func (d *Daemon) run(prevDoneChan <-chan struct{}, period time.Duration, resetChan <-chan time.Duration, stopChan <-chan struct{}, doneChan chan<- struct{}) {
+	defer close(doneChan)
+
+	if prevDoneChan != nil {
+		<-prevDoneChan // 上一个后台 goroutine 的 stopChan 已经关闭, 在刷新完成后就会退出
+	}
+
+	timer := time.NewTimer(Jitter(period))
+	defer timer.Stop()
+
+	var backoff time.Duration // 当前的重试时间间隔, 0 表示上一次刷新成功
+	for {
+		select {
+		case <-stopChan:
+			return
+
+		case period = <-resetChan:
+			backoff = 0
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(Jitter(period))
+
+		case <-timer.C:
+			// 刷新期间如果收到退出通知, 刷新完成后再退出
+			next, err := d.refresh()
+			select {
+			case <-stopChan:
+				return
+			default:
+			}
+			if next > 0 {
+				period = next
+			}
+			if err != nil {
+				backoff = NextBackoff(backoff)
+				if backoff < period {
+					timer.Reset(backoff)
+				} else {
+					timer.Reset(period)
+				}
+				break
+			}
+			backoff = 0
+			timer.Reset(Jitter(period))
+		}
+	}
+}
+
+// 随机提前 period 至多 JitterPercent%, 自己调度刷新的地方(比如 component.AuthorizerTokenPool)也使用它.
+func Jitter(period time.Duration) time.Duration {
+	n := int64(period) * JitterPercent / 100
+	if n <= 0 {
+		return period
+	}
+	return period - time.Duration(rand.Int63n(n))
+}
+
+// 刷新失败后下一次重试的时间间隔, backoff 为当前的重试时间间隔, 0 表示上一次刷新成功.
+func NextBackoff(backoff time.Duration) time.Duration {
+	if backoff < MinBackoff {
+		return MinBackoff
+	}
+	if backoff *= 2; backoff > MaxBackoff {
+		return MaxBackoff
+	}
+	return backoff
+}
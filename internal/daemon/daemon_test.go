@@ -0,0 +1,278 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	want := []time.Duration{
+		MinBackoff,
+		MinBackoff * 2,
+		MinBackoff * 4,
+		MinBackoff * 8,
+		MinBackoff * 16,
+		MinBackoff * 32,
+		MaxBackoff,
+		MaxBackoff,
+	}
+	var backoff time.Duration
+	for i, w := range want {
+		backoff = NextBackoff(backoff)
+		if backoff != w {
+			t.Errorf("TestNextBackoff failed, step %d have: %s, want: %s\n", i, backoff, w)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	period := time.Hour
+	for i := 0; i < 1000; i++ {
+		have := Jitter(period)
+		if have > period || have <= period-period*JitterPercent/100 {
+			t.Fatalf("TestJitter failed, have: %s, out of range\n", have)
+		}
+	}
+	if have := Jitter(5); have != 5 {
+		t.Errorf("TestJitter failed, have: %d, want: 5\n", have)
+	}
+}
+
+// 刷新失败时重试的时间间隔不会超过 period, 即不会晚于原定的刷新时间.
+func TestDaemonBackoffClamp(t *testing.T) {
+	var calls int32
+	d := New(func() (time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		return 0, errors.New("refresh failed")
+	})
+	d.Start(time.Millisecond * 20)
+	time.Sleep(time.Millisecond * 200)
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n < 3 {
+		t.Errorf("TestDaemonBackoffClamp failed, have calls: %d, want >= 3\n", n)
+	}
+}
+
+func TestDaemonStartStopReset(t *testing.T) {
+	refreshed := make(chan struct{}, 10)
+	d := New(func() (time.Duration, error) {
+		refreshed <- struct{}{}
+		return time.Hour, nil
+	})
+	if d.IsRunning() {
+		t.Fatal("TestDaemonStartStopReset failed, running before Start")
+	}
+
+	d.Start(time.Hour)
+	d.Start(time.Hour) // 已经在运行, 什么都不做
+	if !d.IsRunning() {
+		t.Fatal("TestDaemonStartStopReset failed, not running after Start")
+	}
+
+	// Reset 之后按新的时间间隔刷新
+	d.Reset(time.Millisecond * 10)
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("TestDaemonStartStopReset failed, no refresh after Reset")
+	}
+
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d.IsRunning() {
+		t.Fatal("TestDaemonStartStopReset failed, running after Stop")
+	}
+	d.Reset(time.Millisecond) // 没有运行, 什么都不做
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop 之后可以再次 Start
+	d.Start(time.Millisecond * 10)
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("TestDaemonStartStopReset failed, no refresh after restart")
+	}
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 刷新期间 Stop 超时, 再次 Start 不会阻塞, 也不会同时运行两个刷新.
+func TestDaemonStopDuringRefresh(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		running  int
+		maxCount int
+	)
+	entered := make(chan struct{}, 10)
+	release := make(chan struct{})
+	d := New(func() (time.Duration, error) {
+		mutex.Lock()
+		running++
+		if running > maxCount {
+			maxCount = running
+		}
+		mutex.Unlock()
+
+		entered <- struct{}{}
+		<-release
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return time.Hour, nil
+	})
+
+	d.Start(time.Millisecond)
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if err := d.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("TestDaemonStopDuringRefresh failed, have: %v, want: %v\n", err, context.DeadlineExceeded)
+	}
+
+	// 旧的刷新还没有完成, Start, Reset, Stop 都不会阻塞
+	returned := make(chan struct{})
+	go func() {
+		d.Start(time.Millisecond)
+		d.Reset(time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+		d.Stop(ctx)
+		d.Start(time.Millisecond)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("TestDaemonStopDuringRefresh failed, blocked by the old refresh")
+	}
+	select {
+	case <-entered:
+		t.Fatal("TestDaemonStopDuringRefresh failed, refreshed before the old goroutine exited")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(release)
+	<-entered // 新的后台 goroutine 刷新
+
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if maxCount != 1 {
+		t.Errorf("TestDaemonStopDuringRefresh failed, have concurrent refresh: %d, want: 1\n", maxCount)
+	}
+}
+
+// 在刷新函数里调用 Reset 不会死锁, 并且生效.
+func TestDaemonResetInRefresh(t *testing.T) {
+	var d *Daemon
+	var calls int32
+	refreshed := make(chan struct{}, 10)
+	d = New(func() (time.Duration, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			d.Reset(time.Millisecond * 10)
+			d.Reset(time.Millisecond * 10) // 没有处理的 period 被覆盖, 不会阻塞
+		}
+		refreshed <- struct{}{}
+		return time.Hour, nil
+	})
+	d.Start(time.Millisecond)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-refreshed:
+		case <-time.After(time.Second):
+			t.Fatalf("TestDaemonResetInRefresh failed, refresh %d not happened\n", i+1)
+		}
+	}
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 刷新失败时返回的 next > 0 会更新时间间隔, 不会一直按 Start 时很短的时间间隔重试.
+func TestDaemonErrorNext(t *testing.T) {
+	var calls int32
+	d := New(func() (time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		return time.Hour, errors.New("refresh failed")
+	})
+	d.Start(time.Millisecond * 10)
+	time.Sleep(time.Millisecond * 200)
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 第一次失败后按 MinBackoff 重试
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("TestDaemonErrorNext failed, have calls: %d, want: 1\n", n)
+	}
+}
+
+// 每次刷新随机提前至多 JitterPercent%, 不会推迟.
+func TestDaemonJitteredRefresh(t *testing.T) {
+	const period = time.Millisecond * 200
+	start := time.Now()
+	called := make(chan time.Duration, 1)
+	d := New(func() (time.Duration, error) {
+		select {
+		case called <- time.Since(start):
+		default:
+		}
+		return period, nil
+	})
+	d.Start(period)
+	defer d.Stop(context.Background())
+
+	select {
+	case have := <-called:
+		if have < period-period*JitterPercent/100 || have > period+time.Millisecond*100 {
+			t.Errorf("TestDaemonJitteredRefresh failed, have: %s, want: (%s, %s]\n", have, period-period*JitterPercent/100, period)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("TestDaemonJitteredRefresh failed, no refresh\n")
+	}
+}
+
+// 刷新失败后按 MinBackoff 重试, 成功后恢复正常的时间间隔.
+func TestDaemonBackoffRetry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	var mutex sync.Mutex
+	var times []time.Time
+	d := New(func() (time.Duration, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			return time.Hour, errors.New("refresh failed")
+		}
+		return time.Hour, nil
+	})
+	d.Start(time.Millisecond * 10)
+	time.Sleep(MinBackoff + time.Second)
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(times) != 2 {
+		t.Fatalf("TestDaemonBackoffRetry failed, have calls: %d, want: 2\n", len(times))
+	}
+	if have := times[1].Sub(times[0]); have < MinBackoff || have > MinBackoff+time.Millisecond*500 {
+		t.Errorf("TestDaemonBackoffRetry failed, have: %s, want about: %s\n", have, MinBackoff)
+	}
+}
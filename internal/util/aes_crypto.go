@@ -115,3 +115,38 @@ func AESDecryptMsg(ciphertext []byte, aesKey [32]byte) (random, rawXMLMsg, appId
 	appId = plaintext[appIdOffset:]
 	return
 }
+
+// AES-CBC 解密, 并去除 PKCS#7 补位, 用于小程序 encryptedData 这类不带 random, msg_len, appId 拼接的密文.
+func AESCBCDecrypt(ciphertext, key, iv []byte) (plaintext []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	if len(iv) != aes.BlockSize {
+		err = fmt.Errorf("the length of iv is incorrect: %d", len(iv))
+		return
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		err = fmt.Errorf("ciphertext is not a multiple of the block size, the length is %d", len(ciphertext))
+		return
+	}
+
+	plaintext = make([]byte, len(ciphertext))
+	mode := cipher.NewCBCDecrypter(block, iv)
+	mode.CryptBlocks(plaintext, ciphertext)
+
+	// PKCS#7 去除补位
+	amountToPad := int(plaintext[len(plaintext)-1])
+	if amountToPad < 1 || amountToPad > aes.BlockSize {
+		err = fmt.Errorf("the amount to pad is incorrect: %d", amountToPad)
+		return nil, err
+	}
+	for _, b := range plaintext[len(plaintext)-amountToPad:] {
+		if int(b) != amountToPad {
+			err = fmt.Errorf("the padding is incorrect")
+			return nil, err
+		}
+	}
+	plaintext = plaintext[:len(plaintext)-amountToPad]
+	return
+}
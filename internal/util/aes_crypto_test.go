@@ -0,0 +1,84 @@
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+)
+
+// AES-CBC 加密, 不补位, len(plaintext) 必须是 aes.BlockSize 的整数倍.
+func testAESCBCEncrypt(plaintext, key, iv []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+	return ciphertext
+}
+
+// PKCS#7 补位
+func testPKCS7Pad(plaintext []byte) []byte {
+	amountToPad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	return append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(amountToPad)}, amountToPad)...)
+}
+
+var (
+	testAESKey = []byte("0123456789abcdef")
+	testAESIV  = []byte("fedcba9876543210")
+)
+
+func TestAESCBCDecrypt(t *testing.T) {
+	for n := 0; n <= 2*aes.BlockSize+1; n++ {
+		plaintext := bytes.Repeat([]byte{'a'}, n)
+		ciphertext := testAESCBCEncrypt(testPKCS7Pad(plaintext), testAESKey, testAESIV)
+
+		have, err := AESCBCDecrypt(ciphertext, testAESKey, testAESIV)
+		if err != nil {
+			t.Fatalf("TestAESCBCDecrypt failed, length %d error: %v\n", n, err)
+		}
+		if !bytes.Equal(have, plaintext) {
+			t.Errorf("TestAESCBCDecrypt failed, have: %q, want: %q\n", have, plaintext)
+		}
+	}
+}
+
+func TestAESCBCDecryptBadPadding(t *testing.T) {
+	tests := []struct {
+		lastBlock []byte
+		errPrefix string
+	}{
+		{append(bytes.Repeat([]byte{'a'}, 15), 0), "the amount to pad is incorrect"},
+		{append(bytes.Repeat([]byte{'a'}, 15), aes.BlockSize+1), "the amount to pad is incorrect"},
+		{append(bytes.Repeat([]byte{'a'}, 13), 3, 2, 3), "the padding is incorrect"},
+	}
+	for _, test := range tests {
+		ciphertext := testAESCBCEncrypt(test.lastBlock, testAESKey, testAESIV)
+
+		plaintext, err := AESCBCDecrypt(ciphertext, testAESKey, testAESIV)
+		if err == nil || !strings.HasPrefix(err.Error(), test.errPrefix) {
+			t.Errorf("TestAESCBCDecryptBadPadding failed, have: %v, want: %s\n", err, test.errPrefix)
+		}
+		if plaintext != nil {
+			t.Errorf("TestAESCBCDecryptBadPadding failed, have plaintext: %q, want: nil\n", plaintext)
+		}
+	}
+}
+
+func TestAESCBCDecryptBadInput(t *testing.T) {
+	ciphertext := testAESCBCEncrypt(testPKCS7Pad([]byte("hello")), testAESKey, testAESIV)
+
+	if _, err := AESCBCDecrypt(ciphertext, testAESKey, testAESIV[:8]); err == nil || !strings.HasPrefix(err.Error(), "the length of iv is incorrect") {
+		t.Errorf("TestAESCBCDecryptBadInput failed, have: %v, want iv length error\n", err)
+	}
+	if _, err := AESCBCDecrypt(ciphertext, testAESKey[:10], testAESIV); err == nil {
+		t.Errorf("TestAESCBCDecryptBadInput failed, want key size error\n")
+	}
+	for _, n := range []int{0, 1, len(ciphertext) - 1} {
+		if _, err := AESCBCDecrypt(ciphertext[:n], testAESKey, testAESIV); err == nil || !strings.HasPrefix(err.Error(), "ciphertext is not a multiple of the block size") {
+			t.Errorf("TestAESCBCDecryptBadInput failed, length %d have: %v, want block size error\n", n, err)
+		}
+	}
+}
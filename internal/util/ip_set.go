@@ -0,0 +1,94 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IP 地址集合, 由单个 IP 和 CIDR 组成, 创建之后只读, 并发安全.
+type IPSet struct {
+	nets []*net.IPNet
+}
+
+// 解析 IP 地址列表, 每一项可以是单个 IP(如 101.226.62.77) 或者 CIDR(如 101.226.103.0/25).
+func ParseIPSet(list []string) (set *IPSet, err error) {
+	set = &IPSet{
+		nets: make([]*net.IPNet, 0, len(list)),
+	}
+	for _, str := range list {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			continue
+		}
+		if strings.IndexByte(str, '/') >= 0 {
+			_, ipNet, err := net.ParseCIDR(str)
+			if err != nil {
+				return nil, err
+			}
+			set.nets = append(set.nets, ipNet)
+			continue
+		}
+		ip := net.ParseIP(str)
+		if ip == nil {
+			return nil, errors.New("invalid ip: " + str)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			set.nets = append(set.nets, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			set.nets = append(set.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+		}
+	}
+	return
+}
+
+// 集合里 IP(CIDR) 的个数, nil 集合为 0.
+func (set *IPSet) Len() int {
+	if set == nil {
+		return 0
+	}
+	return len(set.nets)
+}
+
+// 判断 ip 是否在集合里, nil 集合不包含任何 ip.
+func (set *IPSet) Contains(ip net.IP) bool {
+	if set == nil || ip == nil {
+		return false
+	}
+	for _, ipNet := range set.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取 http 请求的来源 IP, 获取失败返回 nil.
+//  如果 r.RemoteAddr 是受信任的代理(在 trustedProxies 里), 则从右往左查找 X-Forwarded-For 里
+//  第一个不受信任的地址; trustedProxies 为 nil 则直接使用 r.RemoteAddr, 忽略 X-Forwarded-For.
+func RemoteIP(r *http.Request, trustedProxies *IPSet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trustedProxies.Contains(ip) {
+		return ip
+	}
+
+	forwardedFor := r.Header[http.CanonicalHeaderKey("X-Forwarded-For")]
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		addrs := strings.Split(forwardedFor[i], ",")
+		for j := len(addrs) - 1; j >= 0; j-- {
+			ip = net.ParseIP(strings.TrimSpace(addrs[j]))
+			if ip == nil {
+				return nil
+			}
+			if !trustedProxies.Contains(ip) {
+				return ip
+			}
+		}
+	}
+	return ip
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestIPSet(t *testing.T) {
+	set, err := ParseIPSet([]string{"101.226.62.77", " 101.226.103.0/25 ", "", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != 3 {
+		t.Errorf("TestIPSet failed, have Len(): %d, want: 3\n", set.Len())
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"101.226.62.77", true},
+		{"101.226.62.78", false},
+		{"101.226.103.1", true},
+		{"101.226.103.128", false},
+		{"::ffff:101.226.62.77", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+	}
+	for _, test := range tests {
+		if have := set.Contains(net.ParseIP(test.ip)); have != test.want {
+			t.Errorf("TestIPSet failed, Contains(%s) have: %t, want: %t\n", test.ip, have, test.want)
+		}
+	}
+
+	if _, err = ParseIPSet([]string{"101.226.62"}); err == nil {
+		t.Error("TestIPSet failed, want error for invalid ip\n")
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	proxies, err := ParseIPSet([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remoteAddr     string
+		forwardedFor   []string
+		trustedProxies *IPSet
+		want           string
+	}{
+		{"101.226.62.77:1234", nil, nil, "101.226.62.77"},
+		{"101.226.62.77:1234", []string{"1.2.3.4"}, proxies, "101.226.62.77"},
+		{"10.0.0.1:1234", []string{"1.2.3.4"}, nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"1.2.3.4, 101.226.62.77, 10.0.0.2"}, proxies, "101.226.62.77"},
+		{"10.0.0.1:1234", []string{"101.226.62.77", "10.0.0.2"}, proxies, "101.226.62.77"},
+		{"10.0.0.1:1234", nil, proxies, "10.0.0.1"},
+	}
+	for _, test := range tests {
+		r := &http.Request{RemoteAddr: test.remoteAddr, Header: make(http.Header)}
+		for _, v := range test.forwardedFor {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if have := RemoteIP(r, test.trustedProxies); have.String() != test.want {
+			t.Errorf("TestRemoteIP failed, have: %s, want: %s\n", have, test.want)
+		}
+	}
+}
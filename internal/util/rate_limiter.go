@@ -0,0 +1,79 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// 按 key 分别限流的令牌桶, 并发安全.
+type RateLimiter struct {
+	rate  float64 // 每秒产生的令牌数
+	burst float64 // 令牌桶的容量
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time // 最后一次更新 tokens 的时间
+}
+
+// 创建一个新的 RateLimiter, 每个 key 每秒允许 rate 个请求, 最多允许 burst 个突发请求.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		panic("rate must be positive")
+	}
+	if burst <= 0 {
+		panic("burst must be positive")
+	}
+	return &RateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// 判断 key 的请求是否被允许, 允许则消耗一个令牌.
+func (l *RateLimiter) Allow(key string) bool {
+	timeNow := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(timeNow)
+
+	bucket := l.buckets[key]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: l.burst, last: timeNow}
+		l.buckets[key] = bucket
+	} else {
+		bucket.tokens += timeNow.Sub(bucket.last).Seconds() * l.rate
+		if bucket.tokens > l.burst {
+			bucket.tokens = l.burst
+		}
+		bucket.last = timeNow
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// 每分钟清理一次已经装满的令牌桶, 避免 buckets 无限增长.
+func (l *RateLimiter) sweep(timeNow time.Time) {
+	if timeNow.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = timeNow
+
+	for key, bucket := range l.buckets {
+		if bucket.tokens+timeNow.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(0.001, 2)
+	for i, want := range []bool{true, true, false, false} {
+		if have := l.Allow("1.2.3.4"); have != want {
+			t.Errorf("TestRateLimiterBurst failed, request %d, have: %t, want: %t\n", i, have, want)
+		}
+	}
+	// 不同的 key 互不影响
+	if !l.Allow("5.6.7.8") {
+		t.Errorf("TestRateLimiterBurst failed, other key denied\n")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := NewRateLimiter(100, 1)
+	if !l.Allow("key") {
+		t.Fatalf("TestRateLimiterRefill failed, first request denied\n")
+	}
+	if l.Allow("key") {
+		t.Errorf("TestRateLimiterRefill failed, second request allowed\n")
+	}
+	time.Sleep(time.Millisecond * 30)
+	if !l.Allow("key") {
+		t.Errorf("TestRateLimiterRefill failed, request after refill denied\n")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := NewRateLimiter(1000, 1)
+	l.Allow("idle")
+	l.Allow("busy")
+
+	l.mutex.Lock()
+	l.lastSweep = time.Now().Add(-time.Minute * 2)
+	l.buckets["busy"].last = time.Now().Add(time.Hour) // 令牌桶还没有装满
+	l.mutex.Unlock()
+
+	time.Sleep(time.Millisecond * 10)
+	l.Allow("other")
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.buckets["idle"]; ok {
+		t.Errorf("TestRateLimiterSweep failed, full bucket not removed\n")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Errorf("TestRateLimiterSweep failed, bucket still filling removed\n")
+	}
+}
+
+func TestNewRateLimiterPanic(t *testing.T) {
+	for _, args := range []struct {
+		rate  float64
+		burst int
+	}{{0, 1}, {1, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("TestNewRateLimiterPanic failed, want panic for %+v\n", args)
+				}
+			}()
+			NewRateLimiter(args.rate, args.burst)
+		}()
+	}
+}
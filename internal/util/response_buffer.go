@@ -0,0 +1,39 @@
+package util
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// 把 http 响应保存在内存里的 http.ResponseWriter.
+type ResponseBuffer struct {
+	header      http.Header
+	wroteHeader bool
+
+	StatusCode int          // 响应的状态码, 默认为 200
+	Body       bytes.Buffer // 响应的 body
+}
+
+func NewResponseBuffer() *ResponseBuffer {
+	return &ResponseBuffer{
+		header:     make(http.Header),
+		StatusCode: http.StatusOK,
+	}
+}
+
+func (buf *ResponseBuffer) Header() http.Header {
+	return buf.header
+}
+
+func (buf *ResponseBuffer) WriteHeader(code int) {
+	if buf.wroteHeader {
+		return
+	}
+	buf.wroteHeader = true
+	buf.StatusCode = code
+}
+
+func (buf *ResponseBuffer) Write(p []byte) (int, error) {
+	buf.wroteHeader = true
+	return buf.Body.Write(p)
+}
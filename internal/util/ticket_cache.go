@@ -0,0 +1,179 @@
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/json"
+)
+
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// 微信服务器定时推送的 ticket, 比如 component_verify_ticket, suite_ticket.
+type Ticket struct {
+	Ticket    string    `json:"ticket"`
+	UpdatedAt time.Time `json:"updated_at"` // 最后一次收到推送的时间
+}
+
+// ticket 的存储, id 为第三方平台的 AppId 或者套件的 SuiteId.
+type TicketStore interface {
+	// 不存在时返回 ErrTicketNotFound.
+	LoadTicket(id string) (ticket *Ticket, err error)
+	SaveTicket(id string, ticket *Ticket) (err error)
+}
+
+// 基于 TicketStore 的 ticket 缓存.
+//  Get 优先返回内存里的 ticket, 只有内存里没有(比如刚启动)或者已经过时才读取 TicketStore,
+//  这样多个副本共享 TicketStore 时, 其他副本收到的推送也能在过时之后读到.
+//  ticket 超过 staleAfter 没有更新时通知 onStale, 但是仍然返回它.
+type TicketCache struct {
+	store      TicketStore
+	staleAfter time.Duration
+	onStale    func(id string, ticket *Ticket) // 可以为 nil
+
+	mutex   sync.RWMutex
+	tickets map[string]*Ticket
+}
+
+// 创建一个新的 TicketCache, staleAfter 必须大于 0.
+func NewTicketCache(store TicketStore, staleAfter time.Duration, onStale func(id string, ticket *Ticket)) *TicketCache {
+	if store == nil {
+		panic("nil TicketStore")
+	}
+	if staleAfter <= 0 {
+		panic("staleAfter must be positive")
+	}
+	return &TicketCache{
+		store:      store,
+		staleAfter: staleAfter,
+		onStale:    onStale,
+		tickets:    make(map[string]*Ticket),
+	}
+}
+
+// 保存新推送的 ticket, 先保存到 TicketStore, 成功之后再更新内存.
+func (cache *TicketCache) Set(id, ticket string) (err error) {
+	if ticket == "" {
+		return errors.New("empty ticket")
+	}
+	t := &Ticket{
+		Ticket:    ticket,
+		UpdatedAt: time.Now(),
+	}
+	if err = cache.store.SaveTicket(id, t); err != nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	cache.tickets[id] = t
+	cache.mutex.Unlock()
+	return
+}
+
+// 返回 ticket, 过时的 ticket 会通知 onStale.
+func (cache *TicketCache) Get(id string) (ticket *Ticket, err error) {
+	ticket, stale, err := cache.Status(id)
+	if err != nil {
+		return
+	}
+	if stale && cache.onStale != nil {
+		cache.onStale(id, ticket)
+	}
+	return
+}
+
+// 返回 ticket 以及它是否过时, 不通知 onStale.
+func (cache *TicketCache) Status(id string) (ticket *Ticket, stale bool, err error) {
+	cache.mutex.RLock()
+	ticket = cache.tickets[id]
+	cache.mutex.RUnlock()
+
+	if ticket != nil && !cache.isStale(ticket) {
+		return
+	}
+
+	loaded, err := cache.store.LoadTicket(id)
+	if err == nil && (loaded == nil || loaded.Ticket == "") {
+		err = ErrTicketNotFound
+	}
+	if err != nil {
+		if ticket == nil {
+			return
+		}
+		err = nil // 读取失败时继续使用内存里的 ticket
+	} else {
+		cache.mutex.Lock()
+		if current := cache.tickets[id]; current == nil || loaded.UpdatedAt.After(current.UpdatedAt) {
+			cache.tickets[id] = loaded
+		}
+		ticket = cache.tickets[id]
+		cache.mutex.Unlock()
+	}
+	stale = cache.isStale(ticket)
+	return
+}
+
+func (cache *TicketCache) isStale(ticket *Ticket) bool {
+	return time.Since(ticket.UpdatedAt) > cache.staleAfter
+}
+
+var _ TicketStore = (*FileTicketStore)(nil)
+
+// 基于文件的 TicketStore, 每个 id 一个 JSON 文件: dir/id.json.
+//  多个副本挂载同一个目录(比如 NFS)即可共享 ticket.
+type FileTicketStore struct {
+	dir   string
+	mutex sync.Mutex // 串行化同一进程内的写
+}
+
+// 创建一个新的 FileTicketStore, 目录不存在则创建.
+func NewFileTicketStore(dir string) (store *FileTicketStore, err error) {
+	if dir == "" {
+		return nil, errors.New("empty dir")
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	store = &FileTicketStore{
+		dir: dir,
+	}
+	return
+}
+
+func (store *FileTicketStore) filename(id string) string {
+	return filepath.Join(store.dir, filepath.Base(id)+".json")
+}
+
+func (store *FileTicketStore) LoadTicket(id string) (ticket *Ticket, err error) {
+	data, err := ioutil.ReadFile(store.filename(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrTicketNotFound
+		}
+		return
+	}
+	ticket = &Ticket{}
+	if err = json.Unmarshal(data, ticket); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (store *FileTicketStore) SaveTicket(id string, ticket *Ticket) (err error) {
+	if id == "" {
+		return errors.New("empty id")
+	}
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return WriteFileAtomic(store.filename(id), data, 0600)
+}
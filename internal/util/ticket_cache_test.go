@@ -0,0 +1,143 @@
+package util
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录 LoadTicket 次数, 可以模拟读取失败的 TicketStore.
+type testTicketStore struct {
+	*FileTicketStore
+
+	mutex sync.Mutex
+	loads int
+	fail  bool
+}
+
+func (store *testTicketStore) LoadTicket(id string) (*Ticket, error) {
+	store.mutex.Lock()
+	store.loads++
+	fail := store.fail
+	store.mutex.Unlock()
+
+	if fail {
+		return nil, errors.New("test load error")
+	}
+	return store.FileTicketStore.LoadTicket(id)
+}
+
+func newTestTicketStore(t *testing.T, dir string) *testTicketStore {
+	fileStore, err := NewFileTicketStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testTicketStore{FileTicketStore: fileStore}
+}
+
+func TestTicketCacheRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	cache := NewTicketCache(newTestTicketStore(t, dir), time.Minute, nil)
+	if _, err := cache.Get("wxcomponent"); err != ErrTicketNotFound {
+		t.Errorf("TestTicketCacheRestart failed, have: %v, want: %v\n", err, ErrTicketNotFound)
+	}
+	if _, _, err := cache.Status("wxcomponent"); err != ErrTicketNotFound {
+		t.Errorf("TestTicketCacheRestart failed, have: %v, want: %v\n", err, ErrTicketNotFound)
+	}
+	if err := cache.Set("wxcomponent", ""); err == nil {
+		t.Errorf("TestTicketCacheRestart failed, want empty ticket error\n")
+	}
+	if err := cache.Set("wxcomponent", "ticket@@@1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启之后用新的 cache 读取
+	store := newTestTicketStore(t, dir)
+	cache = NewTicketCache(store, time.Minute, nil)
+	ticket, stale, err := cache.Status("wxcomponent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Ticket != "ticket@@@1" || stale || time.Since(ticket.UpdatedAt) > time.Minute {
+		t.Errorf("TestTicketCacheRestart failed, have: %+v, stale: %t\n", ticket, stale)
+	}
+
+	// 之后从内存读取
+	for i := 0; i < 3; i++ {
+		if ticket, err = cache.Get("wxcomponent"); err != nil || ticket.Ticket != "ticket@@@1" {
+			t.Errorf("TestTicketCacheRestart failed, have: %+v, %v\n", ticket, err)
+		}
+	}
+	if store.loads != 1 {
+		t.Errorf("TestTicketCacheRestart failed, have loads: %d, want: 1\n", store.loads)
+	}
+
+	// 不同的 id 互不影响
+	if _, err = cache.Get("wxother"); err != ErrTicketNotFound {
+		t.Errorf("TestTicketCacheRestart failed, have: %v, want: %v\n", err, ErrTicketNotFound)
+	}
+}
+
+func TestTicketCacheStale(t *testing.T) {
+	store := newTestTicketStore(t, t.TempDir())
+	updatedAt := time.Now().Add(-time.Hour)
+	if err := store.SaveTicket("wxcomponent", &Ticket{Ticket: "ticket@@@old", UpdatedAt: updatedAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	var staleId string
+	var staleTicket *Ticket
+	cache := NewTicketCache(store, time.Minute*30, func(id string, ticket *Ticket) {
+		staleId, staleTicket = id, ticket
+	})
+
+	// 过时的 ticket 仍然返回, 同时通知 onStale
+	ticket, err := cache.Get("wxcomponent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Ticket != "ticket@@@old" || staleId != "wxcomponent" || staleTicket == nil || !staleTicket.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("TestTicketCacheStale failed, have: %+v, onStale: %s, %+v\n", ticket, staleId, staleTicket)
+	}
+
+	// 过时的 ticket 每次都重新读取, 其他副本推送的新 ticket 可以读到
+	otherCache := NewTicketCache(newTestTicketStore(t, store.dir), time.Minute*30, nil)
+	if err = otherCache.Set("wxcomponent", "ticket@@@new"); err != nil {
+		t.Fatal(err)
+	}
+	staleId, staleTicket = "", nil
+	if ticket, err = cache.Get("wxcomponent"); err != nil || ticket.Ticket != "ticket@@@new" {
+		t.Errorf("TestTicketCacheStale failed, have: %+v, %v, want: %s\n", ticket, err, "ticket@@@new")
+	}
+	if staleTicket != nil {
+		t.Errorf("TestTicketCacheStale failed, onStale called for a fresh ticket\n")
+	}
+	if _, stale, err := cache.Status("wxcomponent"); err != nil || stale {
+		t.Errorf("TestTicketCacheStale failed, have stale: %t, err: %v, want: false\n", stale, err)
+	}
+}
+
+func TestTicketCacheLoadError(t *testing.T) {
+	store := newTestTicketStore(t, t.TempDir())
+	if err := store.SaveTicket("wxcomponent", &Ticket{Ticket: "ticket@@@old", UpdatedAt: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewTicketCache(store, time.Minute*30, nil)
+	if _, err := cache.Get("wxcomponent"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取失败时继续使用内存里过时的 ticket
+	store.fail = true
+	ticket, stale, err := cache.Status("wxcomponent")
+	if err != nil || ticket.Ticket != "ticket@@@old" || !stale {
+		t.Errorf("TestTicketCacheLoadError failed, have: %+v, %t, %v\n", ticket, stale, err)
+	}
+
+	// 内存里没有则返回错误
+	if _, err = cache.Get("wxother"); err == nil || err == ErrTicketNotFound {
+		t.Errorf("TestTicketCacheLoadError failed, have: %v, want load error\n", err)
+	}
+}
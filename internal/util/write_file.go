@@ -0,0 +1,37 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// 原子地写文件: 先写到同一目录下的临时文件, 再 rename, 避免进程崩溃时留下写了一半的文件.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	file, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return
+	}
+	tmpName := file.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	if err = os.Chmod(tmpName, perm); err != nil {
+		return
+	}
+	return os.Rename(tmpName, filename)
+}
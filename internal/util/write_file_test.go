@@ -0,0 +1,78 @@
+package util
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "ticket.json")
+
+	for _, data := range [][]byte{[]byte(`{"ticket":"old"}`), []byte(`{"ticket":"new"}`)} {
+		if err := WriteFileAtomic(filename, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		have, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, data) {
+			t.Errorf("TestWriteFileAtomic failed, have: %s, want: %s\n", have, data)
+		}
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("TestWriteFileAtomic failed, have perm: %o, want: %o\n", perm, 0600)
+	}
+
+	// 不留下临时文件
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("TestWriteFileAtomic failed, have %d files, want: 1\n", len(entries))
+	}
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "ticket.json")
+	if err := WriteFileAtomic(filename, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目标是一个目录时 rename 失败, 原来的文件和目录都不受影响, 临时文件被删除
+	target := filepath.Join(dir, "subdir")
+	if err := os.Mkdir(target, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "file"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(target, []byte("new"), 0600); err == nil {
+		t.Errorf("TestWriteFileAtomicError failed, want error\n")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("TestWriteFileAtomicError failed, have %d files, want: 2\n", len(entries))
+	}
+
+	// 目录不存在
+	if err := WriteFileAtomic(filepath.Join(dir, "notexist", "ticket.json"), []byte("new"), 0600); err == nil {
+		t.Errorf("TestWriteFileAtomicError failed, want error\n")
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "old" {
+		t.Errorf("TestWriteFileAtomicError failed, have: %s, want: %s\n", data, "old")
+	}
+}
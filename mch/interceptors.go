@@ -0,0 +1,120 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mch
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+var (
+	ErrRequestBodyTooLarge = errors.New("request body too large")
+	ErrTooManyRequests     = errors.New("too many requests")
+)
+
+var _ Interceptor = InterceptorChain(nil)
+
+// 拦截器链, 按顺序调用每一个 Interceptor, 有一个返回 false 则请求到此为止; nil 的 Interceptor 被忽略.
+//  例如:
+//  interceptor := mch.InterceptorChain{
+//      mch.NewMaxBodySizeInterceptor(64<<10, errHandler),
+//      mch.NewRequestCheckInterceptor(errHandler),
+//      rateLimitInterceptor,
+//  }
+//  frontend := mch.NewServerFrontend(server, errHandler, interceptor)
+type InterceptorChain []Interceptor
+
+func (chain InterceptorChain) Intercept(w http.ResponseWriter, r *http.Request, queryValues url.Values) (shouldContinue bool) {
+	for _, interceptor := range chain {
+		if interceptor != nil && !interceptor.Intercept(w, r, queryValues) {
+			return false
+		}
+	}
+	return true
+}
+
+// 限制请求 body 大小的拦截器.
+//  Content-Length 超过 maxBytes 直接拒绝; 否则 r.Body 被替换为至多读取 maxBytes 字节的 Reader,
+//  后续读取超过 maxBytes 时返回错误.
+//  errHandler 可以为 nil, 拒绝时的错误为 ErrRequestBodyTooLarge.
+func NewMaxBodySizeInterceptor(maxBytes int64, errHandler ErrorHandler) Interceptor {
+	if maxBytes <= 0 {
+		panic("maxBytes must be positive")
+	}
+	if errHandler == nil {
+		errHandler = DefaultErrorHandler
+	}
+
+	return InterceptorFunc(func(w http.ResponseWriter, r *http.Request, queryValues url.Values) (shouldContinue bool) {
+		if r.ContentLength > maxBytes {
+			errHandler.ServeError(w, r, ErrRequestBodyTooLarge)
+			return false
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		return true
+	})
+}
+
+// 按来源 IP 限流的拦截器, 每个 IP 每秒允许 rate 个请求, 最多允许 burst 个突发请求.
+//  trustedProxies 为受信任的反向代理的 IP 地址列表(IP 或者 CIDR), 如果请求来自这些地址,
+//  则根据 X-Forwarded-For 判断来源 IP, 可以为 nil.
+//  errHandler 可以为 nil, 拒绝时的错误为 ErrTooManyRequests.
+func NewRateLimitInterceptor(rate float64, burst int, trustedProxies []string, errHandler ErrorHandler) (interceptor Interceptor, err error) {
+	var trustedProxySet *util.IPSet
+	if trustedProxies != nil {
+		if trustedProxySet, err = util.ParseIPSet(trustedProxies); err != nil {
+			return
+		}
+	}
+	if errHandler == nil {
+		errHandler = DefaultErrorHandler
+	}
+	limiter := util.NewRateLimiter(rate, burst)
+
+	interceptor = InterceptorFunc(func(w http.ResponseWriter, r *http.Request, queryValues url.Values) (shouldContinue bool) {
+		var key string
+		if ip := util.RemoteIP(r, trustedProxySet); ip != nil {
+			key = ip.String()
+		} else {
+			key = r.RemoteAddr
+		}
+		if !limiter.Allow(key) {
+			errHandler.ServeError(w, r, ErrTooManyRequests)
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// 在校验签名之前拒绝格式不对的请求的拦截器: 只允许 POST 方法, 并且 body 不能为空.
+//  errHandler 可以为 nil.
+func NewRequestCheckInterceptor(errHandler ErrorHandler) Interceptor {
+	if errHandler == nil {
+		errHandler = DefaultErrorHandler
+	}
+
+	return InterceptorFunc(func(w http.ResponseWriter, r *http.Request, queryValues url.Values) (shouldContinue bool) {
+		if err := checkRequest(r, queryValues); err != nil {
+			errHandler.ServeError(w, r, err)
+			return false
+		}
+		return true
+	})
+}
+
+func checkRequest(r *http.Request, queryValues url.Values) (err error) {
+	if r.Method != "POST" {
+		return errors.New("Not expect Request.Method: " + r.Method)
+	}
+	if r.ContentLength == 0 {
+		return errors.New("request body is empty")
+	}
+	return
+}
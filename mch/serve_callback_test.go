@@ -0,0 +1,62 @@
+package mch
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+)
+
+func testMchNotifyBody(params map[string]string) []byte {
+	params["sign"] = Sign(params, "apikey", nil)
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("<xml>")
+	for _, key := range keys {
+		buf.WriteString("<" + key + ">" + params[key] + "</" + key + ">")
+	}
+	buf.WriteString("</xml>")
+	return buf.Bytes()
+}
+
+func TestServeCallback(t *testing.T) {
+	handler := MessageHandlerFunc(func(w http.ResponseWriter, r *Request) {
+		io.WriteString(w, "reply:"+r.Msg["out_trade_no"])
+	})
+	srv := NewDefaultServer("wx1234567890", "10000100", "apikey", handler)
+
+	body := testMchNotifyBody(map[string]string{
+		"return_code":  ReturnCodeSuccess,
+		"appid":        "wx1234567890",
+		"mch_id":       "10000100",
+		"out_trade_no": "1217752501201407033233368018",
+	})
+	reply, statusCode, err := ServeCallback("POST", url.Values{}, body, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "reply:1217752501201407033233368018" || statusCode != http.StatusOK {
+		t.Errorf("TestServeCallback failed, have: %s, %d\n", reply, statusCode)
+	}
+
+	// 签名错误
+	badBody := bytes.Replace(body, []byte("1217752501201407033233368018"), []byte("1217752501201407033233368019"), 1)
+	if reply, statusCode, err = ServeCallback("POST", url.Values{}, badBody, srv); err == nil || reply != nil || statusCode != http.StatusBadRequest {
+		t.Errorf("TestServeCallback failed, have: %s, %d, %v, want signature error\n", reply, statusCode, err)
+	}
+
+	for _, method := range []string{"GET", "PUT", ""} {
+		reply, statusCode, err = ServeCallback(method, url.Values{}, body, srv)
+		if err == nil || reply != nil || statusCode != http.StatusBadRequest {
+			t.Errorf("TestServeCallback failed, method: %q, have: %s, %d, %v, want error\n", method, reply, statusCode, err)
+		}
+	}
+}
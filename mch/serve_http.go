@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -19,9 +20,16 @@ import (
 )
 
 func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, srv Server, errHandler ErrorHandler) {
-	switch r.Method {
+	serve(w, r, r.Method, r.Body, queryValues, srv, errHandler)
+}
+
+// ServeHTTP 的实现, r 可以为 nil, 见 ServeCallback.
+func serve(w http.ResponseWriter, r *http.Request, method string, body io.Reader,
+	queryValues url.Values, srv Server, errHandler ErrorHandler) {
+
+	switch method {
 	case "POST":
-		RawMsgXML, err := ioutil.ReadAll(r.Body)
+		RawMsgXML, err := ioutil.ReadAll(body)
 		if err != nil {
 			errHandler.ServeError(w, r, err)
 			return
@@ -75,6 +83,6 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 		srv.MessageHandler().ServeMessage(w, req)
 
 	default:
-		errHandler.ServeError(w, r, errors.New("Not expect Request.Method: "+r.Method))
+		errHandler.ServeError(w, r, errors.New("Not expect Request.Method: "+method))
 	}
 }
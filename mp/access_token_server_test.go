@@ -0,0 +1,146 @@
+package mp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 把 /cgi-bin/token 的请求交给 fn 处理, 不访问微信服务器.
+type testTokenTransport struct {
+	calls int32
+	fn    func(n int32) string // n 从 1 开始, 返回 json
+}
+
+func (tr *testTokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Path != "/cgi-bin/token" {
+		return nil, io.ErrUnexpectedEOF
+	}
+	body := tr.fn(atomic.AddInt32(&tr.calls, 1))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func newTestAccessTokenServer(fn func(n int32) string) (*DefaultAccessTokenServer, *testTokenTransport) {
+	tr := &testTokenTransport{fn: fn}
+	return NewDefaultAccessTokenServer("appid", "appsecret", &http.Client{Transport: tr}), tr
+}
+
+func TestAccessTokenServerRefreshEvent(t *testing.T) {
+	srv, _ := newTestAccessTokenServer(func(int32) string {
+		return `{"access_token":"token1","expires_in":7200}`
+	})
+	defer srv.Close()
+
+	events := make(chan *RefreshEvent, 1)
+	srv.Subscribe(func(event *RefreshEvent) { events <- event })
+
+	token, err := srv.TokenRefresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token1" {
+		t.Errorf("TestAccessTokenServerRefreshEvent failed, have: %s, want: %s\n", token, "token1")
+	}
+	select {
+	case event := <-events:
+		// 过期时间留了 10 分钟的缓冲区
+		if event.Err != nil || event.ExpiresIn != 7200-600 {
+			t.Errorf("TestAccessTokenServerRefreshEvent failed, have: %+v\n", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("TestAccessTokenServerRefreshEvent failed, event not delivered\n")
+	}
+	if status := srv.Status(); status.RefreshCount != 1 || status.ErrorCount != 0 || status.LastError != "" {
+		t.Errorf("TestAccessTokenServerRefreshEvent failed, have status: %+v\n", status)
+	}
+
+	// 收敛周期内不再请求微信服务器, 也不通知
+	if token, err = srv.TokenRefresh(); err != nil || token != "token1" {
+		t.Errorf("TestAccessTokenServerRefreshEvent failed, have: %s, %v\n", token, err)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("TestAccessTokenServerRefreshEvent failed, cached refresh notified: %+v\n", event)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestAccessTokenServerRefreshEventError(t *testing.T) {
+	srv, _ := newTestAccessTokenServer(func(int32) string {
+		return `{"errcode":40001,"errmsg":"invalid credential"}`
+	})
+	defer srv.Close()
+
+	events := make(chan *RefreshEvent, 1)
+	srv.Subscribe(func(event *RefreshEvent) { events <- event })
+
+	if _, err := srv.TokenRefresh(); err == nil {
+		t.Fatalf("TestAccessTokenServerRefreshEventError failed, want error\n")
+	}
+	select {
+	case event := <-events:
+		if e, ok := event.Err.(*Error); !ok || e.ErrCode != 40001 {
+			t.Errorf("TestAccessTokenServerRefreshEventError failed, have: %+v\n", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("TestAccessTokenServerRefreshEventError failed, event not delivered\n")
+	}
+	if status := srv.Status(); status.ErrorCount != 1 || status.RefreshCount != 0 || status.LastError == "" {
+		t.Errorf("TestAccessTokenServerRefreshEventError failed, have status: %+v\n", status)
+	}
+}
+
+// 订阅者在后台刷新失败时调用 TokenRefresh 不会让后台 goroutine 死锁.
+func TestAccessTokenServerSubscriberTokenRefresh(t *testing.T) {
+	srv, tr := newTestAccessTokenServer(func(n int32) string {
+		if n == 1 {
+			return `{"errcode":-1,"errmsg":"system error"}`
+		}
+		return `{"access_token":"token2","expires_in":7200}`
+	})
+
+	var once sync.Once
+	refreshed := make(chan error, 1)
+	srv.Subscribe(func(event *RefreshEvent) {
+		if event.Err == nil {
+			return
+		}
+		once.Do(func() {
+			_, err := srv.TokenRefresh()
+			refreshed <- err
+		})
+	})
+
+	srv.tokenDaemon.Reset(time.Millisecond) // 让后台 goroutine 马上刷新
+	select {
+	case err := <-refreshed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("TestAccessTokenServerSubscriberTokenRefresh failed, TokenRefresh in subscriber blocked\n")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if err := srv.Stop(ctx); err != nil {
+		t.Fatalf("TestAccessTokenServerSubscriberTokenRefresh failed, Stop: %v\n", err)
+	}
+	if token, err := srv.Token(); err != nil || token != "token2" {
+		t.Errorf("TestAccessTokenServerSubscriberTokenRefresh failed, have: %s, %v, want: %s\n", token, err, "token2")
+	}
+	if n := atomic.LoadInt32(&tr.calls); n != 2 {
+		t.Errorf("TestAccessTokenServerSubscriberTokenRefresh failed, have calls: %d, want: 2\n", n)
+	}
+}
@@ -0,0 +1,216 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mp
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+// UpdateAESKey 时原来的 Key 默认的有效时间, 微信服务器切换到新的 Key 之前推送的消息仍然可以解密.
+const DefaultLastAESKeyTTL = time.Hour * 24
+
+// 带有效期的 AES 加密 Key.
+type AESKey struct {
+	Id          string    // Key 的标识, 比如版本号, 用于日志和排查问题, 可以为空
+	Key         [32]byte  // AES 加密 Key
+	ActivatedAt time.Time // 开始生效的时间, 零值表示立即生效
+	ExpiresAt   time.Time // 过期的时间, 零值表示永不过期
+}
+
+// 判断 Key 在 t 时刻是否有效.
+func (key *AESKey) IsValidAt(t time.Time) bool {
+	if !key.ActivatedAt.IsZero() && t.Before(key.ActivatedAt) {
+		return false
+	}
+	if !key.ExpiresAt.IsZero() && !t.Before(key.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// AES 加密 Key 的外部配置源, 比如配置中心, 数据库等.
+type AESKeySource interface {
+	// 获取最新的 AES 加密 Key 列表, 新的 Key 排在前面.
+	AESKeys() ([]AESKey, error)
+}
+
+type AESKeySourceFunc func() ([]AESKey, error)
+
+func (fn AESKeySourceFunc) AESKeys() ([]AESKey, error) {
+	return fn()
+}
+
+// 提供 AESKeyRing 的 Server, DefaultServer, component.DefaultServer 都实现了该接口.
+//  如果 Server 实现了该接口, ServeHTTP 按顺序用 AESKeyRing 里当前有效的 Key 解密消息,
+//  否则依次尝试 CurrentAESKey 和 LastAESKey.
+type AESKeyRingServer interface {
+	AESKeyRing() *AESKeyRing
+}
+
+// AES 加密 Key 的集合, 解密时按顺序尝试当前有效的 Key, 所以新的 Key 应该排在前面.
+//  AESKeyRing 并发安全, 可以在运行中更新.
+type AESKeyRing struct {
+	rwmutex sync.RWMutex
+	keys    []AESKey
+}
+
+// 创建一个新的 AESKeyRing, keys 按解密时尝试的顺序排列.
+func NewAESKeyRing(keys ...AESKey) *AESKeyRing {
+	ring := &AESKeyRing{}
+	ring.SetKeys(keys...)
+	return ring
+}
+
+// 返回所有的 Key(包括已经过期和还没有生效的).
+func (ring *AESKeyRing) Keys() []AESKey {
+	ring.rwmutex.RLock()
+	keys := make([]AESKey, len(ring.keys))
+	copy(keys, ring.keys)
+	ring.rwmutex.RUnlock()
+	return keys
+}
+
+// 替换所有的 Key, keys 按解密时尝试的顺序排列.
+func (ring *AESKeyRing) SetKeys(keys ...AESKey) {
+	newKeys := make([]AESKey, len(keys))
+	copy(newKeys, keys)
+
+	ring.rwmutex.Lock()
+	ring.keys = newKeys
+	ring.rwmutex.Unlock()
+}
+
+// 添加一个新的 Key, 排在最前面, 原来的 Key 保留各自的生效和过期时间, 已经过期的 Key 被移除.
+//  othersTTL > 0 时, 原来的 Key 最晚在 othersTTL 之后过期(已经设置了更早的过期时间则不变);
+//  othersTTL <= 0 时, 原来的 Key 的过期时间不变.
+//  如果当前有效的第一个 Key 就是 key.Key, 则什么都不做并返回 false.
+func (ring *AESKeyRing) AddKey(key AESKey, othersTTL time.Duration) (added bool) {
+	timeNow := time.Now()
+
+	ring.rwmutex.Lock()
+	defer ring.rwmutex.Unlock()
+
+	for i := range ring.keys {
+		if ring.keys[i].IsValidAt(timeNow) {
+			if ring.keys[i].Key == key.Key {
+				return false
+			}
+			break
+		}
+	}
+
+	newKeys := make([]AESKey, 1, len(ring.keys)+1)
+	newKeys[0] = key
+	for _, oldKey := range ring.keys {
+		if oldKey.Key == key.Key {
+			continue
+		}
+		if !oldKey.ExpiresAt.IsZero() && !timeNow.Before(oldKey.ExpiresAt) {
+			continue
+		}
+		if othersTTL > 0 {
+			if expiresAt := timeNow.Add(othersTTL); oldKey.ExpiresAt.IsZero() || oldKey.ExpiresAt.After(expiresAt) {
+				oldKey.ExpiresAt = expiresAt
+			}
+		}
+		newKeys = append(newKeys, oldKey)
+	}
+	ring.keys = newKeys
+	return true
+}
+
+// 从外部配置源获取最新的 Key 列表, 替换所有的 Key.
+//  获取失败或者获取的列表为空则保持原来的 Key 不变.
+func (ring *AESKeyRing) Refresh(source AESKeySource) (err error) {
+	keys, err := source.AESKeys()
+	if err != nil {
+		return
+	}
+	if len(keys) == 0 {
+		return errors.New("empty AESKey list")
+	}
+	ring.SetKeys(keys...)
+	return
+}
+
+// 返回 t 时刻有效的 Key, 按解密时尝试的顺序排列.
+func (ring *AESKeyRing) ValidKeys(t time.Time) (keys []AESKey) {
+	ring.rwmutex.RLock()
+	for i := range ring.keys {
+		if ring.keys[i].IsValidAt(t) {
+			keys = append(keys, ring.keys[i])
+		}
+	}
+	ring.rwmutex.RUnlock()
+	return
+}
+
+// 返回当前有效的第一个 Key.
+func (ring *AESKeyRing) CurrentKey() (key AESKey, ok bool) {
+	timeNow := time.Now()
+
+	ring.rwmutex.RLock()
+	defer ring.rwmutex.RUnlock()
+
+	for i := range ring.keys {
+		if ring.keys[i].IsValidAt(timeNow) {
+			return ring.keys[i], true
+		}
+	}
+	return
+}
+
+// 按顺序用当前有效的 Key 解密消息, 返回解密成功的 Key.
+//  ciphertext = AES_Encrypt[random(16B) + msg_len(4B) + rawXMLMsg + appId]
+func (ring *AESKeyRing) Decrypt(ciphertext []byte) (random, rawXMLMsg, appId []byte, key AESKey, err error) {
+	keys := ring.ValidKeys(time.Now())
+	if len(keys) == 0 {
+		err = errors.New("no valid AESKey")
+		return
+	}
+	for _, key = range keys {
+		if random, rawXMLMsg, appId, err = util.AESDecryptMsg(ciphertext, key.Key); err == nil {
+			return
+		}
+	}
+	key = AESKey{}
+	return
+}
+
+// 提供 AES 加密 Key 的 Server, Server, component.Server 都实现了该接口.
+type AESKeyServer interface {
+	CurrentAESKey() [32]byte                // 获取当前的 AES 加密 Key
+	LastAESKey() (key [32]byte, valid bool) // 获取上一个 AES 加密 Key
+}
+
+// 用 srv 的 AES 加密 Key 解密消息, 返回解密成功的 Key, 见 AESKeyRingServer.
+func AESDecryptMsg(srv AESKeyServer, ciphertext []byte) (random, rawXMLMsg, appId []byte, key AESKey, err error) {
+	if ringServer, ok := srv.(AESKeyRingServer); ok {
+		return ringServer.AESKeyRing().Decrypt(ciphertext)
+	}
+
+	key.Key = srv.CurrentAESKey()
+	random, rawXMLMsg, appId, err = util.AESDecryptMsg(ciphertext, key.Key)
+	if err == nil {
+		return
+	}
+
+	// 尝试用上一次的 AESKey 来解密
+	lastAESKey, isLastAESKeyValid := srv.LastAESKey()
+	if !isLastAESKeyValid {
+		key = AESKey{}
+		return
+	}
+	key.Key = lastAESKey
+	if random, rawXMLMsg, appId, err = util.AESDecryptMsg(ciphertext, key.Key); err != nil {
+		key = AESKey{}
+	}
+	return
+}
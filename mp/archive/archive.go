@@ -0,0 +1,119 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package archive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 归档的一条回调消息, 对应 JSON Lines 文件里的一行.
+type Record struct {
+	Time        time.Time `json:"time"`                   // 收到消息的时间
+	ToUserName  string    `json:"to_user_name"`           // 公众号的原始ID
+	AppId       string    `json:"app_id,omitempty"`       // 安全模式下消息的 AppId
+	Timestamp   int64     `json:"timestamp"`              // 回调请求 URL 中的时间戳
+	Nonce       string    `json:"nonce"`                  // 回调请求 URL 中的随机数
+	EncryptType string    `json:"encrypt_type,omitempty"` // 回调请求 URL 中的加密方式
+	MsgType     string    `json:"msg_type"`
+	Event       string    `json:"event,omitempty"`
+	RawMsgXML   string    `json:"raw_msg_xml"`     // 消息的 XML 文本, 对于安全模式是解密后的消息
+	Reply       string    `json:"reply,omitempty"` // 回复的 XML 文本, 对于安全模式是解密后的回复
+}
+
+// Record 的存储接口, FileWriter 实现了该接口.
+type RecordWriter interface {
+	WriteRecord(*Record) error
+}
+
+// 归档消息的 MessageHandler, 把每条消息和 handler 的回复写入 recordWriter, 然后返回 handler 的回复.
+//  写入失败不影响消息的处理, 只记录日志.
+//  NOTE: 归档文件包含解密后的消息, 请注意保护.
+func NewMessageHandler(handler mp.MessageHandler, recordWriter RecordWriter) mp.MessageHandler {
+	if handler == nil {
+		panic("nil MessageHandler")
+	}
+	if recordWriter == nil {
+		panic("nil RecordWriter")
+	}
+
+	return mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {
+		timeNow := time.Now()
+
+		rw := &replyRecorder{ResponseWriter: w}
+		handler.ServeMessage(rw, r)
+
+		record := newRecord(r, timeNow)
+		if rw.buf.Len() > 0 {
+			if reply, err := plainReply(r, rw.buf.Bytes()); err != nil {
+				mp.LogInfoln("[WECHAT] archive decrypt reply failed:", err)
+				record.Reply = rw.buf.String()
+			} else {
+				record.Reply = string(reply)
+			}
+		}
+		if err := recordWriter.WriteRecord(record); err != nil {
+			mp.LogInfoln("[WECHAT] archive write record failed:", err)
+		}
+	})
+}
+
+func newRecord(r *mp.Request, timeNow time.Time) *Record {
+	record := &Record{
+		Time:        timeNow,
+		AppId:       r.AppId,
+		Timestamp:   r.Timestamp,
+		Nonce:       r.Nonce,
+		EncryptType: r.EncryptType,
+		RawMsgXML:   string(r.RawMsgXML),
+	}
+	if r.MixedMsg != nil {
+		record.ToUserName = r.MixedMsg.ToUserName
+		record.MsgType = r.MixedMsg.MsgType
+		record.Event = r.MixedMsg.Event
+	}
+	return record
+}
+
+// 记录 MessageHandler 的回复.
+type replyRecorder struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (rw *replyRecorder) Write(p []byte) (int, error) {
+	rw.buf.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
+
+// 获取回复的明文, 安全模式下用 r.AESKey 解密.
+func plainReply(r *mp.Request, reply []byte) (rawReplyXML []byte, err error) {
+	if r.EncryptType != "aes" {
+		return reply, nil
+	}
+
+	var responseHttpBody mp.ResponseHttpBody
+	if err = xml.Unmarshal(reply, &responseHttpBody); err != nil {
+		return
+	}
+	if responseHttpBody.EncryptedMsg == "" {
+		err = errors.New("empty Encrypt in reply")
+		return
+	}
+	encryptedMsg, err := base64.StdEncoding.DecodeString(responseHttpBody.EncryptedMsg)
+	if err != nil {
+		return
+	}
+	_, rawReplyXML, _, err = util.AESDecryptMsg(encryptedMsg, r.AESKey)
+	return
+}
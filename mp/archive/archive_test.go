@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+type testReply struct {
+	XMLName struct{} `xml:"xml"`
+	mp.MessageHeader
+	Content string `xml:"Content"`
+}
+
+// 原样回复文本消息, 回复只和消息有关, 重放的结果和归档的一样.
+var testEchoHandler = mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {
+	if r.MixedMsg.MsgType != "text" {
+		return
+	}
+	mp.WriteResponse(w, r, &testReply{
+		MessageHeader: mp.MessageHeader{
+			ToUserName:   r.MixedMsg.FromUserName,
+			FromUserName: r.MixedMsg.ToUserName,
+			CreateTime:   r.MixedMsg.CreateTime,
+			MsgType:      "text",
+		},
+		Content: "echo:" + r.MixedMsg.Content,
+	})
+})
+
+func newTestArchiveRequest(encryptType, msgType, content string) *mp.Request {
+	rawMsgXML := "<xml><ToUserName>gh_123456789abc</ToUserName><FromUserName>user</FromUserName><CreateTime>1460000000</CreateTime>" +
+		"<MsgType>" + msgType + "</MsgType><Content>" + content + "</Content></xml>"
+	r := &mp.Request{
+		Token:       "token",
+		Timestamp:   1460000000,
+		Nonce:       "nonce",
+		EncryptType: encryptType,
+		RawMsgXML:   []byte(rawMsgXML),
+		MixedMsg: &mp.MixedMessage{
+			MessageHeader: mp.MessageHeader{
+				ToUserName:   "gh_123456789abc",
+				FromUserName: "user",
+				CreateTime:   1460000000,
+				MsgType:      msgType,
+			},
+			Content: content,
+		},
+	}
+	if encryptType == "aes" {
+		copy(r.AESKey[:], "0123456789abcdef0123456789abcdef")
+		r.Random = []byte("0123456789abcdef")
+		r.AppId = "wx1234567890"
+	}
+	return r
+}
+
+// 归档, 写入文件, 读取并重放, 重放的回复和归档的回复一致.
+func TestArchiveReplayRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fileWriter, err := NewFileWriter(dir, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewMessageHandler(testEchoHandler, fileWriter)
+
+	requests := []*mp.Request{
+		newTestArchiveRequest("", "text", "hello"),
+		newTestArchiveRequest("aes", "text", "secret"),
+		newTestArchiveRequest("raw", "image", ""),
+	}
+	for _, r := range requests {
+		handler.ServeMessage(httptest.NewRecorder(), r)
+	}
+	if err = fileWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "test-*.jsonl"))
+	if len(names) != 1 {
+		t.Fatalf("TestArchiveReplayRoundTrip failed, have files: %v, want: 1\n", names)
+	}
+
+	wantReplies := []string{
+		`<xml><ToUserName>user</ToUserName><FromUserName>gh_123456789abc</FromUserName><CreateTime>1460000000</CreateTime><MsgType>text</MsgType><Content>echo:hello</Content></xml>`,
+		`<xml><ToUserName>user</ToUserName><FromUserName>gh_123456789abc</FromUserName><CreateTime>1460000000</CreateTime><MsgType>text</MsgType><Content>echo:secret</Content></xml>`,
+		``,
+	}
+	var i int
+	err = ReplayFile(names[0], testEchoHandler, func(record *Record, reply []byte, err error) error {
+		if err != nil {
+			return err
+		}
+		r := requests[i]
+		if record.RawMsgXML != string(r.RawMsgXML) || record.EncryptType != r.EncryptType || record.AppId != r.AppId ||
+			record.ToUserName != "gh_123456789abc" || record.MsgType != r.MixedMsg.MsgType {
+			t.Errorf("TestArchiveReplayRoundTrip failed, record %d: %+v\n", i, record)
+		}
+		// 安全模式归档的也是明文
+		if record.Reply != wantReplies[i] {
+			t.Errorf("TestArchiveReplayRoundTrip failed, record %d reply: %s, want: %s\n", i, record.Reply, wantReplies[i])
+		}
+		if string(reply) != record.Reply {
+			t.Errorf("TestArchiveReplayRoundTrip failed, record %d replay: %s, want: %s\n", i, reply, record.Reply)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(requests) {
+		t.Errorf("TestArchiveReplayRoundTrip failed, replayed %d records, want: %d\n", i, len(requests))
+	}
+}
@@ -0,0 +1,142 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/json"
+)
+
+var _ RecordWriter = (*FileWriter)(nil)
+
+// 把 Record 以 JSON Lines 格式追加到文件的 RecordWriter, 文件超过 maxSize 或者跨天时切换到新文件.
+//  文件名为 dir/prefix-20060102-150405.000000000.jsonl, 精确到纳秒, 按文件名排序就是写入的顺序;
+//  每次切换都创建新的文件, 不会追加到已有的文件. FileWriter 并发安全.
+type FileWriter struct {
+	dir     string
+	prefix  string
+	maxSize int64
+
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64  // 当前文件的大小
+	fileDate string // 当前文件创建的日期, 20060102
+}
+
+// 创建一个新的 FileWriter.
+//  maxSize 为单个文件的最大字节数, <=0 则为 100MB.
+func NewFileWriter(dir, prefix string, maxSize int64) (w *FileWriter, err error) {
+	if dir == "" {
+		return nil, errors.New("empty dir")
+	}
+	if prefix == "" {
+		prefix = "wechat"
+	}
+	if maxSize <= 0 {
+		maxSize = 100 << 20
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	w = &FileWriter{
+		dir:     dir,
+		prefix:  prefix,
+		maxSize: maxSize,
+	}
+	return
+}
+
+func (w *FileWriter) WriteRecord(record *Record) (err error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	timeNow := time.Now()
+	if w.file == nil || w.size+int64(len(line)) > w.maxSize || w.fileDate != timeNow.Format("20060102") {
+		if err = w.rotate(timeNow); err != nil {
+			return
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	return
+}
+
+// 关闭当前文件.
+func (w *FileWriter) Close() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return
+	}
+	err = w.file.Close()
+	w.file = nil
+	return
+}
+
+func (w *FileWriter) rotate(timeNow time.Time) (err error) {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+
+	// 时钟精度不够时文件名可能重复, 此时把文件名里的时间往后推 1 纳秒, 保持按文件名排序的顺序
+	var file *os.File
+	for nameTime := timeNow; ; nameTime = nameTime.Add(time.Nanosecond) {
+		name := filepath.Join(w.dir, w.prefix+"-"+nameTime.Format("20060102-150405.000000000")+".jsonl")
+		if file, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return
+		}
+	}
+
+	w.file = file
+	w.size = 0
+	w.fileDate = timeNow.Format("20060102")
+	return
+}
+
+// 依次读取 JSON Lines 格式的归档文件里的 Record, 并调用 fn; fn 返回错误则停止读取并返回该错误.
+func ReadFile(name string, fn func(*Record) error) (err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record := new(Record)
+		if err = json.Unmarshal(line, record); err != nil {
+			return
+		}
+		if err = fn(record); err != nil {
+			return
+		}
+	}
+	return scanner.Err()
+}
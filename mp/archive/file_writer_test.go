@@ -0,0 +1,88 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileWriterRotate(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewFileWriter(dir, "test", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一秒内写满多个文件, 每个文件名都不一样
+	for i := 0; i < 20; i++ {
+		record := &Record{
+			Time:      time.Now(),
+			Nonce:     strconv.Itoa(i),
+			MsgType:   "text",
+			RawMsgXML: "<xml><Content>hello</Content></xml>",
+		}
+		if err = w.WriteRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "test-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) < 5 {
+		t.Fatalf("TestFileWriterRotate failed, have %d files, want rotation\n", len(names))
+	}
+	sort.Strings(names)
+
+	// 按文件名排序读取就是写入的顺序
+	var nonces []string
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("TestFileWriterRotate failed, file %s size: %d, want <= 300\n", name, info.Size())
+		}
+		if err = ReadFile(name, func(record *Record) error {
+			nonces = append(nonces, record.Nonce)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(nonces) != 20 {
+		t.Fatalf("TestFileWriterRotate failed, have %d records, want: 20\n", len(nonces))
+	}
+	for i, nonce := range nonces {
+		if nonce != strconv.Itoa(i) {
+			t.Fatalf("TestFileWriterRotate failed, record %d nonce: %s\n", i, nonce)
+		}
+	}
+}
+
+// 重新创建 FileWriter 不会追加到已有的文件.
+func TestFileWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		w, err := NewFileWriter(dir, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.WriteRecord(&Record{Nonce: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "wechat-*.jsonl"))
+	if len(names) != 2 {
+		t.Errorf("TestFileWriterReopen failed, have files: %v, want: 2\n", names)
+	}
+}
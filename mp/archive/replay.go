@@ -0,0 +1,59 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package archive
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"io"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 把归档的消息重新交给 handler 处理, 返回 handler 回复的明文(与 Record.Reply 的格式一致), 用于回归测试.
+//  安全模式的消息用随机生成的 AESKey 模拟, handler 可以照常调用 mp.WriteResponse 回复.
+//  NOTE: 传递给 handler 的 Request.HttpRequest, QueryValues 为 nil, Token 为空.
+func Replay(record *Record, handler mp.MessageHandler) (reply []byte, err error) {
+	var mixedMsg mp.MixedMessage
+	if err = xml.Unmarshal([]byte(record.RawMsgXML), &mixedMsg); err != nil {
+		return
+	}
+
+	r := &mp.Request{
+		Timestamp:   record.Timestamp,
+		Nonce:       record.Nonce,
+		EncryptType: record.EncryptType,
+		RawMsgXML:   []byte(record.RawMsgXML),
+		MixedMsg:    &mixedMsg,
+		AppId:       record.AppId,
+	}
+	if r.EncryptType == "aes" {
+		if _, err = io.ReadFull(rand.Reader, r.AESKey[:]); err != nil {
+			return
+		}
+		r.Random = make([]byte, 16)
+		if _, err = io.ReadFull(rand.Reader, r.Random); err != nil {
+			return
+		}
+	}
+
+	w := util.NewResponseBuffer()
+	handler.ServeMessage(w, r)
+	if w.Body.Len() == 0 {
+		return
+	}
+	return plainReply(r, w.Body.Bytes())
+}
+
+// 重放归档文件里的所有消息, 每条消息处理完后调用 fn, fn 返回错误则停止重放并返回该错误.
+//  比如比较 reply 和 record.Reply 来检查 handler 的行为是否改变.
+func ReplayFile(name string, handler mp.MessageHandler, fn func(record *Record, reply []byte, err error) error) error {
+	return ReadFile(name, func(record *Record) error {
+		reply, err := Replay(record, handler)
+		return fn(record, reply, err)
+	})
+}
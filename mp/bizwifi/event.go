@@ -14,6 +14,11 @@ const (
 	EventTypeWifiConnected = "WifiConnected" // Wi-Fi连网成功事件
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeWifiConnected, (*WifiConnectedEvent)(nil))
+}
+
 type WifiConnectedEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
 	mp.MessageHeader
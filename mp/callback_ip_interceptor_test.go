@@ -0,0 +1,72 @@
+package mp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCallbackIPGetter struct {
+	mutex  sync.Mutex
+	calls  int
+	ipList []string
+	err    error
+}
+
+func (getter *testCallbackIPGetter) GetCallbackIP() (ipList []string, err error) {
+	getter.mutex.Lock()
+	defer getter.mutex.Unlock()
+	getter.calls++
+	return getter.ipList, getter.err
+}
+
+func (getter *testCallbackIPGetter) Calls() int {
+	getter.mutex.Lock()
+	defer getter.mutex.Unlock()
+	return getter.calls
+}
+
+func testIntercept(itc *CallbackIPInterceptor, remoteAddr string) bool {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.RemoteAddr = remoteAddr
+	return itc.Intercept(httptest.NewRecorder(), r, r.URL.Query())
+}
+
+// 获取一直失败(比如启动时无法访问微信服务器)时使用静态列表, 并且不会每秒都重试.
+func TestCallbackIPInterceptorFailingFetch(t *testing.T) {
+	getter := &testCallbackIPGetter{err: errors.New("network is unreachable")}
+	errHandler := ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {})
+	itc, err := NewCallbackIPInterceptor(getter, []string{"101.226.62.77"}, nil, time.Hour, errHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itc.Close()
+
+	time.Sleep(time.Millisecond * 2500)
+	if n := getter.Calls(); n != 1 {
+		t.Errorf("TestCallbackIPInterceptorFailingFetch failed, have calls: %d, want: 1\n", n)
+	}
+	if !testIntercept(itc, "101.226.62.77:1234") {
+		t.Error("TestCallbackIPInterceptorFailingFetch failed, static ip denied\n")
+	}
+	if testIntercept(itc, "1.2.3.4:1234") {
+		t.Error("TestCallbackIPInterceptorFailingFetch failed, unknown ip allowed\n")
+	}
+
+	// 恢复之后使用获取的列表
+	getter.mutex.Lock()
+	getter.ipList, getter.err = []string{"1.2.3.4"}, nil
+	getter.mutex.Unlock()
+	if err = itc.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !testIntercept(itc, "1.2.3.4:1234") {
+		t.Error("TestCallbackIPInterceptorFailingFetch failed, fetched ip denied\n")
+	}
+	if testIntercept(itc, "101.226.62.77:1234") {
+		t.Error("TestCallbackIPInterceptorFailingFetch failed, static ip allowed after fetch\n")
+	}
+}
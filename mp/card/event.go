@@ -20,6 +20,17 @@ const (
 	EventTypeUserEnterSessionFromCard = "user_enter_session_from_card" // 从卡券进入公众号会话事件推送
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeCardPassCheck, (*CardPassCheckEvent)(nil))
+	mp.RegisterEventType(EventTypeCardNotPassCheck, (*CardNotPassCheckEvent)(nil))
+	mp.RegisterEventType(EventTypeUserGetCard, (*UserGetCardEvent)(nil))
+	mp.RegisterEventType(EventTypeUserDelCard, (*UserDelCardEvent)(nil))
+	mp.RegisterEventType(EventTypeUserConsumeCard, (*UserConsumeCardEvent)(nil))
+	mp.RegisterEventType(EventTypeUserViewCard, (*UserViewCardEvent)(nil))
+	mp.RegisterEventType(EventTypeUserEnterSessionFromCard, (*UserEnterSessionFromCardEvent)(nil))
+}
+
 // 卡券通过审核, 微信会把这个事件推送到开发者填写的URL
 type CardPassCheckEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
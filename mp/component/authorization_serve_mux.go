@@ -0,0 +1,161 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// component_verify_ticket 保存接口, VerifyTicketCache, VerifyTicketCache2, StoreVerifyTicketCache 都实现了该接口.
+type VerifyTicketSetter interface {
+	SetComponentVerifyTicket(appId string, ticket string) (err error)
+}
+
+// 删除 authorizer_refresh_token 的接口, RefreshTokenStorage 可以选择实现.
+type RefreshTokenDeleter interface {
+	DeleteRefreshToken(authorizerAppId string) (err error)
+}
+
+var _ MessageHandler = (*AuthorizationServeMux)(nil)
+
+// AuthorizationServeMux 按 InfoType 路由授权相关的通知, 同时也是一个 MessageHandler 的实现.
+//  先做字段里配置的自动处理, 再调用对应的 OnXxx 回调, 最后总是回复 success.
+//  NOTE:
+//  1. 字段需要在使用之前设置好, 之后不要再修改.
+//  2. 收到 unauthorized 时只会从 TokenPool 移除授权方; 单独的 AuthorizerAccessTokenServer, mp/manager 里的授权方等
+//     AuthorizationServeMux 不知道, 需要在 Revoke 里停止, 否则它们会一直用失效的 authorizer_refresh_token 刷新.
+type AuthorizationServeMux struct {
+	Client *Client // 调用 QueryAuth 用, AutoQueryAuth 为 true 时不能为 nil
+
+	// 收到 component_verify_ticket 时保存到 VerifyTicketSetter, 可以为 nil.
+	VerifyTicketSetter VerifyTicketSetter
+
+	// 收到 authorized, updateauthorized 时是否自动用通知里的 AuthorizationCode 调用 QueryAuth.
+	AutoQueryAuth bool
+
+	// QueryAuth 得到的 authorizer_refresh_token 保存到 RefreshTokenStorage, 可以为 nil;
+	// 收到 unauthorized 时, 如果 RefreshTokenStorage 实现了 RefreshTokenDeleter, 则删除授权方的 authorizer_refresh_token.
+	RefreshTokenStorage RefreshTokenStorage
+
+	// QueryAuth 之后把授权方添加到 TokenPool, 收到 unauthorized 时从 TokenPool 移除, 可以为 nil.
+	TokenPool *AuthorizerTokenPool
+
+	// 收到 unauthorized 时调用, 用于停止 TokenPool 之外管理该授权方的组件, 可以为 nil;
+	// 比如调用单独的 AuthorizerAccessTokenServer 的 Close, mp/manager 的 Manager.Evict.
+	Revoke func(authorizerAppId string) (err error)
+
+	// 回调, 都可以为 nil; err 为自动处理的错误, info 为 QueryAuth 的结果, 没有调用或者失败时为 nil.
+	OnVerifyTicket     func(r *Request, msg *VerifyTicketMessage, err error)
+	OnAuthorized       func(r *Request, msg *AuthorizedMessage, info *AuthorizationInfo, err error)
+	OnUpdateAuthorized func(r *Request, msg *UpdateAuthorizedMessage, info *AuthorizationInfo, err error)
+	OnUnauthorized     func(r *Request, msg *UnauthorizedMessage, err error)
+
+	// 其他 InfoType 的处理, 可以为 nil, 此时直接回复 success.
+	DefaultMessageHandler MessageHandler
+}
+
+// AuthorizationServeMux 实现了 MessageHandler 接口.
+func (mux *AuthorizationServeMux) ServeMessage(w http.ResponseWriter, r *Request) {
+	switch util.ToLower(r.MixedMsg.InfoType) {
+	case MsgTypeVerifyTicket:
+		msg := GetVerifyTicketMessage(r.MixedMsg)
+		var err error
+		if mux.VerifyTicketSetter != nil {
+			err = mux.VerifyTicketSetter.SetComponentVerifyTicket(msg.AppId, msg.VerifyTicket)
+		}
+		if mux.OnVerifyTicket != nil {
+			mux.OnVerifyTicket(r, msg, err)
+		} else if err != nil {
+			mp.LogInfoln("[WECHAT] save component_verify_ticket failed:", err)
+		}
+
+	case MsgTypeAuthorized:
+		msg := GetAuthorizedMessage(r.MixedMsg)
+		info, err := mux.queryAuth(msg.AuthorizationCode)
+		if mux.OnAuthorized != nil {
+			mux.OnAuthorized(r, msg, info, err)
+		} else if err != nil {
+			mp.LogInfoln("[WECHAT] handle authorized notification failed, authorizer_appid:", msg.AuthorizerAppId, "error:", err)
+		}
+
+	case MsgTypeUpdateAuthorized:
+		msg := GetUpdateAuthorizedMessage(r.MixedMsg)
+		info, err := mux.queryAuth(msg.AuthorizationCode)
+		if mux.OnUpdateAuthorized != nil {
+			mux.OnUpdateAuthorized(r, msg, info, err)
+		} else if err != nil {
+			mp.LogInfoln("[WECHAT] handle updateauthorized notification failed, authorizer_appid:", msg.AuthorizerAppId, "error:", err)
+		}
+
+	case MsgTypeUnauthorized:
+		msg := GetUnauthorizedMessage(r.MixedMsg)
+		err := mux.revoke(msg.AuthorizerAppId)
+		if mux.OnUnauthorized != nil {
+			mux.OnUnauthorized(r, msg, err)
+		} else if err != nil {
+			mp.LogInfoln("[WECHAT] handle unauthorized notification failed, authorizer_appid:", msg.AuthorizerAppId, "error:", err)
+		}
+
+	default:
+		if mux.DefaultMessageHandler != nil {
+			mux.DefaultMessageHandler.ServeMessage(w, r)
+			return
+		}
+	}
+	io.WriteString(w, "success")
+}
+
+// 用授权码换取授权信息, 并保存 authorizer_refresh_token; AutoQueryAuth 为 false 时什么都不做.
+func (mux *AuthorizationServeMux) queryAuth(authCode string) (info *AuthorizationInfo, err error) {
+	if !mux.AutoQueryAuth {
+		return
+	}
+	if mux.Client == nil {
+		err = errors.New("nil AuthorizationServeMux.Client")
+		return
+	}
+	if authCode == "" {
+		err = errors.New("empty AuthorizationCode")
+		return
+	}
+
+	if info, err = mux.Client.QueryAuth(authCode); err != nil {
+		return nil, err
+	}
+	if mux.RefreshTokenStorage != nil {
+		if err = mux.RefreshTokenStorage.SaveRefreshToken(info.AuthorizerAppId, info.RefreshToken); err != nil {
+			return
+		}
+	}
+	if mux.TokenPool != nil {
+		if err = mux.TokenPool.Add(info.AuthorizerAppId, info.RefreshToken); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 授权方取消授权, 移除 TokenPool 里的授权方, 调用 Revoke, 删除保存的 authorizer_refresh_token.
+//  某一步失败不影响后面的步骤, 返回第一个错误.
+func (mux *AuthorizationServeMux) revoke(authorizerAppId string) (err error) {
+	if mux.TokenPool != nil {
+		mux.TokenPool.Remove(authorizerAppId)
+	}
+	if mux.Revoke != nil {
+		err = mux.Revoke(authorizerAppId)
+	}
+	if deleter, ok := mux.RefreshTokenStorage.(RefreshTokenDeleter); ok {
+		if deleteErr := deleter.DeleteRefreshToken(authorizerAppId); err == nil {
+			err = deleteErr
+		}
+	}
+	return
+}
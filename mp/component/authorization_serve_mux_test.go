@@ -0,0 +1,147 @@
+package component
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorizationNotificationDecode(t *testing.T) {
+	var msg MixedMessage
+	verifyTicketXML := `<xml><AppId>wxcomponent</AppId><CreateTime>1413192605</CreateTime><InfoType>component_verify_ticket</InfoType><ComponentVerifyTicket>ticket@@@1</ComponentVerifyTicket></xml>`
+	if err := xml.Unmarshal([]byte(verifyTicketXML), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if have := GetVerifyTicketMessage(&msg); have.AppId != "wxcomponent" || have.CreateTime != 1413192605 || have.VerifyTicket != "ticket@@@1" {
+		t.Errorf("TestAuthorizationNotificationDecode failed, have: %+v\n", have)
+	}
+
+	msg = MixedMessage{}
+	authorizedXML := `<xml><AppId>wxcomponent</AppId><CreateTime>1413192760</CreateTime><InfoType>authorized</InfoType><AuthorizerAppid>wxauthorizer</AuthorizerAppid><AuthorizationCode>auth-code</AuthorizationCode><AuthorizationCodeExpiredTime>1413196360</AuthorizationCodeExpiredTime><PreAuthCode>pre-auth-code</PreAuthCode></xml>`
+	if err := xml.Unmarshal([]byte(authorizedXML), &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := AuthorizedMessage{
+		AppId:                        "wxcomponent",
+		CreateTime:                   1413192760,
+		InfoType:                     MsgTypeAuthorized,
+		AuthorizerAppId:              "wxauthorizer",
+		AuthorizationCode:            "auth-code",
+		AuthorizationCodeExpiredTime: 1413196360,
+		PreAuthCode:                  "pre-auth-code",
+	}
+	if have := GetAuthorizedMessage(&msg); *have != want {
+		t.Errorf("TestAuthorizationNotificationDecode failed, have: %+v, want: %+v\n", have, want)
+	}
+	msg.InfoType = MsgTypeUpdateAuthorized
+	want.InfoType = MsgTypeUpdateAuthorized
+	if have := GetUpdateAuthorizedMessage(&msg); AuthorizedMessage(*have) != want {
+		t.Errorf("TestAuthorizationNotificationDecode failed, have: %+v, want: %+v\n", have, want)
+	}
+
+	msg = MixedMessage{}
+	unauthorizedXML := `<xml><AppId>wxcomponent</AppId><CreateTime>1413192760</CreateTime><InfoType>unauthorized</InfoType><AuthorizerAppid>wxauthorizer</AuthorizerAppid></xml>`
+	if err := xml.Unmarshal([]byte(unauthorizedXML), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if have := GetUnauthorizedMessage(&msg); have.AppId != "wxcomponent" || have.AuthorizerAppId != "wxauthorizer" {
+		t.Errorf("TestAuthorizationNotificationDecode failed, have: %+v\n", have)
+	}
+}
+
+type testVerifyTicketSetter map[string]string
+
+func (setter testVerifyTicketSetter) SetComponentVerifyTicket(appId string, ticket string) error {
+	setter[appId] = ticket
+	return nil
+}
+
+type testRefreshTokenDeleter struct {
+	*testRefreshTokenStorage
+}
+
+func (storage testRefreshTokenDeleter) DeleteRefreshToken(authorizerAppId string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.tokens, authorizerAppId)
+	return nil
+}
+
+func testServeAuthorization(mux *AuthorizationServeMux, msg *MixedMessage) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mux.ServeMessage(w, &Request{MixedMsg: msg})
+	return w
+}
+
+func TestAuthorizationServeMux(t *testing.T) {
+	clt := newTestComponentClient(t)
+	storage := &testRefreshTokenStorage{tokens: make(map[string]string)}
+	pool := NewAuthorizerTokenPool(clt, storage, 1)
+	defer pool.Close(context.Background())
+
+	verifyTickets := make(testVerifyTicketSetter)
+	var authorizedInfo *AuthorizationInfo
+	var revoked []string
+	var unauthorizedErr error
+	var defaultInfoType string
+	mux := &AuthorizationServeMux{
+		Client:              clt,
+		VerifyTicketSetter:  verifyTickets,
+		AutoQueryAuth:       true,
+		RefreshTokenStorage: testRefreshTokenDeleter{storage},
+		TokenPool:           pool,
+		Revoke: func(authorizerAppId string) error {
+			revoked = append(revoked, authorizerAppId)
+			return errors.New("test revoke error")
+		},
+		OnAuthorized: func(r *Request, msg *AuthorizedMessage, info *AuthorizationInfo, err error) {
+			if err != nil {
+				t.Errorf("TestAuthorizationServeMux failed, OnAuthorized error: %v\n", err)
+			}
+			authorizedInfo = info
+		},
+		OnUnauthorized: func(r *Request, msg *UnauthorizedMessage, err error) {
+			unauthorizedErr = err
+		},
+		DefaultMessageHandler: MessageHandlerFunc(func(w http.ResponseWriter, r *Request) {
+			defaultInfoType = r.MixedMsg.InfoType
+			w.Write([]byte("default"))
+		}),
+	}
+
+	// InfoType 不区分大小写
+	w := testServeAuthorization(mux, &MixedMessage{AppId: "wxcomponent", InfoType: "Component_Verify_Ticket", VerifyTicket: "ticket@@@1"})
+	if w.Body.String() != "success" || verifyTickets["wxcomponent"] != "ticket@@@1" {
+		t.Errorf("TestAuthorizationServeMux failed, have: %s, tickets: %v\n", w.Body.String(), verifyTickets)
+	}
+
+	// authorized: QueryAuth, 保存 authorizer_refresh_token, 添加到 TokenPool
+	w = testServeAuthorization(mux, &MixedMessage{InfoType: MsgTypeAuthorized, AuthorizerAppId: "wxauthorizer", AuthorizationCode: "auth-code"})
+	if w.Body.String() != "success" || authorizedInfo == nil || authorizedInfo.AuthorizerAppId != "wxauthorizer" {
+		t.Errorf("TestAuthorizationServeMux failed, have: %s, info: %+v\n", w.Body.String(), authorizedInfo)
+	}
+	if storage.get("wxauthorizer") != "rt" || pool.Len() != 1 {
+		t.Errorf("TestAuthorizationServeMux failed, have refresh_token: %s, pool len: %d\n", storage.get("wxauthorizer"), pool.Len())
+	}
+
+	// unauthorized: 从 TokenPool 移除, 调用 Revoke, 删除 authorizer_refresh_token; Revoke 失败不影响删除
+	w = testServeAuthorization(mux, &MixedMessage{InfoType: MsgTypeUnauthorized, AuthorizerAppId: "wxauthorizer"})
+	if w.Body.String() != "success" || pool.Len() != 0 || len(revoked) != 1 || revoked[0] != "wxauthorizer" {
+		t.Errorf("TestAuthorizationServeMux failed, have: %s, pool len: %d, revoked: %v\n", w.Body.String(), pool.Len(), revoked)
+	}
+	if _, err := storage.LoadRefreshToken("wxauthorizer"); err != ErrRefreshTokenNotFound {
+		t.Errorf("TestAuthorizationServeMux failed, have: %v, want: %v\n", err, ErrRefreshTokenNotFound)
+	}
+	if unauthorizedErr == nil || unauthorizedErr.Error() != "test revoke error" {
+		t.Errorf("TestAuthorizationServeMux failed, have OnUnauthorized error: %v\n", unauthorizedErr)
+	}
+
+	// 其他 InfoType 交给 DefaultMessageHandler
+	w = testServeAuthorization(mux, &MixedMessage{InfoType: "notify_third_fasteregister"})
+	if w.Body.String() != "default" || defaultInfoType != "notify_third_fasteregister" {
+		t.Errorf("TestAuthorizationServeMux failed, have: %s, InfoType: %s\n", w.Body.String(), defaultInfoType)
+	}
+}
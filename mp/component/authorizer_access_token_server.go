@@ -6,15 +6,18 @@
 package component
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/chanxuehong/wechat/internal/daemon"
 	"github.com/chanxuehong/wechat/mp"
 )
 
 var _ mp.AccessTokenServer = (*AuthorizerAccessTokenServer)(nil)
+var _ mp.TokenStatusServer = (*AuthorizerAccessTokenServer)(nil)
 
 // authorizer_access_token 中控服务器, mp.AccessTokenServer 的简单实现.
 //  NOTE:
@@ -24,8 +27,13 @@ var _ mp.AccessTokenServer = (*AuthorizerAccessTokenServer)(nil)
 type AuthorizerAccessTokenServer struct {
 	client          *Client
 	authorizerAppId string
+	storage         RefreshTokenStorage // 可以为 nil
 
-	resetTickerChan chan time.Duration // 用于重置 tokenDaemon 里的 ticker
+	storageMutex      sync.Mutex // 串行化对 storage 的写入, 保存时不持有 tokenGet 锁
+	savedRefreshToken string     // 最后一次成功保存到 storage 的 authorizer_refresh_token, storageMutex 保护
+
+	tokenDaemon     *daemon.Daemon     // 定时刷新 authorizer_access_token 的后台 goroutine
+	refreshNotifier mp.RefreshNotifier // 刷新事件的订阅列表
 
 	tokenGet struct {
 		sync.Mutex
@@ -36,8 +44,14 @@ type AuthorizerAccessTokenServer struct {
 	tokenCache struct {
 		sync.RWMutex
 		Token        string
+		ExpiresAt    int64  // Token 的过期时间, unixtime
 		RefreshToken string // 最新的 authorizer_refresh_token
 	}
+
+	tokenStatus struct {
+		sync.Mutex
+		mp.TokenServerStatus // ExpiresAt, DaemonRunning 在 Status 里计算
+	}
 }
 
 // 创建一个新的 AuthorizerAccessTokenServer.
@@ -49,11 +63,40 @@ func NewAuthorizerAccessTokenServer(clt *Client, authorizerAppId, authorizerRefr
 	srv = &AuthorizerAccessTokenServer{
 		client:          clt,
 		authorizerAppId: authorizerAppId,
-		resetTickerChan: make(chan time.Duration),
 	}
 	srv.tokenCache.RefreshToken = authorizerRefreshToken
 
-	go srv.tokenDaemon(time.Hour * 24) // 启动 tokenDaemon
+	srv.tokenDaemon = daemon.New(srv.daemonRefresh)
+	srv.tokenDaemon.Start(time.Hour * 24) // 启动 tokenDaemon
+	return
+}
+
+// 创建一个新的 AuthorizerAccessTokenServer, authorizer_refresh_token 从 storage 读取,
+// 之后每次得到新的 authorizer_refresh_token 都会保存到 storage.
+//  授权方第一次授权时先调用 RefreshTokenStorage.SaveRefreshToken 保存 QueryAuth 得到的 authorizer_refresh_token.
+func NewAuthorizerAccessTokenServerWithStorage(clt *Client, authorizerAppId string, storage RefreshTokenStorage) (srv *AuthorizerAccessTokenServer, err error) {
+	if clt == nil {
+		panic("nil Client")
+	}
+	if storage == nil {
+		panic("nil RefreshTokenStorage")
+	}
+
+	authorizerRefreshToken, err := storage.LoadRefreshToken(authorizerAppId)
+	if err != nil {
+		return
+	}
+
+	srv = &AuthorizerAccessTokenServer{
+		client:          clt,
+		authorizerAppId: authorizerAppId,
+		storage:         storage,
+	}
+	srv.savedRefreshToken = authorizerRefreshToken
+	srv.tokenCache.RefreshToken = authorizerRefreshToken
+
+	srv.tokenDaemon = daemon.New(srv.daemonRefresh)
+	srv.tokenDaemon.Start(time.Hour * 24) // 启动 tokenDaemon
 	return
 }
 
@@ -63,9 +106,11 @@ func (srv *AuthorizerAccessTokenServer) TagCE90001AFE9C11E48611A4DB30FED8E1() {}
 func (srv *AuthorizerAccessTokenServer) Token() (token string, err error) {
 	srv.tokenCache.RLock()
 	token = srv.tokenCache.Token
+	expiresAt := srv.tokenCache.ExpiresAt
 	srv.tokenCache.RUnlock()
 
-	if token != "" {
+	// 刷新失败时在过期之前继续使用旧的 authorizer_access_token
+	if token != "" && time.Now().Unix() < expiresAt {
 		return
 	}
 	return srv.TokenRefresh()
@@ -73,42 +118,142 @@ func (srv *AuthorizerAccessTokenServer) Token() (token string, err error) {
 
 // 刷新 authorizer_access_token
 func (srv *AuthorizerAccessTokenServer) TokenRefresh() (token string, err error) {
-	tokenInfo, cached, err := srv.getToken()
+	tokenInfo, cached, err := srv.refreshToken()
 	if err != nil {
 		return
 	}
 	if !cached {
-		srv.resetTickerChan <- time.Duration(tokenInfo.ExpiresIn) * time.Second
+		srv.tokenDaemon.Reset(time.Duration(tokenInfo.ExpiresIn) * time.Second)
 	}
 	token = tokenInfo.Token
 	return
 }
 
-func (srv *AuthorizerAccessTokenServer) tokenDaemon(tickDuration time.Duration) {
-NEW_TICK_DURATION:
-	ticker := time.NewTicker(tickDuration)
-
-	for {
-		select {
-		case tickDuration = <-srv.resetTickerChan:
-			ticker.Stop()
-			goto NEW_TICK_DURATION
-
-		case <-ticker.C:
-			tokenInfo, cached, err := srv.getToken()
-			if err != nil {
-				break
-			}
-			if !cached {
-				newTickDuration := time.Duration(tokenInfo.ExpiresIn) * time.Second
-				if tickDuration != newTickDuration {
-					tickDuration = newTickDuration
-					ticker.Stop()
-					goto NEW_TICK_DURATION
-				}
-			}
+// 启动(重启)后台定时刷新 authorizer_access_token 的 goroutine, NewAuthorizerAccessTokenServer 已经启动过一次.
+//  如果已经在运行则什么都不做.
+func (srv *AuthorizerAccessTokenServer) Start() {
+	srv.tokenDaemon.Start(srv.daemonPeriod())
+}
+
+// 停止后台定时刷新 authorizer_access_token 的 goroutine, 并等待正在进行的刷新完成.
+//  如果 ctx 在这之前结束则返回 ctx.Err();
+//  Stop 之后仍然可以调用 Token, TokenRefresh, 也可以调用 Start 重新启动.
+func (srv *AuthorizerAccessTokenServer) Stop(ctx context.Context) error {
+	return srv.tokenDaemon.Stop(ctx)
+}
+
+// 同 Stop(context.Background()).
+func (srv *AuthorizerAccessTokenServer) Close() error {
+	return srv.Stop(context.Background())
+}
+
+// 订阅刷新 authorizer_access_token 的事件, 返回取消订阅的函数, 比如 appsecret 被重置导致刷新失败时告警.
+//  见 mp.RefreshNotifier.Subscribe.
+func (srv *AuthorizerAccessTokenServer) Subscribe(fn func(*mp.RefreshEvent)) (unsubscribe func()) {
+	return srv.refreshNotifier.Subscribe(fn)
+}
+
+// 返回中控服务器当前的状态, 用于排查问题, 见 mp.NewTokenStatusHandler.
+func (srv *AuthorizerAccessTokenServer) Status() (status mp.TokenServerStatus) {
+	srv.tokenStatus.Lock()
+	status = srv.tokenStatus.TokenServerStatus
+	srv.tokenStatus.Unlock()
+
+	srv.tokenCache.RLock()
+	expiresAt := srv.tokenCache.ExpiresAt
+	srv.tokenCache.RUnlock()
+
+	if expiresAt > 0 {
+		status.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+	status.DaemonRunning = srv.tokenDaemon.IsRunning()
+	return
+}
+
+// 获取当前的 authorizer_refresh_token.
+func (srv *AuthorizerAccessTokenServer) RefreshToken() (refreshToken string) {
+	srv.tokenCache.RLock()
+	refreshToken = srv.tokenCache.RefreshToken
+	srv.tokenCache.RUnlock()
+	return
+}
+
+// 设置新的 authorizer_refresh_token, 比如授权方重新授权之后, 如果有 RefreshTokenStorage 则先保存.
+//  保存失败时返回错误, 当前的 authorizer_refresh_token 不变.
+func (srv *AuthorizerAccessTokenServer) SetRefreshToken(refreshToken string) (err error) {
+	if refreshToken == "" {
+		return errors.New("empty authorizer_refresh_token")
+	}
+
+	srv.storageMutex.Lock()
+	defer srv.storageMutex.Unlock()
+
+	if srv.storage != nil {
+		if err = srv.storage.SaveRefreshToken(srv.authorizerAppId, refreshToken); err != nil {
+			return
 		}
+		srv.savedRefreshToken = refreshToken
 	}
+
+	// 等待正在进行的刷新完成, 防止新的 authorizer_refresh_token 被旧的换回来的覆盖
+	srv.tokenGet.Lock()
+	srv.tokenCache.Lock()
+	srv.tokenCache.RefreshToken = refreshToken
+	srv.tokenCache.Unlock()
+	srv.tokenGet.Unlock()
+	return
+}
+
+// 把最新的 authorizer_refresh_token 保存到 storage, 调用者不能持有 tokenGet 锁.
+//  失败时 savedRefreshToken 不变, 下次刷新之后重试.
+func (srv *AuthorizerAccessTokenServer) saveRefreshToken() (err error) {
+	if srv.storage == nil {
+		return
+	}
+
+	srv.storageMutex.Lock()
+	defer srv.storageMutex.Unlock()
+
+	srv.tokenCache.RLock()
+	refreshToken := srv.tokenCache.RefreshToken
+	srv.tokenCache.RUnlock()
+
+	if refreshToken == srv.savedRefreshToken {
+		return
+	}
+	if err = srv.storage.SaveRefreshToken(srv.authorizerAppId, refreshToken); err != nil {
+		return
+	}
+	srv.savedRefreshToken = refreshToken
+	return
+}
+
+// 后台 goroutine 第一次刷新的时间间隔, 为当前 authorizer_access_token 剩余的有效时间, 如果没有则为 24 小时.
+func (srv *AuthorizerAccessTokenServer) daemonPeriod() time.Duration {
+	srv.tokenGet.Lock()
+	lastTimestamp := srv.tokenGet.LastTimestamp
+	expiresIn := srv.tokenGet.LastTokenInfo.ExpiresIn
+	srv.tokenGet.Unlock()
+
+	if lastTimestamp == 0 {
+		return time.Hour * 24
+	}
+	if period := time.Duration(lastTimestamp+expiresIn-time.Now().Unix()) * time.Second; period > 0 {
+		return period
+	}
+	return time.Second
+}
+
+// 后台 goroutine 的刷新函数, 返回下一次刷新的时间间隔.
+func (srv *AuthorizerAccessTokenServer) daemonRefresh() (next time.Duration, err error) {
+	tokenInfo, cached, err := srv.refreshToken()
+	if err != nil {
+		return
+	}
+	if !cached {
+		next = time.Duration(tokenInfo.ExpiresIn) * time.Second
+	}
+	return
 }
 
 type AuthorizerAccessTokenInfo struct {
@@ -117,6 +262,41 @@ type AuthorizerAccessTokenInfo struct {
 	RefreshToken string `json:"authorizer_refresh_token"`
 }
 
+// 同 getToken, 在没有命中收敛缓存时更新状态并通知刷新事件的订阅者.
+func (srv *AuthorizerAccessTokenServer) refreshToken() (token AuthorizerAccessTokenInfo, cached bool, err error) {
+	if token, cached, err = srv.getToken(); cached {
+		return
+	}
+	timeNow := time.Now()
+
+	// 旧的 authorizer_refresh_token 已经失效, 所以内存里总是使用新的;
+	// 持久化失败不影响这次获取的 authorizer_access_token, 下次刷新之后重试.
+	if err == nil {
+		if saveErr := srv.saveRefreshToken(); saveErr != nil {
+			mp.LogInfoln("[WECHAT] save authorizer_refresh_token failed, authorizer_appid:", srv.authorizerAppId, "error:", saveErr)
+		}
+	}
+
+	srv.tokenStatus.Lock()
+	if err != nil {
+		srv.tokenStatus.LastError = err.Error()
+		srv.tokenStatus.LastErrorTime = timeNow
+		srv.tokenStatus.ErrorCount++
+	} else {
+		srv.tokenStatus.LastRefreshTime = timeNow
+		srv.tokenStatus.LastError = ""
+		srv.tokenStatus.RefreshCount++
+	}
+	srv.tokenStatus.Unlock()
+
+	srv.refreshNotifier.Notify(&mp.RefreshEvent{
+		Time:      timeNow,
+		ExpiresIn: token.ExpiresIn,
+		Err:       err,
+	})
+	return
+}
+
 // 从微信服务器获取 authorizer_access_token.
 //  同一时刻只能一个 goroutine 进入, 防止没必要的重复获取.
 func (srv *AuthorizerAccessTokenServer) getToken() (token AuthorizerAccessTokenInfo, cached bool, err error) {
@@ -141,13 +321,37 @@ func (srv *AuthorizerAccessTokenServer) getToken() (token AuthorizerAccessTokenI
 	authorizerRefreshToken := srv.tokenCache.RefreshToken
 	srv.tokenCache.RUnlock()
 
+	result, err := srv.client.getAuthorizerToken(srv.authorizerAppId, authorizerRefreshToken)
+	if err != nil {
+		return
+	}
+
+	// 更新 tokenGet 信息
+	srv.tokenGet.LastTokenInfo = result
+	srv.tokenGet.LastTimestamp = timeNowUnix
+
+	// 更新缓存
+	srv.tokenCache.Lock()
+	srv.tokenCache.Token = result.Token
+	srv.tokenCache.ExpiresAt = timeNowUnix + result.ExpiresIn
+	if newRefreshToken := result.RefreshToken; newRefreshToken != "" {
+		srv.tokenCache.RefreshToken = newRefreshToken
+	}
+	srv.tokenCache.Unlock()
+
+	token = result
+	return
+}
+
+// 用 authorizer_refresh_token 从微信服务器获取 authorizer_access_token, ExpiresIn 已经减去了一个缓冲时间.
+func (clt *Client) getAuthorizerToken(authorizerAppId, authorizerRefreshToken string) (token AuthorizerAccessTokenInfo, err error) {
 	request := struct {
 		ComponentAppId         string `json:"component_appid"`
 		AuthorizerAppId        string `json:"authorizer_appid"`
 		AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
 	}{
-		ComponentAppId:         srv.client.AppId,
-		AuthorizerAppId:        srv.authorizerAppId,
+		ComponentAppId:         clt.AppId,
+		AuthorizerAppId:        authorizerAppId,
 		AuthorizerRefreshToken: authorizerRefreshToken,
 	}
 
@@ -157,18 +361,11 @@ func (srv *AuthorizerAccessTokenServer) getToken() (token AuthorizerAccessTokenI
 	}
 
 	incompleteURL := "https://api.weixin.qq.com/cgi-bin/component/api_authorizer_token?component_access_token="
-	if err = srv.client.PostJSON(incompleteURL, &request, &result); err != nil {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
+	if err = clt.PostJSON(incompleteURL, &request, &result); err != nil {
 		return
 	}
 
 	if result.ErrCode != mp.ErrCodeOK {
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = &result.Error
 		return
 	}
@@ -176,10 +373,6 @@ func (srv *AuthorizerAccessTokenServer) getToken() (token AuthorizerAccessTokenI
 	// 由于网络的延时, authorizer_access_token 过期时间留了一个缓冲区
 	switch {
 	case result.ExpiresIn > 31556952: // 60*60*24*365.2425
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = errors.New("expires_in too large: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	case result.ExpiresIn > 60*60:
@@ -191,26 +384,10 @@ func (srv *AuthorizerAccessTokenServer) getToken() (token AuthorizerAccessTokenI
 	case result.ExpiresIn > 60:
 		result.ExpiresIn -= 10
 	default:
-		srv.tokenCache.Lock()
-		srv.tokenCache.Token = ""
-		srv.tokenCache.Unlock()
-
 		err = errors.New("expires_in too small: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	}
 
-	// 更新 tokenGet 信息
-	srv.tokenGet.LastTokenInfo = result.AuthorizerAccessTokenInfo
-	srv.tokenGet.LastTimestamp = timeNowUnix
-
-	// 更新缓存
-	srv.tokenCache.Lock()
-	srv.tokenCache.Token = result.AuthorizerAccessTokenInfo.Token
-	if authorizerRefreshToken := result.AuthorizerAccessTokenInfo.RefreshToken; authorizerRefreshToken != "" {
-		srv.tokenCache.RefreshToken = authorizerRefreshToken
-	}
-	srv.tokenCache.Unlock()
-
 	token = result.AuthorizerAccessTokenInfo
 	return
 }
@@ -0,0 +1,200 @@
+package component
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testAccessTokenServer struct{}
+
+func (testAccessTokenServer) Tag7B36CB9FFE9911E48469A4DB30FED8E1() {}
+func (testAccessTokenServer) Token() (string, error)               { return "test-token", nil }
+func (testAccessTokenServer) TokenRefresh() (string, error)        { return "test-token", nil }
+
+// 把所有请求转发到 httptest.Server.
+type testRewriteTransport struct {
+	target *url.URL
+}
+
+func (t testRewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// 可以模拟保存失败和阻塞的 RefreshTokenStorage.
+type testRefreshTokenStorage struct {
+	mutex  sync.Mutex
+	tokens map[string]string
+	loads  int
+	fail   bool
+	saving chan struct{} // 不为 nil 时, 进入 SaveRefreshToken 时通知
+	block  chan struct{} // 不为 nil 时, SaveRefreshToken 等待它关闭
+}
+
+func (storage *testRefreshTokenStorage) LoadRefreshToken(authorizerAppId string) (string, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.loads++
+	refreshToken, ok := storage.tokens[authorizerAppId]
+	if !ok {
+		return "", ErrRefreshTokenNotFound
+	}
+	return refreshToken, nil
+}
+
+func (storage *testRefreshTokenStorage) SaveRefreshToken(authorizerAppId, refreshToken string) error {
+	storage.mutex.Lock()
+	fail, saving, block := storage.fail, storage.saving, storage.block
+	storage.mutex.Unlock()
+
+	if saving != nil {
+		saving <- struct{}{}
+	}
+	if block != nil {
+		<-block
+	}
+	if fail {
+		return errors.New("test save error")
+	}
+
+	storage.mutex.Lock()
+	storage.tokens[authorizerAppId] = refreshToken
+	storage.mutex.Unlock()
+	return nil
+}
+
+func (storage *testRefreshTokenStorage) get(authorizerAppId string) string {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	return storage.tokens[authorizerAppId]
+}
+
+func (storage *testRefreshTokenStorage) setFail(fail bool) {
+	storage.mutex.Lock()
+	storage.fail = fail
+	storage.mutex.Unlock()
+}
+
+// 模拟微信的 api_authorizer_token 接口, 每次都返回新的 authorizer_refresh_token: rt-1, rt-2, ...
+func newTestAuthorizerAccessTokenServer(t *testing.T, storage RefreshTokenStorage) *AuthorizerAccessTokenServer {
+	var mutex sync.Mutex
+	var calls int
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls++
+		n := strconv.Itoa(calls)
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		io.WriteString(w, `{"authorizer_access_token":"at-`+n+`","expires_in":7200,"authorizer_refresh_token":"rt-`+n+`"}`)
+	}))
+	t.Cleanup(apiServer.Close)
+
+	target, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clt := NewClient("wxcomponent", testAccessTokenServer{}, &http.Client{Transport: testRewriteTransport{target: target}})
+
+	srv, err := NewAuthorizerAccessTokenServerWithStorage(clt, "wxa", storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func TestAuthorizerAccessTokenServerSetRefreshToken(t *testing.T) {
+	storage := &testRefreshTokenStorage{tokens: map[string]string{"wxa": "rt-old"}}
+	srv := newTestAuthorizerAccessTokenServer(t, storage)
+
+	// 保存失败时不改变当前的 authorizer_refresh_token
+	storage.setFail(true)
+	if err := srv.SetRefreshToken("rt-new"); err == nil {
+		t.Errorf("TestAuthorizerAccessTokenServerSetRefreshToken failed, want save error\n")
+	}
+	if have := srv.RefreshToken(); have != "rt-old" {
+		t.Errorf("TestAuthorizerAccessTokenServerSetRefreshToken failed, have: %s, want: %s\n", have, "rt-old")
+	}
+	storage.setFail(false)
+
+	// 保存的时候不持有 tokenGet 锁
+	storage.saving = make(chan struct{})
+	storage.block = make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.SetRefreshToken("rt-new")
+	}()
+	<-storage.saving
+
+	doneChan := make(chan struct{})
+	go func() {
+		srv.daemonPeriod() // 需要 tokenGet 锁
+		close(doneChan)
+	}()
+	select {
+	case <-doneChan:
+	case <-time.After(time.Second):
+		t.Errorf("TestAuthorizerAccessTokenServerSetRefreshToken failed, tokenGet locked by SaveRefreshToken\n")
+	}
+	if have := srv.RefreshToken(); have != "rt-old" {
+		t.Errorf("TestAuthorizerAccessTokenServerSetRefreshToken failed, have: %s, want: %s\n", have, "rt-old")
+	}
+
+	close(storage.block)
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	if have := srv.RefreshToken(); have != "rt-new" {
+		t.Errorf("TestAuthorizerAccessTokenServerSetRefreshToken failed, have: %s, want: %s\n", have, "rt-new")
+	}
+	if have := storage.get("wxa"); have != "rt-new" {
+		t.Errorf("TestAuthorizerAccessTokenServerSetRefreshToken failed, have saved: %s, want: %s\n", have, "rt-new")
+	}
+}
+
+func TestAuthorizerAccessTokenServerSaveRotatedRefreshToken(t *testing.T) {
+	storage := &testRefreshTokenStorage{tokens: map[string]string{"wxa": "rt-old"}}
+	srv := newTestAuthorizerAccessTokenServer(t, storage)
+
+	token, err := srv.TokenRefresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "at-1" || srv.RefreshToken() != "rt-1" || storage.get("wxa") != "rt-1" {
+		t.Errorf("TestAuthorizerAccessTokenServerSaveRotatedRefreshToken failed, have: %s, %s, saved: %s\n", token, srv.RefreshToken(), storage.get("wxa"))
+	}
+
+	// 保存失败不影响获取 authorizer_access_token, 旧的 authorizer_refresh_token 已经失效, 内存里使用新的
+	storage.setFail(true)
+	srv.tokenGet.Lock()
+	srv.tokenGet.LastTimestamp = 0 // 跳过收敛缓存
+	srv.tokenGet.Unlock()
+	if token, err = srv.TokenRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	if token != "at-2" || srv.RefreshToken() != "rt-2" || storage.get("wxa") != "rt-1" {
+		t.Errorf("TestAuthorizerAccessTokenServerSaveRotatedRefreshToken failed, have: %s, %s, saved: %s\n", token, srv.RefreshToken(), storage.get("wxa"))
+	}
+
+	// 下次刷新之后保存最新的
+	storage.setFail(false)
+	srv.tokenGet.Lock()
+	srv.tokenGet.LastTimestamp = 0
+	srv.tokenGet.Unlock()
+	if _, err = srv.TokenRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	if have := storage.get("wxa"); have != "rt-3" {
+		t.Errorf("TestAuthorizerAccessTokenServerSaveRotatedRefreshToken failed, have saved: %s, want: %s\n", have, "rt-3")
+	}
+}
@@ -0,0 +1,121 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"errors"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 授权方的消息(事件)处理配置.
+type AuthorizerHandler struct {
+	OriId          string            // 授权方的原始ID, 用于约束消息的 ToUserName, 不能为空, 见 NewAuthorizerServer
+	MessageHandler mp.MessageHandler // 授权方的消息(事件)处理, 比如 mp.MessageServeMux
+}
+
+// 根据授权方的 AppId 查找 AuthorizerHandler.
+type AuthorizerHandlerRegistry interface {
+	// 没有找到返回 mp.ErrServerNotFound.
+	AuthorizerHandler(authorizerAppId string) (*AuthorizerHandler, error)
+}
+
+type AuthorizerHandlerRegistryFunc func(authorizerAppId string) (*AuthorizerHandler, error)
+
+func (fn AuthorizerHandlerRegistryFunc) AuthorizerHandler(authorizerAppId string) (*AuthorizerHandler, error) {
+	return fn(authorizerAppId)
+}
+
+// 创建授权方的 mp.Server.
+//  第三方平台代授权方接收消息时, 消息用第三方平台的 Token, AES Key 签名和加密, 消息里的 AppId 为第三方平台的 AppId,
+//  所以 Token, AES Key, AppId 都来自 componentServer, oriId 和 handler 来自授权方.
+//  NOTE: 所有授权方的签名和加密都相同, ToUserName 是区分授权方的唯一依据, 所以 oriId 不能为空,
+//  否则发给授权方 A 的消息发到授权方 B 的 URL 也能通过校验; oriId 可以从 GetAuthorizerInfo 的 UserName 得到.
+func NewAuthorizerServer(componentServer Server, oriId string, handler mp.MessageHandler) mp.Server {
+	if componentServer == nil {
+		panic("nil Server")
+	}
+	if oriId == "" {
+		panic("empty oriId")
+	}
+	if handler == nil {
+		panic("nil MessageHandler")
+	}
+
+	srv := &authorizerServer{
+		Server:         componentServer,
+		oriId:          oriId,
+		messageHandler: handler,
+	}
+	if ringServer, ok := componentServer.(mp.AESKeyRingServer); ok {
+		return &authorizerRingServer{
+			authorizerServer: srv,
+			ringServer:       ringServer,
+		}
+	}
+	return srv
+}
+
+type authorizerServer struct {
+	Server // Token, AppId, CurrentAESKey, LastAESKey
+
+	oriId          string
+	messageHandler mp.MessageHandler
+}
+
+func (srv *authorizerServer) OriId() string {
+	return srv.oriId
+}
+func (srv *authorizerServer) MessageHandler() mp.MessageHandler {
+	return srv.messageHandler
+}
+
+// componentServer 实现了 mp.AESKeyRingServer 时, 授权方的 mp.Server 也要实现, 这样才能用 AESKeyRing 解密.
+type authorizerRingServer struct {
+	*authorizerServer
+	ringServer mp.AESKeyRingServer
+}
+
+func (srv *authorizerRingServer) AESKeyRing() *mp.AESKeyRing {
+	return srv.ringServer.AESKeyRing()
+}
+
+// 创建一个 mp.ServerRegistry, serverKey 为授权方的 AppId, 返回的 mp.Server 见 NewAuthorizerServer.
+//  AuthorizerHandler.OriId 为空时返回错误.
+func NewAuthorizerServerRegistry(componentServer Server, handlers AuthorizerHandlerRegistry) mp.ServerRegistry {
+	if componentServer == nil {
+		panic("nil Server")
+	}
+	if handlers == nil {
+		panic("nil AuthorizerHandlerRegistry")
+	}
+
+	return mp.ServerRegistryFunc(func(authorizerAppId string) (mp.Server, error) {
+		handler, err := handlers.AuthorizerHandler(authorizerAppId)
+		if err != nil {
+			return nil, err
+		}
+		if handler == nil || handler.MessageHandler == nil {
+			return nil, mp.ErrServerNotFound
+		}
+		if handler.OriId == "" {
+			return nil, errors.New("empty OriId of the AuthorizerHandler for authorizer_appid: " + authorizerAppId)
+		}
+		return NewAuthorizerServer(componentServer, handler.OriId, handler.MessageHandler), nil
+	})
+}
+
+// 创建代授权方接收消息(事件)的 http.Handler, 所有授权方共用一个 URL 模式, 授权方的 AppId 在路径中,
+// 比如 pathPrefix == "/wechat/", 授权方 wx1234567890 的消息与事件接收 URL 为 http://www.xxx.com/wechat/wx1234567890.
+//  消息的处理同 mp.MultiServerFrontend: 用第三方平台的 Token, AES Key 校验和解密, 校验 ToUserName 之后交给授权方的 mp.MessageHandler.
+//  errHandler:  错误处理 handler, 可以为 nil
+//  interceptor: 拦截器, 可以为 nil
+func NewAuthorizerMessageFrontend(componentServer Server, handlers AuthorizerHandlerRegistry, pathPrefix string,
+	errHandler mp.ErrorHandler, interceptor mp.Interceptor) *mp.MultiServerFrontend {
+
+	return mp.NewMultiServerFrontendWithRegistry(NewAuthorizerServerRegistry(componentServer, handlers),
+		mp.PathServerKey(pathPrefix), errHandler, interceptor)
+}
@@ -0,0 +1,99 @@
+package component
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+func newTestComponentServer() *DefaultServer {
+	return NewDefaultServer("wxcomponent", "token", []byte("0123456789abcdef0123456789abcdef"),
+		MessageHandlerFunc(func(w http.ResponseWriter, r *Request) {}))
+}
+
+// 用第三方平台的 Token, AES Key 签名和加密发给授权方的消息, POST 到 frontend.
+func testPostAuthorizerMessage(frontend http.Handler, srv Server, path, msgXML string) *httptest.ResponseRecorder {
+	encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg([]byte("0123456789abcdef"), []byte(msgXML), srv.AppId(), srv.CurrentAESKey()))
+	queryValues := url.Values{
+		"encrypt_type":  {"aes"},
+		"timestamp":     {"1460000000"},
+		"nonce":         {"nonce"},
+		"msg_signature": {util.MsgSign(srv.Token(), "1460000000", "nonce", encryptedMsg)},
+	}
+	toUserName := msgXML[strings.Index(msgXML, "<ToUserName>")+len("<ToUserName>") : strings.Index(msgXML, "</ToUserName>")]
+	body := "<xml><ToUserName>" + toUserName + "</ToUserName><Encrypt>" + encryptedMsg + "</Encrypt></xml>"
+
+	w := httptest.NewRecorder()
+	frontend.ServeHTTP(w, httptest.NewRequest("POST", path+"?"+queryValues.Encode(), strings.NewReader(body)))
+	return w
+}
+
+func TestNewAuthorizerServer(t *testing.T) {
+	componentServer := newTestComponentServer()
+	handler := mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {})
+
+	srv := NewAuthorizerServer(componentServer, "gh_authorizer", handler)
+	if srv.OriId() != "gh_authorizer" || srv.AppId() != "wxcomponent" || srv.Token() != "token" || srv.CurrentAESKey() != componentServer.CurrentAESKey() {
+		t.Errorf("TestNewAuthorizerServer failed, have: %s, %s, %s\n", srv.OriId(), srv.AppId(), srv.Token())
+	}
+
+	// 没有 OriId 就无法区分授权方
+	defer func() {
+		if recover() == nil {
+			t.Errorf("TestNewAuthorizerServer failed, want panic for empty oriId\n")
+		}
+	}()
+	NewAuthorizerServer(componentServer, "", handler)
+}
+
+func TestAuthorizerMessageFrontend(t *testing.T) {
+	componentServer := newTestComponentServer()
+	handlers := AuthorizerHandlerRegistryFunc(func(authorizerAppId string) (*AuthorizerHandler, error) {
+		switch authorizerAppId {
+		case "wxa", "wxb":
+			return &AuthorizerHandler{
+				OriId: "gh_" + authorizerAppId,
+				MessageHandler: mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {
+					io.WriteString(w, authorizerAppId+":"+r.MixedMsg.Content)
+				}),
+			}, nil
+		case "wxnooriid":
+			return &AuthorizerHandler{MessageHandler: mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {})}, nil
+		}
+		return nil, mp.ErrServerNotFound
+	})
+	var lastErr error
+	errHandler := mp.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		lastErr = err
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	frontend := NewAuthorizerMessageFrontend(componentServer, handlers, "/wechat/", errHandler, nil)
+
+	msgXML := `<xml><ToUserName>gh_wxa</ToUserName><FromUserName>user</FromUserName><CreateTime>1</CreateTime><MsgType>text</MsgType><Content>hi</Content></xml>`
+	if w := testPostAuthorizerMessage(frontend, componentServer, "/wechat/wxa", msgXML); w.Body.String() != "wxa:hi" {
+		t.Errorf("TestAuthorizerMessageFrontend failed, have: %s, %v, want: %s\n", w.Body.String(), lastErr, "wxa:hi")
+	}
+
+	// 发给 wxa 的消息发到 wxb 的 URL, 签名和解密都能通过, 只有 ToUserName 不同
+	lastErr = nil
+	if w := testPostAuthorizerMessage(frontend, componentServer, "/wechat/wxb", msgXML); w.Code != http.StatusBadRequest || lastErr == nil {
+		t.Errorf("TestAuthorizerMessageFrontend failed, have: %d, %s, want ToUserName mismatch\n", w.Code, w.Body.String())
+	}
+
+	lastErr = nil
+	if w := testPostAuthorizerMessage(frontend, componentServer, "/wechat/wxnooriid", msgXML); w.Code != http.StatusBadRequest || lastErr == nil || !strings.Contains(lastErr.Error(), "OriId") {
+		t.Errorf("TestAuthorizerMessageFrontend failed, have: %d, %v, want empty OriId error\n", w.Code, lastErr)
+	}
+
+	lastErr = nil
+	if w := testPostAuthorizerMessage(frontend, componentServer, "/wechat/wxnotfound", msgXML); w.Code != http.StatusBadRequest || lastErr == nil {
+		t.Errorf("TestAuthorizerMessageFrontend failed, have: %d, want server not found\n", w.Code)
+	}
+}
@@ -0,0 +1,548 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/daemon"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 授权方连续后台刷新失败这么多次之后停止后台刷新, 比如授权方已经取消授权但是没有收到 unauthorized 事件.
+//  停止之后 Token, TokenRefresh 仍然会尝试刷新, 成功则恢复后台刷新; Add(重新授权)会马上恢复后台刷新.
+const poolMaxFailures = 10
+
+var ErrAuthorizerTokenPoolClosed = errors.New("AuthorizerTokenPool closed")
+
+// 管理大量授权方 authorizer_access_token 的中控服务器.
+//  每个 AuthorizerAccessTokenServer 都有一个后台 goroutine, 授权方很多时不合适;
+//  AuthorizerTokenPool 只用一个调度 goroutine, 按照刷新时间维护一个优先队列, 并限制同时刷新的数量.
+//  授权方在第一次获取 authorizer_access_token 时才从 RefreshTokenStorage 加载(懒加载).
+//  刷新失败按指数退避重试, 连续失败 poolMaxFailures 次之后停止后台刷新, 见 Failing;
+//  授权方取消授权时应该调用 Remove, AuthorizationServeMux 收到 unauthorized 事件时会自动调用.
+//  NOTE:
+//  1. 用于单进程环境.
+//  2. 同一个授权方不要同时由 AuthorizerTokenPool 和 AuthorizerAccessTokenServer 管理, 它们会互相使对方的 authorizer_refresh_token 失效.
+type AuthorizerTokenPool struct {
+	client  *Client
+	storage RefreshTokenStorage
+
+	semaphore chan struct{} // 限制后台同时刷新的数量
+	wakeChan  chan struct{} // 队列头变化时通知调度 goroutine
+	closeChan chan struct{} // 关闭表示通知调度 goroutine 退出
+	wg        sync.WaitGroup
+
+	mutex    sync.Mutex
+	entryMap map[string]*authorizerTokenEntry
+	queue    authorizerTokenQueue
+	closed   bool
+}
+
+// 创建一个新的 AuthorizerTokenPool, 并启动调度 goroutine.
+//  storage:     读取和保存 authorizer_refresh_token
+//  concurrency: 后台同时刷新的最大数量, <= 0 时为 8
+func NewAuthorizerTokenPool(clt *Client, storage RefreshTokenStorage, concurrency int) *AuthorizerTokenPool {
+	if clt == nil {
+		panic("nil Client")
+	}
+	if storage == nil {
+		panic("nil RefreshTokenStorage")
+	}
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+
+	pool := &AuthorizerTokenPool{
+		client:    clt,
+		storage:   storage,
+		semaphore: make(chan struct{}, concurrency),
+		wakeChan:  make(chan struct{}, 1),
+		closeChan: make(chan struct{}),
+		entryMap:  make(map[string]*authorizerTokenEntry),
+	}
+	pool.wg.Add(1)
+	go pool.run()
+	return pool
+}
+
+// 返回授权方的 mp.AccessTokenServer 视图, 可以用于 mp.NewClient; 不会加载授权方.
+func (pool *AuthorizerTokenPool) AccessTokenServer(authorizerAppId string) *AuthorizerTokenView {
+	return &AuthorizerTokenView{
+		pool:            pool,
+		authorizerAppId: authorizerAppId,
+	}
+}
+
+// 获取授权方缓存的 authorizer_access_token, 没有或者已经过期则刷新.
+func (pool *AuthorizerTokenPool) Token(authorizerAppId string) (token string, err error) {
+	entry, err := pool.entry(authorizerAppId)
+	if err != nil {
+		return
+	}
+
+	entry.tokenCache.RLock()
+	token = entry.tokenCache.Token
+	expiresAt := entry.tokenCache.ExpiresAt
+	entry.tokenCache.RUnlock()
+
+	if token != "" && time.Now().Unix() < expiresAt {
+		return
+	}
+	return pool.TokenRefresh(authorizerAppId)
+}
+
+// 刷新授权方的 authorizer_access_token.
+func (pool *AuthorizerTokenPool) TokenRefresh(authorizerAppId string) (token string, err error) {
+	entry, err := pool.entry(authorizerAppId)
+	if err != nil {
+		return
+	}
+	tokenInfo, err := pool.refresh(entry)
+	if err != nil {
+		return
+	}
+	token = tokenInfo.Token
+	return
+}
+
+// 添加(更新)授权方, 比如授权方授权或者重新授权之后, authorizerRefreshToken 同时保存到 RefreshTokenStorage.
+func (pool *AuthorizerTokenPool) Add(authorizerAppId, authorizerRefreshToken string) (err error) {
+	if authorizerRefreshToken == "" {
+		return errors.New("empty authorizer_refresh_token")
+	}
+
+	pool.mutex.Lock()
+	savingEntry := pool.entryMap[authorizerAppId]
+	pool.mutex.Unlock()
+
+	// 和 savingEntry 刷新之后的保存串行, 防止新的 authorizer_refresh_token 被旧的覆盖
+	if savingEntry != nil {
+		savingEntry.storageMutex.Lock()
+		defer savingEntry.storageMutex.Unlock()
+	}
+	if err = pool.storage.SaveRefreshToken(authorizerAppId, authorizerRefreshToken); err != nil {
+		return
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.closed {
+		return ErrAuthorizerTokenPoolClosed
+	}
+	if entry := pool.entryMap[authorizerAppId]; entry != nil {
+		entry.failures = 0 // 重新授权, 恢复后台刷新
+		entry.backoff = 0
+		entry.lastErr = nil
+		if entry == savingEntry {
+			entry.savedRefreshToken = authorizerRefreshToken
+		}
+
+		entry.tokenGet.Lock()
+		entry.tokenGet.LastTimestamp = 0 // 新的 authorizer_refresh_token 不使用收敛缓存
+		entry.tokenGet.Unlock()
+
+		entry.tokenCache.Lock()
+		entry.tokenCache.RefreshToken = authorizerRefreshToken
+		entry.tokenCache.Unlock()
+
+		if entry.index < 0 { // 已经停止后台刷新, 马上用新的 authorizer_refresh_token 刷新
+			entry.nextRefresh = time.Now()
+			heap.Push(&pool.queue, entry)
+			if entry.index == 0 {
+				select {
+				case pool.wakeChan <- struct{}{}:
+				default:
+				}
+			}
+		}
+		return
+	}
+	pool.entryMap[authorizerAppId] = newAuthorizerTokenEntry(authorizerAppId, authorizerRefreshToken)
+	return
+}
+
+// 移除授权方, 比如授权方取消授权之后; 不会删除 RefreshTokenStorage 里的数据.
+func (pool *AuthorizerTokenPool) Remove(authorizerAppId string) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	entry := pool.entryMap[authorizerAppId]
+	if entry == nil {
+		return
+	}
+	delete(pool.entryMap, authorizerAppId)
+	if entry.index >= 0 {
+		heap.Remove(&pool.queue, entry.index)
+	}
+}
+
+// 已经加载的授权方的数量.
+func (pool *AuthorizerTokenPool) Len() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return len(pool.entryMap)
+}
+
+// 刷新失败的授权方.
+type AuthorizerTokenFailure struct {
+	AuthorizerAppId string
+	Failures        int   // 连续刷新失败的次数
+	LastError       error // 最后一次刷新失败的错误
+	Suspended       bool  // 是否已经停止后台刷新
+}
+
+// 返回最后一次刷新失败的授权方, 用于监控; 不包括没有加载的授权方.
+func (pool *AuthorizerTokenPool) Failing() (failures []AuthorizerTokenFailure) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for _, entry := range pool.entryMap {
+		if entry.failures == 0 {
+			continue
+		}
+		failures = append(failures, AuthorizerTokenFailure{
+			AuthorizerAppId: entry.authorizerAppId,
+			Failures:        entry.failures,
+			LastError:       entry.lastErr,
+			Suspended:       entry.failures >= poolMaxFailures,
+		})
+	}
+	return
+}
+
+// 停止调度 goroutine, 并等待正在进行的后台刷新完成.
+//  如果 ctx 在这之前结束则返回 ctx.Err(); Close 之后 Token, TokenRefresh 返回 ErrAuthorizerTokenPoolClosed.
+func (pool *AuthorizerTokenPool) Close(ctx context.Context) error {
+	pool.mutex.Lock()
+	if !pool.closed {
+		pool.closed = true
+		close(pool.closeChan)
+	}
+	pool.mutex.Unlock()
+
+	doneChan := make(chan struct{})
+	go func() {
+		pool.wg.Wait()
+		close(doneChan)
+	}()
+
+	select {
+	case <-doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 获取授权方的 entry, 不存在则从 RefreshTokenStorage 加载.
+func (pool *AuthorizerTokenPool) entry(authorizerAppId string) (entry *authorizerTokenEntry, err error) {
+	pool.mutex.Lock()
+	closed := pool.closed
+	entry = pool.entryMap[authorizerAppId]
+	pool.mutex.Unlock()
+
+	if closed {
+		return nil, ErrAuthorizerTokenPoolClosed
+	}
+	if entry != nil {
+		return
+	}
+
+	authorizerRefreshToken, err := pool.storage.LoadRefreshToken(authorizerAppId)
+	if err != nil {
+		return nil, err
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if entry = pool.entryMap[authorizerAppId]; entry != nil { // 并发加载
+		return
+	}
+	entry = newAuthorizerTokenEntry(authorizerAppId, authorizerRefreshToken)
+	pool.entryMap[authorizerAppId] = entry
+	return
+}
+
+// 刷新 entry 的 authorizer_access_token, 并安排下一次刷新的时间.
+func (pool *AuthorizerTokenPool) refresh(entry *authorizerTokenEntry) (token AuthorizerAccessTokenInfo, err error) {
+	token, cached, err := entry.getToken(pool.client)
+	if cached {
+		return
+	}
+	if err != nil {
+		mp.LogInfoln("[WECHAT] refresh authorizer_access_token failed, authorizer_appid:", entry.authorizerAppId, "error:", err)
+	} else if saveErr := entry.saveRefreshToken(pool.storage); saveErr != nil {
+		// 同 AuthorizerAccessTokenServer, 持久化失败不影响这次获取的 authorizer_access_token, 下次刷新之后重试
+		mp.LogInfoln("[WECHAT] save authorizer_refresh_token failed, authorizer_appid:", entry.authorizerAppId, "error:", saveErr)
+	}
+	pool.schedule(entry, token.ExpiresIn, err)
+	return
+}
+
+// 安排 entry 下一次刷新的时间: 成功则在 authorizer_access_token 过期前(随机提前一点)刷新, 失败则指数退避重试,
+// 连续失败 poolMaxFailures 次则停止后台刷新.
+func (pool *AuthorizerTokenPool) schedule(entry *authorizerTokenEntry, expiresIn int64, refreshErr error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.closed || pool.entryMap[entry.authorizerAppId] != entry { // 已经被移除
+		return
+	}
+
+	var next time.Duration
+	if refreshErr == nil {
+		entry.failures = 0
+		entry.backoff = 0
+		entry.lastErr = nil
+		next = daemon.Jitter(time.Duration(expiresIn) * time.Second)
+	} else {
+		entry.failures++
+		entry.backoff = daemon.NextBackoff(entry.backoff)
+		entry.lastErr = refreshErr
+		if entry.failures >= poolMaxFailures {
+			if entry.failures == poolMaxFailures {
+				mp.LogInfoln("[WECHAT] suspend refreshing authorizer_access_token, authorizer_appid:", entry.authorizerAppId, "failures:", entry.failures)
+			}
+			if entry.index >= 0 {
+				heap.Remove(&pool.queue, entry.index)
+			}
+			return
+		}
+		next = entry.backoff
+	}
+	entry.nextRefresh = time.Now().Add(next)
+
+	if entry.index >= 0 {
+		heap.Fix(&pool.queue, entry.index)
+	} else {
+		heap.Push(&pool.queue, entry)
+	}
+	if entry.index == 0 {
+		select {
+		case pool.wakeChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 调度 goroutine, 取出到期的 entry 并发刷新.
+func (pool *AuthorizerTokenPool) run() {
+	defer pool.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		var dueEntries []*authorizerTokenEntry
+		wait := time.Hour
+
+		pool.mutex.Lock()
+		timeNow := time.Now()
+		for len(pool.queue) > 0 && !pool.queue[0].nextRefresh.After(timeNow) {
+			dueEntries = append(dueEntries, heap.Pop(&pool.queue).(*authorizerTokenEntry))
+		}
+		if len(pool.queue) > 0 {
+			wait = pool.queue[0].nextRefresh.Sub(timeNow)
+		}
+		pool.mutex.Unlock()
+
+		for _, entry := range dueEntries {
+			select {
+			case pool.semaphore <- struct{}{}:
+			case <-pool.closeChan:
+				return
+			}
+			pool.wg.Add(1)
+			go func(entry *authorizerTokenEntry) {
+				defer func() {
+					<-pool.semaphore
+					pool.wg.Done()
+				}()
+				pool.refresh(entry)
+			}(entry)
+		}
+		if len(dueEntries) > 0 {
+			continue // 刷新期间可能有新的 entry 到期
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C:
+		case <-pool.wakeChan:
+		case <-pool.closeChan:
+			return
+		}
+	}
+}
+
+// 授权方在 AuthorizerTokenPool 里的状态.
+type authorizerTokenEntry struct {
+	authorizerAppId string
+
+	// 下面的字段由 AuthorizerTokenPool.mutex 保护
+	index       int // 在 queue 中的位置, -1 表示不在 queue 中
+	nextRefresh time.Time
+	failures    int           // 连续刷新失败的次数
+	backoff     time.Duration // 当前的重试时间间隔
+	lastErr     error         // 最后一次刷新失败的错误
+
+	storageMutex      sync.Mutex // 串行化对 RefreshTokenStorage 的写入, 保存时不持有 tokenGet 锁
+	savedRefreshToken string     // 最后一次成功保存到 RefreshTokenStorage 的 authorizer_refresh_token, storageMutex 保护
+
+	tokenGet struct {
+		sync.Mutex
+		LastTokenInfo AuthorizerAccessTokenInfo // 最后一次成功从微信服务器获取的 authorizer_access_token 信息
+		LastTimestamp int64                     // 最后一次成功从微信服务器获取 authorizer_access_token 的时间戳
+	}
+
+	tokenCache struct {
+		sync.RWMutex
+		Token        string
+		ExpiresAt    int64  // Token 的过期时间, unixtime
+		RefreshToken string // 最新的 authorizer_refresh_token
+	}
+}
+
+func newAuthorizerTokenEntry(authorizerAppId, authorizerRefreshToken string) *authorizerTokenEntry {
+	entry := &authorizerTokenEntry{
+		authorizerAppId: authorizerAppId,
+		index:           -1,
+	}
+	entry.savedRefreshToken = authorizerRefreshToken
+	entry.tokenCache.RefreshToken = authorizerRefreshToken
+	return entry
+}
+
+// 从微信服务器获取 authorizer_access_token, 同 AuthorizerAccessTokenServer.getToken.
+func (entry *authorizerTokenEntry) getToken(clt *Client) (token AuthorizerAccessTokenInfo, cached bool, err error) {
+	entry.tokenGet.Lock()
+	defer entry.tokenGet.Unlock()
+
+	timeNowUnix := time.Now().Unix()
+
+	// 在收敛周期内直接返回最近一次获取的 authorizer_access_token, 这里的收敛时间设定为4秒.
+	if n := entry.tokenGet.LastTimestamp; n <= timeNowUnix && timeNowUnix < n+4 {
+		token = AuthorizerAccessTokenInfo{
+			Token:        entry.tokenGet.LastTokenInfo.Token,
+			ExpiresIn:    entry.tokenGet.LastTokenInfo.ExpiresIn - timeNowUnix + n,
+			RefreshToken: entry.tokenGet.LastTokenInfo.RefreshToken,
+		}
+		cached = true
+		return
+	}
+
+	entry.tokenCache.RLock()
+	authorizerRefreshToken := entry.tokenCache.RefreshToken
+	entry.tokenCache.RUnlock()
+
+	result, err := clt.getAuthorizerToken(entry.authorizerAppId, authorizerRefreshToken)
+	if err != nil {
+		return
+	}
+
+	// 更新 tokenGet 信息
+	entry.tokenGet.LastTokenInfo = result
+	entry.tokenGet.LastTimestamp = timeNowUnix
+
+	// 更新缓存
+	entry.tokenCache.Lock()
+	entry.tokenCache.Token = result.Token
+	entry.tokenCache.ExpiresAt = timeNowUnix + result.ExpiresIn
+	if newRefreshToken := result.RefreshToken; newRefreshToken != "" {
+		entry.tokenCache.RefreshToken = newRefreshToken
+	}
+	entry.tokenCache.Unlock()
+
+	token = result
+	return
+}
+
+// 把最新的 authorizer_refresh_token 保存到 storage, 同 AuthorizerAccessTokenServer.saveRefreshToken.
+func (entry *authorizerTokenEntry) saveRefreshToken(storage RefreshTokenStorage) (err error) {
+	entry.storageMutex.Lock()
+	defer entry.storageMutex.Unlock()
+
+	entry.tokenCache.RLock()
+	refreshToken := entry.tokenCache.RefreshToken
+	entry.tokenCache.RUnlock()
+
+	if refreshToken == entry.savedRefreshToken {
+		return
+	}
+	if err = storage.SaveRefreshToken(entry.authorizerAppId, refreshToken); err != nil {
+		return
+	}
+	entry.savedRefreshToken = refreshToken
+	return
+}
+
+// 按 nextRefresh 排序的小顶堆, 实现 heap.Interface.
+type authorizerTokenQueue []*authorizerTokenEntry
+
+func (q authorizerTokenQueue) Len() int { return len(q) }
+
+func (q authorizerTokenQueue) Less(i, j int) bool {
+	return q[i].nextRefresh.Before(q[j].nextRefresh)
+}
+
+func (q authorizerTokenQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *authorizerTokenQueue) Push(x interface{}) {
+	entry := x.(*authorizerTokenEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *authorizerTokenQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*q = old[:n-1]
+	return entry
+}
+
+var _ mp.AccessTokenServer = (*AuthorizerTokenView)(nil)
+
+// AuthorizerTokenPool 里某个授权方的 mp.AccessTokenServer 视图.
+type AuthorizerTokenView struct {
+	pool            *AuthorizerTokenPool
+	authorizerAppId string
+}
+
+func (view *AuthorizerTokenView) TagCE90001AFE9C11E48611A4DB30FED8E1() {}
+
+func (view *AuthorizerTokenView) Token() (token string, err error) {
+	return view.pool.Token(view.authorizerAppId)
+}
+
+func (view *AuthorizerTokenView) TokenRefresh() (token string, err error) {
+	return view.pool.TokenRefresh(view.authorizerAppId)
+}
+
+// 授权方的 AppId.
+func (view *AuthorizerTokenView) AuthorizerAppId() string {
+	return view.authorizerAppId
+}
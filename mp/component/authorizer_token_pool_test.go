@@ -0,0 +1,281 @@
+package component
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/daemon"
+)
+
+// 模拟微信的 api_authorizer_token 接口, fail 为 true 时返回 errcode.
+type testAuthorizerTokenAPI struct {
+	mutex sync.Mutex
+	fail  bool
+	calls int
+}
+
+func (api *testAuthorizerTokenAPI) setFail(fail bool) {
+	api.mutex.Lock()
+	api.fail = fail
+	api.mutex.Unlock()
+}
+
+func newTestAuthorizerTokenPool(t *testing.T, storage RefreshTokenStorage) (*AuthorizerTokenPool, *testAuthorizerTokenAPI) {
+	api := &testAuthorizerTokenAPI{}
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			AuthorizerAppId        string `json:"authorizer_appid"`
+			AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		api.mutex.Lock()
+		api.calls++
+		fail := api.fail
+		api.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if fail {
+			io.WriteString(w, `{"errcode":61023,"errmsg":"refresh_token is invalid"}`)
+			return
+		}
+		io.WriteString(w, `{"authorizer_access_token":"at-`+request.AuthorizerAppId+`","expires_in":7200,"authorizer_refresh_token":"rt-`+request.AuthorizerAppId+`-new"}`)
+	}))
+	t.Cleanup(apiServer.Close)
+
+	target, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clt := NewClient("wxcomponent", testAccessTokenServer{}, &http.Client{Transport: testRewriteTransport{target: target}})
+
+	pool := NewAuthorizerTokenPool(clt, storage, 2)
+	t.Cleanup(func() { pool.Close(context.Background()) })
+	return pool, api
+}
+
+func TestAuthorizerTokenQueue(t *testing.T) {
+	timeNow := time.Now()
+	var queue authorizerTokenQueue
+	entries := make([]*authorizerTokenEntry, 20)
+	for i, n := range rand.Perm(len(entries)) {
+		entry := newAuthorizerTokenEntry("", "")
+		entry.nextRefresh = timeNow.Add(time.Duration(n) * time.Second)
+		entries[i] = entry
+		heap.Push(&queue, entry)
+	}
+	for i, entry := range queue {
+		if entry.index != i {
+			t.Fatalf("TestAuthorizerTokenQueue failed, have index: %d, want: %d\n", entry.index, i)
+		}
+	}
+
+	// 调整和删除之后仍然按 nextRefresh 排序
+	entries[0].nextRefresh = timeNow.Add(-time.Second)
+	heap.Fix(&queue, entries[0].index)
+	removed := entries[1]
+	heap.Remove(&queue, removed.index)
+	if removed.index != -1 {
+		t.Errorf("TestAuthorizerTokenQueue failed, have index: %d, want: -1\n", removed.index)
+	}
+	if queue[0] != entries[0] {
+		t.Errorf("TestAuthorizerTokenQueue failed, fixed entry is not the head\n")
+	}
+
+	var last time.Time
+	for queue.Len() > 0 {
+		entry := heap.Pop(&queue).(*authorizerTokenEntry)
+		if entry == removed {
+			t.Fatalf("TestAuthorizerTokenQueue failed, removed entry popped\n")
+		}
+		if entry.nextRefresh.Before(last) {
+			t.Fatalf("TestAuthorizerTokenQueue failed, have: %s, before: %s\n", entry.nextRefresh, last)
+		}
+		if entry.index != -1 {
+			t.Fatalf("TestAuthorizerTokenQueue failed, have index: %d, want: -1\n", entry.index)
+		}
+		last = entry.nextRefresh
+	}
+}
+
+func TestAuthorizerTokenPoolLazyLoad(t *testing.T) {
+	storage := &testRefreshTokenStorage{tokens: map[string]string{"wxa": "rt-wxa"}}
+	pool, api := newTestAuthorizerTokenPool(t, storage)
+
+	view := pool.AccessTokenServer("wxa")
+	if pool.Len() != 0 || storage.loads != 0 {
+		t.Fatalf("TestAuthorizerTokenPoolLazyLoad failed, loaded before Token\n")
+	}
+
+	token, err := view.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "at-wxa" {
+		t.Errorf("TestAuthorizerTokenPoolLazyLoad failed, have: %s, want: %s\n", token, "at-wxa")
+	}
+	if have := storage.get("wxa"); have != "rt-wxa-new" {
+		t.Errorf("TestAuthorizerTokenPoolLazyLoad failed, have refresh_token: %s, want: %s\n", have, "rt-wxa-new")
+	}
+
+	// 第二次使用缓存, 不再加载和调用接口
+	if _, err = view.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Len() != 1 || storage.loads != 1 || api.calls != 1 {
+		t.Errorf("TestAuthorizerTokenPoolLazyLoad failed, have len: %d, loads: %d, calls: %d, want: 1, 1, 1\n", pool.Len(), storage.loads, api.calls)
+	}
+
+	// 下一次刷新安排在过期之前
+	entry, _ := pool.entry("wxa")
+	pool.mutex.Lock()
+	next := time.Until(entry.nextRefresh)
+	index := entry.index
+	pool.mutex.Unlock()
+	expiresIn := time.Duration(7200-600) * time.Second // getAuthorizerToken 留的缓冲
+	if index < 0 || next > expiresIn || next < expiresIn-expiresIn*daemon.JitterPercent/100-time.Second {
+		t.Errorf("TestAuthorizerTokenPoolLazyLoad failed, have index: %d, next refresh: %s\n", index, next)
+	}
+
+	if _, err = pool.Token("wxnotfound"); err != ErrRefreshTokenNotFound {
+		t.Errorf("TestAuthorizerTokenPoolLazyLoad failed, have: %v, want: %v\n", err, ErrRefreshTokenNotFound)
+	}
+	if pool.Len() != 1 {
+		t.Errorf("TestAuthorizerTokenPoolLazyLoad failed, have len: %d, want: 1\n", pool.Len())
+	}
+}
+
+func TestAuthorizerTokenPoolRemoveClose(t *testing.T) {
+	storage := &testRefreshTokenStorage{tokens: map[string]string{"wxa": "rt-wxa", "wxb": "rt-wxb"}}
+	pool, _ := newTestAuthorizerTokenPool(t, storage)
+
+	for _, appId := range []string{"wxa", "wxb"} {
+		if _, err := pool.Token(appId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool.Remove("wxa")
+	pool.Remove("wxnotfound")
+	if pool.Len() != 1 {
+		t.Errorf("TestAuthorizerTokenPoolRemoveClose failed, have len: %d, want: 1\n", pool.Len())
+	}
+	pool.mutex.Lock()
+	if len(pool.queue) != 1 || pool.queue[0].authorizerAppId != "wxb" {
+		t.Errorf("TestAuthorizerTokenPoolRemoveClose failed, removed entry still in queue\n")
+	}
+	pool.mutex.Unlock()
+
+	if err := pool.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Token("wxb"); err != ErrAuthorizerTokenPoolClosed {
+		t.Errorf("TestAuthorizerTokenPoolRemoveClose failed, have: %v, want: %v\n", err, ErrAuthorizerTokenPoolClosed)
+	}
+	if err := pool.Add("wxc", "rt-wxc"); err != ErrAuthorizerTokenPoolClosed {
+		t.Errorf("TestAuthorizerTokenPoolRemoveClose failed, have: %v, want: %v\n", err, ErrAuthorizerTokenPoolClosed)
+	}
+}
+
+func TestAuthorizerTokenPoolFailureBackoff(t *testing.T) {
+	storage := &testRefreshTokenStorage{tokens: map[string]string{"wxa": "rt-wxa"}}
+	pool, api := newTestAuthorizerTokenPool(t, storage)
+	api.setFail(true)
+
+	var backoff time.Duration
+	for i := 1; i <= poolMaxFailures; i++ {
+		if _, err := pool.TokenRefresh("wxa"); err == nil {
+			t.Fatalf("TestAuthorizerTokenPoolFailureBackoff failed, want error\n")
+		}
+		backoff = daemon.NextBackoff(backoff)
+
+		entry, _ := pool.entry("wxa")
+		pool.mutex.Lock()
+		next := time.Until(entry.nextRefresh)
+		index := entry.index
+		pool.mutex.Unlock()
+
+		if i < poolMaxFailures {
+			if index < 0 || next > backoff || next < backoff-time.Second {
+				t.Errorf("TestAuthorizerTokenPoolFailureBackoff failed, failure %d have index: %d, next retry: %s, want: %s\n", i, index, next, backoff)
+			}
+		} else if index >= 0 {
+			t.Errorf("TestAuthorizerTokenPoolFailureBackoff failed, still scheduled after %d failures\n", i)
+		}
+	}
+
+	failing := pool.Failing()
+	if len(failing) != 1 {
+		t.Fatalf("TestAuthorizerTokenPoolFailureBackoff failed, have failing: %v\n", failing)
+	}
+	if have := failing[0]; have.AuthorizerAppId != "wxa" || have.Failures != poolMaxFailures || !have.Suspended || have.LastError == nil {
+		t.Errorf("TestAuthorizerTokenPoolFailureBackoff failed, have: %+v\n", have)
+	}
+
+	// 重新授权之后恢复
+	api.setFail(false)
+	if err := pool.Add("wxa", "rt-wxa-reauth"); err != nil {
+		t.Fatal(err)
+	}
+	if failing = pool.Failing(); len(failing) != 0 {
+		t.Errorf("TestAuthorizerTokenPoolFailureBackoff failed, have failing: %v\n", failing)
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for storage.get("wxa") != "rt-wxa-new" {
+		if time.Now().After(deadline) {
+			t.Fatalf("TestAuthorizerTokenPoolFailureBackoff failed, not refreshed after Add\n")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestAuthorizerTokenPoolSaveRefreshToken(t *testing.T) {
+	storage := &testRefreshTokenStorage{tokens: map[string]string{"wxa": "rt-wxa"}}
+	pool, _ := newTestAuthorizerTokenPool(t, storage)
+
+	// 保存失败不影响获取 authorizer_access_token, 下次刷新之后重试
+	storage.setFail(true)
+	if _, err := pool.Token("wxa"); err != nil {
+		t.Fatal(err)
+	}
+	if have := storage.get("wxa"); have != "rt-wxa" {
+		t.Errorf("TestAuthorizerTokenPoolSaveRefreshToken failed, have saved: %s, want: %s\n", have, "rt-wxa")
+	}
+	storage.setFail(false)
+	entry, _ := pool.entry("wxa")
+	entry.tokenGet.Lock()
+	entry.tokenGet.LastTimestamp = 0 // 跳过收敛缓存
+	entry.tokenGet.Unlock()
+	if _, err := pool.TokenRefresh("wxa"); err != nil {
+		t.Fatal(err)
+	}
+	if have := storage.get("wxa"); have != "rt-wxa-new" {
+		t.Errorf("TestAuthorizerTokenPoolSaveRefreshToken failed, have saved: %s, want: %s\n", have, "rt-wxa-new")
+	}
+
+	// Add 保存失败时不改变当前的 authorizer_refresh_token
+	storage.setFail(true)
+	if err := pool.Add("wxa", "rt-wxa-reauth"); err == nil {
+		t.Errorf("TestAuthorizerTokenPoolSaveRefreshToken failed, want save error\n")
+	}
+	entry.tokenCache.RLock()
+	refreshToken := entry.tokenCache.RefreshToken
+	entry.tokenCache.RUnlock()
+	if refreshToken != "rt-wxa-new" {
+		t.Errorf("TestAuthorizerTokenPoolSaveRefreshToken failed, have: %s, want: %s\n", refreshToken, "rt-wxa-new")
+	}
+	if err := pool.Add("wxb", "rt-wxb"); err == nil || pool.Len() != 1 {
+		t.Errorf("TestAuthorizerTokenPoolSaveRefreshToken failed, have err: %v, len: %d, want: 1\n", err, pool.Len())
+	}
+}
@@ -4,4 +4,10 @@
 // @authors     chanxuehong(chanxuehong@gmail.com)
 
 // 公众号第三方平台接口
+//
+//  小程序代码管理的接口按照调用时使用的 access_token 分在两个包里:
+//  1. 代码草稿箱和代码模版库(wxa_template.go)管理的是第三方平台自己的资源, 使用 component_access_token 调用,
+//     所以在本包, 是 Client 的方法;
+//  2. 提交代码(commit), 审核(audit), 发布(release)等操作的是某个授权的小程序, 使用该小程序的 authorizer_access_token 调用,
+//     所以在 mp/wxa 包, 一般用 AuthorizerAccessTokenServer 或者 AuthorizerTokenPool 作为 mp.AccessTokenServer.
 package component
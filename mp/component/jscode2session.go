@@ -0,0 +1,36 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"net/url"
+
+	"github.com/chanxuehong/wechat/mp"
+	"github.com/chanxuehong/wechat/mp/wxa"
+)
+
+// 第三方平台代小程序登录, 用 wx.login 得到的 code 换取 wxa.Session.
+func (clt *Client) JSCode2Session(authorizerAppId, code string) (session *wxa.Session, err error) {
+	var result struct {
+		mp.Error
+		wxa.Session
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/sns/component/jscode2session?appid=" + url.QueryEscape(authorizerAppId) +
+		"&js_code=" + url.QueryEscape(code) +
+		"&grant_type=authorization_code&component_appid=" + url.QueryEscape(clt.AppId) +
+		"&component_access_token="
+	if err = clt.GetJSON(incompleteURL, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	session = &result.Session
+	return
+}
@@ -36,9 +36,10 @@ type Request struct {
 	RawMsgXML []byte        // 消息的"明文"XML 文本
 	MixedMsg  *MixedMessage // RawMsgXML 解析后的消息
 
-	AESKey [32]byte // 当前消息 AES 加密的 key
-	Random []byte   // 当前消息加密时所用的 random, 16 bytes
-	AppId  string   // 当前消息的 AppId
+	AESKey   [32]byte // 当前消息 AES 加密的 key
+	AESKeyId string   // 解密当前消息的 AES Key 的 Id, 见 AESKeyRing
+	Random   []byte   // 当前消息加密时所用的 random, 16 bytes
+	AppId    string   // 当前消息的 AppId
 }
 
 // 微信服务器推送过来的消息(事件)的合集.
@@ -51,4 +52,8 @@ type MixedMessage struct {
 
 	VerifyTicket    string `xml:"ComponentVerifyTicket" json:"ComponentVerifyTicket"`
 	AuthorizerAppId string `xml:"AuthorizerAppid"       json:"AuthorizerAppid"`
+
+	AuthorizationCode            string `xml:"AuthorizationCode"            json:"AuthorizationCode"`
+	AuthorizationCodeExpiredTime int64  `xml:"AuthorizationCodeExpiredTime" json:"AuthorizationCodeExpiredTime"`
+	PreAuthCode                  string `xml:"PreAuthCode"                  json:"PreAuthCode"`
 }
@@ -7,8 +7,10 @@ package component
 
 const (
 	// 微信服务器推送过来的消息类型
-	MsgTypeVerifyTicket = "component_verify_ticket" // 推送 component_verify_ticket 协议
-	MsgTypeUnauthorized = "unauthorized"            // 取消授权的通知
+	MsgTypeVerifyTicket     = "component_verify_ticket" // 推送 component_verify_ticket 协议
+	MsgTypeUnauthorized     = "unauthorized"            // 取消授权的通知
+	MsgTypeAuthorized       = "authorized"              // 授权成功的通知
+	MsgTypeUpdateAuthorized = "updateauthorized"        // 授权更新的通知
 )
 
 type VerifyTicketMessage struct {
@@ -48,3 +50,35 @@ func GetUnauthorizedMessage(msg *MixedMessage) *UnauthorizedMessage {
 		AuthorizerAppId: msg.AuthorizerAppId,
 	}
 }
+
+type AuthorizedMessage struct {
+	XMLName struct{} `xml:"xml" json:"-"`
+
+	AppId      string `xml:"AppId"      json:"AppId"`
+	CreateTime int64  `xml:"CreateTime" json:"CreateTime"`
+	InfoType   string `xml:"InfoType"   json:"InfoType"`
+
+	AuthorizerAppId              string `xml:"AuthorizerAppid"              json:"AuthorizerAppid"`
+	AuthorizationCode            string `xml:"AuthorizationCode"            json:"AuthorizationCode"`            // 授权码, 可用于 QueryAuth
+	AuthorizationCodeExpiredTime int64  `xml:"AuthorizationCodeExpiredTime" json:"AuthorizationCodeExpiredTime"` // 授权码的过期时间, unixtime
+	PreAuthCode                  string `xml:"PreAuthCode"                  json:"PreAuthCode"`                  // 发起授权时的预授权码
+}
+
+func GetAuthorizedMessage(msg *MixedMessage) *AuthorizedMessage {
+	return &AuthorizedMessage{
+		AppId:                        msg.AppId,
+		CreateTime:                   msg.CreateTime,
+		InfoType:                     msg.InfoType,
+		AuthorizerAppId:              msg.AuthorizerAppId,
+		AuthorizationCode:            msg.AuthorizationCode,
+		AuthorizationCodeExpiredTime: msg.AuthorizationCodeExpiredTime,
+		PreAuthCode:                  msg.PreAuthCode,
+	}
+}
+
+// 授权更新的通知, 字段同授权成功的通知.
+type UpdateAuthorizedMessage AuthorizedMessage
+
+func GetUpdateAuthorizedMessage(msg *MixedMessage) *UpdateAuthorizedMessage {
+	return (*UpdateAuthorizedMessage)(GetAuthorizedMessage(msg))
+}
@@ -0,0 +1,219 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chanxuehong/util/security"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+var (
+	ErrOnboardingStateMismatch = errors.New("onboarding state mismatch")
+	ErrOnboardingCanceled      = errors.New("onboarding canceled, no auth_code")
+)
+
+const (
+	onboardingStateCookieName = "wechat_component_onboarding_state"
+
+	// 授权回调只带 auth_code 和 expires_in, 不保证带回 state, 所以 state 放在 redirect_uri 的查询参数里
+	onboardingStateQueryName = "onboarding_state"
+)
+
+// 公众号授权给第三方平台成功的事件.
+type OnboardingEvent struct {
+	Time              time.Time
+	AuthorizationInfo *AuthorizationInfo // QueryAuth 的结果, 包括 authorizer_refresh_token
+	AuthorizerInfo    *AuthorizerInfoEx  // GetAuthorizerInfo 的结果, 授权方的账户信息
+}
+
+// 授权信息的存储.
+type AuthorizationStore interface {
+	SaveAuthorization(event *OnboardingEvent) (err error)
+}
+
+type AuthorizationStoreFunc func(event *OnboardingEvent) error
+
+func (fn AuthorizationStoreFunc) SaveAuthorization(event *OnboardingEvent) error {
+	return fn(event)
+}
+
+// 把 RefreshTokenStorage 适配为 AuthorizationStore, 只保存 authorizer_refresh_token.
+func NewRefreshTokenAuthorizationStore(storage RefreshTokenStorage) AuthorizationStore {
+	if storage == nil {
+		panic("nil RefreshTokenStorage")
+	}
+	return AuthorizationStoreFunc(func(event *OnboardingEvent) error {
+		info := event.AuthorizationInfo
+		return storage.SaveRefreshToken(info.AuthorizerAppId, info.RefreshToken)
+	})
+}
+
+// 授权成功之后的处理接口, 授权信息已经保存到 AuthorizationStore, 负责回复授权方的浏览器, 比如跳转到后台首页.
+type OnboardingHandler interface {
+	ServeOnboarding(w http.ResponseWriter, r *http.Request, event *OnboardingEvent)
+}
+
+type OnboardingHandlerFunc func(http.ResponseWriter, *http.Request, *OnboardingEvent)
+
+func (fn OnboardingHandlerFunc) ServeOnboarding(w http.ResponseWriter, r *http.Request, event *OnboardingEvent) {
+	fn(w, r, event)
+}
+
+// 公众号授权给第三方平台的流程.
+//  StartHandler:    创建预授权码, 跳转到授权页面;
+//  CallbackHandler: 授权后的回调, 用 auth_code 换取授权信息和授权方的账户信息, 保存并通知 OnboardingHandler.
+//  两个 handler 之间用一个 HttpOnly 的 cookie 保存 state, 同时 state 作为 redirect_uri 的查询参数
+//  由微信原样带回, CallbackHandler 比较两者, 防止 CSRF.
+type Onboarding struct {
+	client      *Client
+	redirectURI *url.URL
+	secure      bool // cookie 是否只通过 https 发送, 由 redirectURI 的 scheme 决定
+	store       AuthorizationStore
+	handler     OnboardingHandler
+	errHandler  mp.ErrorHandler
+}
+
+// 创建一个新的 Onboarding.
+//  redirectURI: CallbackHandler 的完整 URL, 必须在第三方平台的授权回调域名下;
+//               scheme 为 https 时 cookie 设置为 Secure(即使 TLS 在前面的反向代理上终止)
+//  store:       保存授权信息
+//  handler:     授权成功之后的处理, 可以为 nil, 此时回复 "success"
+//  errHandler:  出错时的处理, 可以为 nil, 此时使用 mp.DefaultErrorHandler
+func NewOnboarding(clt *Client, redirectURI string, store AuthorizationStore, handler OnboardingHandler, errHandler mp.ErrorHandler) *Onboarding {
+	if clt == nil {
+		panic("nil Client")
+	}
+	if redirectURI == "" {
+		panic("empty redirectURI")
+	}
+	redirectURL, err := url.Parse(redirectURI)
+	if err != nil || !redirectURL.IsAbs() {
+		panic("invalid redirectURI: " + redirectURI)
+	}
+	if store == nil {
+		panic("nil AuthorizationStore")
+	}
+	if errHandler == nil {
+		errHandler = mp.DefaultErrorHandler
+	}
+
+	return &Onboarding{
+		client:      clt,
+		redirectURI: redirectURL,
+		secure:      redirectURL.Scheme == "https",
+		store:       store,
+		handler:     handler,
+		errHandler:  errHandler,
+	}
+}
+
+// 发起授权的 http.Handler, 跳转到微信的授权页面.
+func (o *Onboarding) StartHandler() http.Handler {
+	return http.HandlerFunc(o.serveStart)
+}
+
+// 授权回调的 http.Handler, 对应 NewOnboarding 的 redirectURI.
+func (o *Onboarding) CallbackHandler() http.Handler {
+	return http.HandlerFunc(o.serveCallback)
+}
+
+func (o *Onboarding) serveStart(w http.ResponseWriter, r *http.Request) {
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		o.errHandler.ServeError(w, r, err)
+		return
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	preAuthCode, err := o.client.CreatePreAuthCode()
+	if err != nil {
+		o.errHandler.ServeError(w, r, err)
+		return
+	}
+
+	maxAge := int(preAuthCode.ExpiresIn) // state 和预授权码同时过期
+	if maxAge <= 0 {
+		maxAge = 600
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     onboardingStateCookieName,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   o.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, AuthCodeURL(o.client.AppId, preAuthCode.Value, o.callbackURL(state), state), http.StatusFound)
+}
+
+// 带 state 查询参数的 redirectURI.
+func (o *Onboarding) callbackURL(state string) string {
+	callbackURL := *o.redirectURI
+	queryValues := callbackURL.Query()
+	queryValues.Set(onboardingStateQueryName, state)
+	callbackURL.RawQuery = queryValues.Encode()
+	return callbackURL.String()
+}
+
+func (o *Onboarding) serveCallback(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+
+	cookie, err := r.Cookie(onboardingStateCookieName)
+	if err != nil || cookie.Value == "" || !security.SecureCompareString(queryValues.Get(onboardingStateQueryName), cookie.Value) {
+		o.errHandler.ServeError(w, r, ErrOnboardingStateMismatch)
+		return
+	}
+	// state 只能使用一次
+	http.SetCookie(w, &http.Cookie{
+		Name:     onboardingStateCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   o.secure,
+		HttpOnly: true,
+	})
+
+	authCode := queryValues.Get("auth_code")
+	if authCode == "" {
+		o.errHandler.ServeError(w, r, ErrOnboardingCanceled)
+		return
+	}
+
+	authorizationInfo, err := o.client.QueryAuth(authCode)
+	if err != nil {
+		o.errHandler.ServeError(w, r, err)
+		return
+	}
+	authorizerInfo, err := o.client.GetAuthorizerInfo(authorizationInfo.AuthorizerAppId)
+	if err != nil {
+		o.errHandler.ServeError(w, r, err)
+		return
+	}
+
+	event := &OnboardingEvent{
+		Time:              time.Now(),
+		AuthorizationInfo: authorizationInfo,
+		AuthorizerInfo:    authorizerInfo,
+	}
+	if err = o.store.SaveAuthorization(event); err != nil {
+		o.errHandler.ServeError(w, r, err)
+		return
+	}
+
+	if o.handler == nil {
+		w.Write([]byte("success"))
+		return
+	}
+	o.handler.ServeOnboarding(w, r, event)
+}
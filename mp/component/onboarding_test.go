@@ -0,0 +1,193 @@
+package component
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 模拟微信的 api_create_preauthcode, api_query_auth, api_get_authorizer_info 接口.
+func newTestComponentClient(t *testing.T) *Client {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/cgi-bin/component/api_create_preauthcode":
+			io.WriteString(w, `{"pre_auth_code":"test-pre-auth-code","expires_in":600}`)
+		case "/cgi-bin/component/api_query_auth":
+			io.WriteString(w, `{"authorization_info":{"authorizer_appid":"wxauthorizer","authorizer_access_token":"at","expires_in":7200,"authorizer_refresh_token":"rt","func_info":[]}}`)
+		case "/cgi-bin/component/api_get_authorizer_info":
+			io.WriteString(w, `{"authorizer_info":{"nick_name":"test"},"qrcode_url":"","authorization_info":{"authorizer_appid":"wxauthorizer","func_info":[]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(apiServer.Close)
+
+	target, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient := &http.Client{Transport: testRewriteTransport{target: target}}
+	return NewClient("wxcomponent", testAccessTokenServer{}, httpClient)
+}
+
+type testOnboardingResult struct {
+	err   error
+	saved *OnboardingEvent
+}
+
+func newTestOnboarding(t *testing.T, redirectURI string) (*Onboarding, *testOnboardingResult) {
+	result := &testOnboardingResult{}
+	store := AuthorizationStoreFunc(func(event *OnboardingEvent) error {
+		result.saved = event
+		return nil
+	})
+	errHandler := mp.ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		result.err = err
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	})
+	return NewOnboarding(newTestComponentClient(t), redirectURI, store, nil, errHandler), result
+}
+
+// 发起授权, 返回 cookie 和跳转到的 redirect_uri.
+func testOnboardingStart(t *testing.T, o *Onboarding) (cookie *http.Cookie, callbackURL *url.URL) {
+	w := httptest.NewRecorder()
+	o.StartHandler().ServeHTTP(w, httptest.NewRequest("GET", "/onboarding/start", nil))
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("TestOnboardingStart failed, have status: %d, want: %d\n", resp.StatusCode, http.StatusFound)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != onboardingStateCookieName || cookies[0].Value == "" {
+		t.Fatalf("TestOnboardingStart failed, have cookies: %v\n", cookies)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := location.Query().Get("pre_auth_code"); have != "test-pre-auth-code" {
+		t.Fatalf("TestOnboardingStart failed, have pre_auth_code: %s, want: %s\n", have, "test-pre-auth-code")
+	}
+	callbackURL, err = url.Parse(location.Query().Get("redirect_uri"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookies[0], callbackURL
+}
+
+// 模拟微信带着 auth_code 跳转回 redirect_uri, 只保留 redirect_uri 原有的查询参数.
+func testOnboardingCallback(o *Onboarding, callbackURL *url.URL, authCode string, cookie *http.Cookie) *http.Response {
+	u := *callbackURL
+	queryValues := u.Query()
+	if authCode != "" {
+		queryValues.Set("auth_code", authCode)
+		queryValues.Set("expires_in", "600")
+	}
+	u.RawQuery = queryValues.Encode()
+
+	r := httptest.NewRequest("GET", u.String(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	o.CallbackHandler().ServeHTTP(w, r)
+	return w.Result()
+}
+
+func TestOnboarding(t *testing.T) {
+	o, result := newTestOnboarding(t, "https://example.com/onboarding/callback?from=test")
+
+	cookie, callbackURL := testOnboardingStart(t, o)
+	if !cookie.Secure {
+		t.Errorf("TestOnboarding failed, cookie is not Secure for https redirect_uri\n")
+	}
+	if have := callbackURL.Query().Get(onboardingStateQueryName); have != cookie.Value {
+		t.Errorf("TestOnboarding failed, have state: %s, want: %s\n", have, cookie.Value)
+	}
+	if have := callbackURL.Query().Get("from"); have != "test" {
+		t.Errorf("TestOnboarding failed, have from: %s, want: %s\n", have, "test")
+	}
+
+	resp := testOnboardingCallback(o, callbackURL, "test-auth-code", cookie)
+	body, _ := io.ReadAll(resp.Body)
+	if result.err != nil {
+		t.Fatalf("TestOnboarding failed, have error: %v\n", result.err)
+	}
+	if string(body) != "success" {
+		t.Errorf("TestOnboarding failed, have body: %s, want: %s\n", body, "success")
+	}
+	if result.saved == nil {
+		t.Fatalf("TestOnboarding failed, authorization not saved\n")
+	}
+	if have := result.saved.AuthorizationInfo.RefreshToken; have != "rt" {
+		t.Errorf("TestOnboarding failed, have refresh_token: %s, want: %s\n", have, "rt")
+	}
+	if have := result.saved.AuthorizerInfo.AuthorizerInfo.NickName; have != "test" {
+		t.Errorf("TestOnboarding failed, have nick_name: %s, want: %s\n", have, "test")
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 || !cookies[0].Secure {
+		t.Errorf("TestOnboarding failed, state cookie not cleared: %v\n", cookies)
+	}
+}
+
+func TestOnboardingInsecureRedirectURI(t *testing.T) {
+	o, _ := newTestOnboarding(t, "http://example.com/onboarding/callback")
+
+	cookie, _ := testOnboardingStart(t, o)
+	if cookie.Secure {
+		t.Errorf("TestOnboardingInsecureRedirectURI failed, cookie is Secure for http redirect_uri\n")
+	}
+}
+
+func TestOnboardingStateMismatch(t *testing.T) {
+	o, result := newTestOnboarding(t, "https://example.com/onboarding/callback")
+
+	cookie, callbackURL := testOnboardingStart(t, o)
+
+	// 没有 cookie
+	testOnboardingCallback(o, callbackURL, "test-auth-code", nil)
+	if result.err != ErrOnboardingStateMismatch {
+		t.Errorf("TestOnboardingStateMismatch failed, have: %v, want: %v\n", result.err, ErrOnboardingStateMismatch)
+	}
+
+	// state 不一致
+	result.err = nil
+	forged := &http.Cookie{Name: cookie.Name, Value: strings.Repeat("0", len(cookie.Value))}
+	testOnboardingCallback(o, callbackURL, "test-auth-code", forged)
+	if result.err != ErrOnboardingStateMismatch {
+		t.Errorf("TestOnboardingStateMismatch failed, have: %v, want: %v\n", result.err, ErrOnboardingStateMismatch)
+	}
+
+	// redirect_uri 上没有 state
+	result.err = nil
+	noState := *callbackURL
+	noState.RawQuery = ""
+	testOnboardingCallback(o, &noState, "test-auth-code", cookie)
+	if result.err != ErrOnboardingStateMismatch {
+		t.Errorf("TestOnboardingStateMismatch failed, have: %v, want: %v\n", result.err, ErrOnboardingStateMismatch)
+	}
+
+	if result.saved != nil {
+		t.Errorf("TestOnboardingStateMismatch failed, authorization saved\n")
+	}
+}
+
+func TestOnboardingCanceled(t *testing.T) {
+	o, result := newTestOnboarding(t, "https://example.com/onboarding/callback")
+
+	cookie, callbackURL := testOnboardingStart(t, o)
+	testOnboardingCallback(o, callbackURL, "", cookie)
+	if result.err != ErrOnboardingCanceled {
+		t.Errorf("TestOnboardingCanceled failed, have: %v, want: %v\n", result.err, ErrOnboardingCanceled)
+	}
+	if result.saved != nil {
+		t.Errorf("TestOnboardingCanceled failed, authorization saved\n")
+	}
+}
@@ -0,0 +1,36 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"errors"
+)
+
+var ErrRefreshTokenNotFound = errors.New("authorizer_refresh_token not found")
+
+// authorizer_refresh_token 的持久化存储.
+//  微信刷新 authorizer_access_token 时可能会返回新的 authorizer_refresh_token, 旧的随之失效,
+//  如果只保存在内存里, 重启之后就无法再获取该授权方的 authorizer_access_token 了.
+type RefreshTokenStorage interface {
+	// 读取授权方的 authorizer_refresh_token, 不存在时返回 ErrRefreshTokenNotFound.
+	LoadRefreshToken(authorizerAppId string) (refreshToken string, err error)
+
+	// 保存授权方新的 authorizer_refresh_token, 每次得到新的 authorizer_refresh_token 时都会调用.
+	SaveRefreshToken(authorizerAppId, refreshToken string) (err error)
+}
+
+// 使用授权码换取公众号的授权信息, 并把 authorizer_refresh_token 保存到 storage.
+func (clt *Client) QueryAuthAndSave(authCode string, storage RefreshTokenStorage) (info *AuthorizationInfo, err error) {
+	if storage == nil {
+		err = errors.New("nil RefreshTokenStorage")
+		return
+	}
+	if info, err = clt.QueryAuth(authCode); err != nil {
+		return
+	}
+	err = storage.SaveRefreshToken(info.AuthorizerAppId, info.RefreshToken)
+	return
+}
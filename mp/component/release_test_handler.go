@@ -0,0 +1,113 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp"
+	"github.com/chanxuehong/wechat/mp/message/custom"
+	"github.com/chanxuehong/wechat/mp/message/response"
+)
+
+const (
+	// 全网发布接入检测使用的专用测试公众号
+	ReleaseTestAppId = "wx570bc396a51b8ff8"
+	ReleaseTestOriId = "gh_3c884a361561"
+
+	releaseTestTextContent     = "TESTCOMPONENT_MSG_TYPE_TEXT"
+	releaseTestQueryAuthPrefix = "QUERY_AUTH_CODE:"
+)
+
+// 创建全网发布接入检测的 mp.MessageHandler.
+//  发给测试公众号 ReleaseTestOriId 的消息按检测要求回复:
+//  1. 事件消息: 被动回复文本 Event + "from_callback";
+//  2. 文本消息 TESTCOMPONENT_MSG_TYPE_TEXT: 被动回复文本 TESTCOMPONENT_MSG_TYPE_TEXT_callback;
+//  3. 文本消息 QUERY_AUTH_CODE:$query_auth_code$: 立即回复空串, 然后异步用 $query_auth_code$ 调用 QueryAuth,
+//     以测试公众号的身份发送客服消息 $query_auth_code$_from_api 给用户.
+//  其他消息交给 next 处理, next 为 nil 时回复空串.
+func NewReleaseTestHandler(clt *Client, next mp.MessageHandler) mp.MessageHandler {
+	if clt == nil {
+		panic("nil Client")
+	}
+
+	return mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {
+		msg := r.MixedMsg
+		if msg.ToUserName != ReleaseTestOriId {
+			if next != nil {
+				next.ServeMessage(w, r)
+			}
+			return
+		}
+
+		switch {
+		case msg.MsgType == "event":
+			writeReleaseTestText(w, r, msg.Event+"from_callback")
+		case msg.MsgType == "text" && msg.Content == releaseTestTextContent:
+			writeReleaseTestText(w, r, releaseTestTextContent+"_callback")
+		case msg.MsgType == "text" && strings.HasPrefix(msg.Content, releaseTestQueryAuthPrefix):
+			queryAuthCode := strings.TrimPrefix(msg.Content, releaseTestQueryAuthPrefix)
+			go sendReleaseTestCustomText(clt, queryAuthCode, msg.FromUserName)
+		default:
+			if next != nil {
+				next.ServeMessage(w, r)
+			}
+		}
+	})
+}
+
+func writeReleaseTestText(w http.ResponseWriter, r *mp.Request, content string) {
+	text := response.NewText(r.MixedMsg.FromUserName, r.MixedMsg.ToUserName, time.Now().Unix(), content)
+	if err := mp.WriteResponse(w, r, text); err != nil {
+		mp.LogInfoln("[WECHAT] release test: write response failed:", err)
+	}
+}
+
+// 用 queryAuthCode 换取测试公众号的 authorizer_access_token, 然后发送客服消息.
+func sendReleaseTestCustomText(clt *Client, queryAuthCode, toUser string) {
+	info, err := clt.QueryAuth(queryAuthCode)
+	if err != nil {
+		mp.LogInfoln("[WECHAT] release test: QueryAuth failed:", err)
+		return
+	}
+
+	customClient := custom.NewClient(staticAccessTokenServer(info.Token), clt.HttpClient)
+	if err = customClient.SendText(custom.NewText(toUser, queryAuthCode+"_from_api", "")); err != nil {
+		mp.LogInfoln("[WECHAT] release test: send custom message failed:", err)
+	}
+}
+
+// 返回固定 access_token 的 mp.AccessTokenServer, 用于一次性的调用.
+type staticAccessTokenServer string
+
+func (srv staticAccessTokenServer) Token() (string, error) {
+	return string(srv), nil
+}
+func (srv staticAccessTokenServer) TokenRefresh() (string, error) {
+	return string(srv), nil
+}
+func (srv staticAccessTokenServer) TagCE90001AFE9C11E48611A4DB30FED8E1() {}
+
+// 包装 AuthorizerHandlerRegistry, 测试公众号 ReleaseTestAppId 使用 NewReleaseTestHandler(clt, nil),
+// 其他授权方交给 registry 查找, 用于 NewAuthorizerMessageFrontend.
+func NewReleaseTestHandlerRegistry(clt *Client, registry AuthorizerHandlerRegistry) AuthorizerHandlerRegistry {
+	if registry == nil {
+		panic("nil AuthorizerHandlerRegistry")
+	}
+
+	handler := &AuthorizerHandler{
+		OriId:          ReleaseTestOriId,
+		MessageHandler: NewReleaseTestHandler(clt, nil),
+	}
+	return AuthorizerHandlerRegistryFunc(func(authorizerAppId string) (*AuthorizerHandler, error) {
+		if authorizerAppId == ReleaseTestAppId {
+			return handler, nil
+		}
+		return registry.AuthorizerHandler(authorizerAppId)
+	})
+}
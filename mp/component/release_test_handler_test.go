@@ -0,0 +1,150 @@
+package component
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp"
+	"github.com/chanxuehong/wechat/mp/message/response"
+)
+
+type testReleaseTestCustomMessage struct {
+	AccessToken string
+	Body        string
+}
+
+// 模拟微信的 api_query_auth 和客服消息接口, 收到的客服消息发送到返回的 chan.
+func newTestReleaseTestClient(t *testing.T) (*Client, chan testReleaseTestCustomMessage) {
+	customChan := make(chan testReleaseTestCustomMessage, 1)
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/cgi-bin/component/api_query_auth":
+			io.WriteString(w, `{"authorization_info":{"authorizer_appid":"`+ReleaseTestAppId+`","authorizer_access_token":"at-release","expires_in":7200,"authorizer_refresh_token":"rt","func_info":[]}}`)
+		case "/cgi-bin/message/custom/send":
+			body, _ := ioutil.ReadAll(r.Body)
+			customChan <- testReleaseTestCustomMessage{AccessToken: r.URL.Query().Get("access_token"), Body: string(body)}
+			io.WriteString(w, `{"errcode":0,"errmsg":"ok"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(apiServer.Close)
+
+	target, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient("wxcomponent", testAccessTokenServer{}, &http.Client{Transport: testRewriteTransport{target: target}}), customChan
+}
+
+func testServeReleaseTest(handler mp.MessageHandler, msg *mp.MixedMessage) *httptest.ResponseRecorder {
+	msg.FromUserName = "user"
+	msg.CreateTime = 1
+	w := httptest.NewRecorder()
+	handler.ServeMessage(w, &mp.Request{MixedMsg: msg})
+	return w
+}
+
+func TestReleaseTestHandlerReply(t *testing.T) {
+	clt, _ := newTestReleaseTestClient(t)
+	var nextCalled int
+	next := mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {
+		nextCalled++
+	})
+	handler := NewReleaseTestHandler(clt, next)
+
+	tests := []struct {
+		msg  *mp.MixedMessage
+		want string
+	}{
+		{
+			msg:  &mp.MixedMessage{MessageHeader: mp.MessageHeader{ToUserName: ReleaseTestOriId, MsgType: "event"}, Event: "LOCATION"},
+			want: "LOCATIONfrom_callback",
+		},
+		{
+			msg:  &mp.MixedMessage{MessageHeader: mp.MessageHeader{ToUserName: ReleaseTestOriId, MsgType: "text"}, Content: "TESTCOMPONENT_MSG_TYPE_TEXT"},
+			want: "TESTCOMPONENT_MSG_TYPE_TEXT_callback",
+		},
+	}
+	for _, test := range tests {
+		w := testServeReleaseTest(handler, test.msg)
+		var text response.Text
+		if err := xml.Unmarshal(w.Body.Bytes(), &text); err != nil {
+			t.Fatal(err)
+		}
+		if text.Content != test.want || text.ToUserName != "user" || text.FromUserName != ReleaseTestOriId {
+			t.Errorf("TestReleaseTestHandlerReply failed, have: %+v, want content: %s\n", text, test.want)
+		}
+	}
+	if nextCalled != 0 {
+		t.Errorf("TestReleaseTestHandlerReply failed, next called %d times, want: 0\n", nextCalled)
+	}
+
+	// 其他公众号的消息和测试公众号的其他消息交给 next
+	testServeReleaseTest(handler, &mp.MixedMessage{MessageHeader: mp.MessageHeader{ToUserName: "gh_other", MsgType: "event"}, Event: "LOCATION"})
+	testServeReleaseTest(handler, &mp.MixedMessage{MessageHeader: mp.MessageHeader{ToUserName: ReleaseTestOriId, MsgType: "text"}, Content: "hello"})
+	if nextCalled != 2 {
+		t.Errorf("TestReleaseTestHandlerReply failed, next called %d times, want: 2\n", nextCalled)
+	}
+
+	// next 为 nil 时回复空串
+	w := testServeReleaseTest(NewReleaseTestHandler(clt, nil), &mp.MixedMessage{MessageHeader: mp.MessageHeader{ToUserName: "gh_other", MsgType: "text"}, Content: "hello"})
+	if w.Body.Len() != 0 {
+		t.Errorf("TestReleaseTestHandlerReply failed, have: %s, want empty reply\n", w.Body.String())
+	}
+}
+
+func TestReleaseTestHandlerQueryAuth(t *testing.T) {
+	clt, customChan := newTestReleaseTestClient(t)
+	handler := NewReleaseTestHandler(clt, nil)
+
+	// 立即回复空串, 异步发送客服消息
+	w := testServeReleaseTest(handler, &mp.MixedMessage{MessageHeader: mp.MessageHeader{ToUserName: ReleaseTestOriId, MsgType: "text"}, Content: "QUERY_AUTH_CODE:query-auth-code"})
+	if w.Body.Len() != 0 {
+		t.Errorf("TestReleaseTestHandlerQueryAuth failed, have: %s, want empty reply\n", w.Body.String())
+	}
+
+	select {
+	case msg := <-customChan:
+		if msg.AccessToken != "at-release" {
+			t.Errorf("TestReleaseTestHandlerQueryAuth failed, have access_token: %s, want: %s\n", msg.AccessToken, "at-release")
+		}
+		if !strings.Contains(msg.Body, `"touser":"user"`) || !strings.Contains(msg.Body, "query-auth-code_from_api") {
+			t.Errorf("TestReleaseTestHandlerQueryAuth failed, have custom message: %s\n", msg.Body)
+		}
+	case <-time.After(time.Second * 5):
+		t.Errorf("TestReleaseTestHandlerQueryAuth failed, custom message not sent\n")
+	}
+}
+
+func TestReleaseTestHandlerRegistry(t *testing.T) {
+	clt, _ := newTestReleaseTestClient(t)
+	registry := NewReleaseTestHandlerRegistry(clt, AuthorizerHandlerRegistryFunc(func(authorizerAppId string) (*AuthorizerHandler, error) {
+		if authorizerAppId == "wxa" {
+			return &AuthorizerHandler{OriId: "gh_wxa", MessageHandler: mp.MessageHandlerFunc(func(w http.ResponseWriter, r *mp.Request) {})}, nil
+		}
+		return nil, mp.ErrServerNotFound
+	}))
+
+	handler, err := registry.AuthorizerHandler(ReleaseTestAppId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handler.OriId != ReleaseTestOriId || handler.MessageHandler == nil {
+		t.Errorf("TestReleaseTestHandlerRegistry failed, have: %+v\n", handler)
+	}
+	if handler, err = registry.AuthorizerHandler("wxa"); err != nil || handler.OriId != "gh_wxa" {
+		t.Errorf("TestReleaseTestHandlerRegistry failed, have: %+v, %v\n", handler, err)
+	}
+	if _, err = registry.AuthorizerHandler("wxnotfound"); err != mp.ErrServerNotFound {
+		t.Errorf("TestReleaseTestHandlerRegistry failed, have: %v, want: %v\n", err, mp.ErrServerNotFound)
+	}
+}
@@ -106,23 +106,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 				return
 			}
 
-			aesKey := srv.CurrentAESKey()
-			random, rawMsgXML, aesAppId, err := util.AESDecryptMsg(encryptedMsgBytes, aesKey)
+			random, rawMsgXML, aesAppId, aesKey, err := mp.AESDecryptMsg(srv, encryptedMsgBytes)
 			if err != nil {
-				// 尝试用上一次的 AESKey 来解密
-				lastAESKey, isLastAESKeyValid := srv.LastAESKey()
-				if !isLastAESKeyValid {
-					errHandler.ServeError(w, r, err)
-					return
-				}
-
-				aesKey = lastAESKey // NOTE
-
-				random, rawMsgXML, aesAppId, err = util.AESDecryptMsg(encryptedMsgBytes, aesKey)
-				if err != nil {
-					errHandler.ServeError(w, r, err)
-					return
-				}
+				errHandler.ServeError(w, r, err)
+				return
 			}
 			if haveAppId != string(aesAppId) {
 				err = fmt.Errorf("the RequestHttpBody's ToUserName(==%s) mismatch the AppId with aes encrypt(==%s)", haveAppId, aesAppId)
@@ -161,9 +148,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 				RawMsgXML: rawMsgXML,
 				MixedMsg:  &mixedMsg,
 
-				AESKey: aesKey,
-				Random: random,
-				AppId:  haveAppId,
+				AESKey:   aesKey.Key,
+				AESKeyId: aesKey.Id,
+				Random:   random,
+				AppId:    haveAppId,
 			}
 			srv.MessageHandler().ServeMessage(w, req)
 
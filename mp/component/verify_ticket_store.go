@@ -0,0 +1,160 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 微信服务器每隔 10 分钟推送一次 component_verify_ticket, 超过这个时间没有更新说明推送出了问题.
+const DefaultVerifyTicketStaleAfter = time.Minute * 30
+
+// 保存的 component_verify_ticket.
+type VerifyTicket struct {
+	Ticket    string    `json:"ticket"`
+	UpdatedAt time.Time `json:"updated_at"` // 最后一次收到推送的时间
+}
+
+// component_verify_ticket 的存储, 比如文件, redis, 数据库; 多个副本共享同一个存储即可共享 component_verify_ticket.
+type VerifyTicketStore interface {
+	// 读取第三方平台的 component_verify_ticket, 不存在时返回 ErrNotFound.
+	LoadVerifyTicket(appId string) (ticket *VerifyTicket, err error)
+
+	// 保存第三方平台的 component_verify_ticket.
+	SaveVerifyTicket(appId string, ticket *VerifyTicket) (err error)
+}
+
+var _ VerifyTicketGetter = (*StoreVerifyTicketCache)(nil)
+
+// 基于 VerifyTicketStore 的 VerifyTicketGetter, 重启后不丢失 component_verify_ticket.
+//  component_verify_ticket 缓存在内存里, 只有内存里没有或者已经过时才读取 VerifyTicketStore, 见 util.TicketCache.
+//  读取到的 component_verify_ticket 超过 staleAfter 没有更新时记录日志并通知 OnStale 回调, 但是仍然返回它.
+type StoreVerifyTicketCache struct {
+	cache *util.TicketCache
+
+	// component_verify_ticket 过时的回调, 可以为 nil, 需要在使用之前设置.
+	OnStale func(appId string, ticket *VerifyTicket)
+}
+
+// 创建一个新的 StoreVerifyTicketCache, staleAfter <= 0 时为 DefaultVerifyTicketStaleAfter.
+func NewStoreVerifyTicketCache(store VerifyTicketStore, staleAfter time.Duration) *StoreVerifyTicketCache {
+	if store == nil {
+		panic("nil VerifyTicketStore")
+	}
+	if staleAfter <= 0 {
+		staleAfter = DefaultVerifyTicketStaleAfter
+	}
+	cache := &StoreVerifyTicketCache{}
+	cache.cache = util.NewTicketCache(verifyTicketStore{store}, staleAfter, cache.onStale)
+	return cache
+}
+
+// 创建一个基于文件的 StoreVerifyTicketCache, 见 NewFileVerifyTicketStore.
+func NewFileVerifyTicketCache(dir string, staleAfter time.Duration) (cache *StoreVerifyTicketCache, err error) {
+	store, err := NewFileVerifyTicketStore(dir)
+	if err != nil {
+		return
+	}
+	cache = NewStoreVerifyTicketCache(store, staleAfter)
+	return
+}
+
+func (cache *StoreVerifyTicketCache) Tag9AEACC95FE9911E4B5A4A4DB30FED8E1() {}
+
+// 保存微信服务器推送过来的 component_verify_ticket.
+func (cache *StoreVerifyTicketCache) SetComponentVerifyTicket(appId string, ticket string) (err error) {
+	return cache.cache.Set(appId, ticket)
+}
+
+func (cache *StoreVerifyTicketCache) GetComponentVerifyTicket(appId string) (ticket string, err error) {
+	verifyTicket, err := cache.cache.Get(appId)
+	if err != nil {
+		return "", verifyTicketError(err)
+	}
+	ticket = verifyTicket.Ticket
+	return
+}
+
+// 返回第三方平台的 component_verify_ticket 以及它是否过时.
+func (cache *StoreVerifyTicketCache) Status(appId string) (ticket *VerifyTicket, stale bool, err error) {
+	verifyTicket, stale, err := cache.cache.Status(appId)
+	if err != nil {
+		return nil, false, verifyTicketError(err)
+	}
+	ticket = (*VerifyTicket)(verifyTicket)
+	return
+}
+
+func (cache *StoreVerifyTicketCache) onStale(appId string, ticket *util.Ticket) {
+	mp.LogInfoln("[WECHAT] component_verify_ticket is stale, appid:", appId, "updated_at:", ticket.UpdatedAt)
+	if cache.OnStale != nil {
+		cache.OnStale(appId, (*VerifyTicket)(ticket))
+	}
+}
+
+func verifyTicketError(err error) error {
+	if err == util.ErrTicketNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// 把 VerifyTicketStore 适配为 util.TicketStore.
+type verifyTicketStore struct {
+	store VerifyTicketStore
+}
+
+func (store verifyTicketStore) LoadTicket(appId string) (ticket *util.Ticket, err error) {
+	verifyTicket, err := store.store.LoadVerifyTicket(appId)
+	if err != nil {
+		if err == ErrNotFound {
+			err = util.ErrTicketNotFound
+		}
+		return
+	}
+	ticket = (*util.Ticket)(verifyTicket)
+	return
+}
+
+func (store verifyTicketStore) SaveTicket(appId string, ticket *util.Ticket) (err error) {
+	return store.store.SaveVerifyTicket(appId, (*VerifyTicket)(ticket))
+}
+
+var _ VerifyTicketStore = (*FileVerifyTicketStore)(nil)
+
+// 基于文件的 VerifyTicketStore, 每个第三方平台一个 JSON 文件: dir/appId.json.
+//  多个副本挂载同一个目录(比如 NFS)即可共享 component_verify_ticket.
+type FileVerifyTicketStore struct {
+	store *util.FileTicketStore
+}
+
+// 创建一个新的 FileVerifyTicketStore, 目录不存在则创建.
+func NewFileVerifyTicketStore(dir string) (store *FileVerifyTicketStore, err error) {
+	fileStore, err := util.NewFileTicketStore(dir)
+	if err != nil {
+		return
+	}
+	store = &FileVerifyTicketStore{
+		store: fileStore,
+	}
+	return
+}
+
+func (store *FileVerifyTicketStore) LoadVerifyTicket(appId string) (ticket *VerifyTicket, err error) {
+	t, err := store.store.LoadTicket(appId)
+	if err != nil {
+		return nil, verifyTicketError(err)
+	}
+	ticket = (*VerifyTicket)(t)
+	return
+}
+
+func (store *FileVerifyTicketStore) SaveVerifyTicket(appId string, ticket *VerifyTicket) (err error) {
+	return store.store.SaveTicket(appId, (*util.Ticket)(ticket))
+}
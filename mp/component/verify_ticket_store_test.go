@@ -0,0 +1,54 @@
+package component
+
+import (
+	"testing"
+	"time"
+)
+
+// 缓存的行为见 internal/util 的 TestTicketCache*, 这里只测试类型和错误的转换.
+func TestStoreVerifyTicketCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileVerifyTicketCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.GetComponentVerifyTicket("wxcomponent"); err != ErrNotFound {
+		t.Errorf("TestStoreVerifyTicketCache failed, have: %v, want: %v\n", err, ErrNotFound)
+	}
+	if _, _, err = cache.Status("wxcomponent"); err != ErrNotFound {
+		t.Errorf("TestStoreVerifyTicketCache failed, have: %v, want: %v\n", err, ErrNotFound)
+	}
+
+	// 过时的 component_verify_ticket 通知 OnStale
+	store, err := NewFileVerifyTicketStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.LoadVerifyTicket("wxcomponent"); err != ErrNotFound {
+		t.Errorf("TestStoreVerifyTicketCache failed, have: %v, want: %v\n", err, ErrNotFound)
+	}
+	updatedAt := time.Now().Add(-time.Hour)
+	if err = store.SaveVerifyTicket("wxcomponent", &VerifyTicket{Ticket: "ticket@@@old", UpdatedAt: updatedAt}); err != nil {
+		t.Fatal(err)
+	}
+	var staleTicket *VerifyTicket
+	cache.OnStale = func(appId string, ticket *VerifyTicket) {
+		staleTicket = ticket
+	}
+	if ticket, err := cache.GetComponentVerifyTicket("wxcomponent"); err != nil || ticket != "ticket@@@old" {
+		t.Errorf("TestStoreVerifyTicketCache failed, have: %s, %v, want: %s\n", ticket, err, "ticket@@@old")
+	}
+	if staleTicket == nil || !staleTicket.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("TestStoreVerifyTicketCache failed, have OnStale: %+v\n", staleTicket)
+	}
+
+	if err = cache.SetComponentVerifyTicket("wxcomponent", "ticket@@@new"); err != nil {
+		t.Fatal(err)
+	}
+	if ticket, stale, err := cache.Status("wxcomponent"); err != nil || stale || ticket.Ticket != "ticket@@@new" {
+		t.Errorf("TestStoreVerifyTicketCache failed, have: %+v, %t, %v\n", ticket, stale, err)
+	}
+	if ticket, err := store.LoadVerifyTicket("wxcomponent"); err != nil || ticket.Ticket != "ticket@@@new" {
+		t.Errorf("TestStoreVerifyTicketCache failed, have saved: %+v, %v\n", ticket, err)
+	}
+}
@@ -0,0 +1,110 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package component
+
+import (
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 小程序代码草稿箱中的草稿.
+type TemplateDraft struct {
+	DraftId     int64  `json:"draft_id"`     // 草稿ID
+	UserVersion string `json:"user_version"` // 版本号, 开发者自定义
+	UserDesc    string `json:"user_desc"`    // 版本描述, 开发者自定义
+	CreateTime  int64  `json:"create_time"`  // 开发者上传草稿时间
+}
+
+// 小程序代码模版库中的模版.
+type Template struct {
+	TemplateId  int64  `json:"template_id"`  // 模版ID
+	UserVersion string `json:"user_version"` // 模版版本号, 开发者自定义
+	UserDesc    string `json:"user_desc"`    // 模版描述, 开发者自定义
+	CreateTime  int64  `json:"create_time"`  // 被添加为模版的时间
+}
+
+// 获取小程序代码草稿箱内的所有临时代码草稿.
+func (clt *Client) GetTemplateDraftList() (draftList []TemplateDraft, err error) {
+	var result struct {
+		mp.Error
+		DraftList []TemplateDraft `json:"draft_list"`
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/gettemplatedraftlist?access_token="
+	if err = clt.GetJSON(incompleteURL, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	draftList = result.DraftList
+	return
+}
+
+// 获取小程序代码模版库中的所有小程序代码模版.
+func (clt *Client) GetTemplateList() (templateList []Template, err error) {
+	var result struct {
+		mp.Error
+		TemplateList []Template `json:"template_list"`
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/gettemplatelist?access_token="
+	if err = clt.GetJSON(incompleteURL, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	templateList = result.TemplateList
+	return
+}
+
+// 将草稿箱的草稿选为小程序代码模版.
+func (clt *Client) AddToTemplate(draftId int64) (err error) {
+	request := struct {
+		DraftId int64 `json:"draft_id"`
+	}{
+		DraftId: draftId,
+	}
+
+	var result mp.Error
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/addtotemplate?access_token="
+	if err = clt.PostJSON(incompleteURL, &request, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result
+		return
+	}
+	return
+}
+
+// 删除指定的小程序代码模版.
+func (clt *Client) DeleteTemplate(templateId int64) (err error) {
+	request := struct {
+		TemplateId int64 `json:"template_id"`
+	}{
+		TemplateId: templateId,
+	}
+
+	var result mp.Error
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/deletetemplate?access_token="
+	if err = clt.PostJSON(incompleteURL, &request, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result
+		return
+	}
+	return
+}
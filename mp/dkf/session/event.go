@@ -15,6 +15,13 @@ const (
 	EventTypeKfSwitchSession = "kf_switch_session" // 转接会话
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeKfCreateSession, (*KfCreateSessionEvent)(nil))
+	mp.RegisterEventType(EventTypeKfCloseSession, (*KfCloseSessionEvent)(nil))
+	mp.RegisterEventType(EventTypeKfSwitchSession, (*KfSwitchSessionEvent)(nil))
+}
+
 type KfCreateSessionEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
 	mp.MessageHeader
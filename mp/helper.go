@@ -71,3 +71,26 @@ func WriteAESResponse(w http.ResponseWriter, r *Request, msg interface{}) (err e
 
 	return xml.NewEncoder(w).Encode(&responseHttpBody)
 }
+
+// 回复消息给微信服务器, 根据 Request.EncryptType 自动选择明文模式或者安全模式.
+//  要求 msg 是有效的消息数据结构(经过 encoding/xml marshal 后符合微信消息格式);
+//  如果有必要可以修改 Request 里面的某些值, 比如 Timestamp, Nonce, Random.
+func WriteResponse(w http.ResponseWriter, r *Request, msg interface{}) (err error) {
+	if r == nil {
+		return errors.New("nil Request")
+	}
+
+	switch r.EncryptType {
+	case "aes": // 安全模式, 兼容模式
+		return WriteAESResponse(w, r, msg)
+	case "", "raw": // 明文模式
+		return WriteRawResponse(w, r, msg)
+	default:
+		return errors.New("unknown encrypt_type: " + r.EncryptType)
+	}
+}
+
+// 回复消息给微信服务器, 同 WriteResponse(w, r, msg).
+func (r *Request) WriteResponse(w http.ResponseWriter, msg interface{}) (err error) {
+	return WriteResponse(w, r, msg)
+}
@@ -0,0 +1,107 @@
+package mp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+type testReplyMsg struct {
+	XMLName struct{} `xml:"xml"`
+	MessageHeader
+	Content string `xml:"Content"`
+}
+
+func newTestReplyRequest(encryptType string) *Request {
+	r := &Request{
+		Token:       "token",
+		Timestamp:   1460000000,
+		Nonce:       "nonce",
+		EncryptType: encryptType,
+		Random:      []byte("0123456789abcdef"),
+		AppId:       "wx0000000000000000",
+	}
+	copy(r.AESKey[:], "0123456789abcdef0123456789abcdef")
+	return r
+}
+
+var testReply = &testReplyMsg{
+	MessageHeader: MessageHeader{
+		ToUserName:   "user",
+		FromUserName: "gh_account",
+		CreateTime:   1460000000,
+		MsgType:      "text",
+	},
+	Content: "hello",
+}
+
+func TestWriteResponseRaw(t *testing.T) {
+	want, err := xml.Marshal(testReply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encryptType := range []string{"", "raw"} {
+		w := httptest.NewRecorder()
+		if err = WriteResponse(w, newTestReplyRequest(encryptType), testReply); err != nil {
+			t.Fatal(err)
+		}
+		if have := w.Body.Bytes(); !bytes.Equal(have, want) {
+			t.Errorf("TestWriteResponseRaw failed, encrypt_type: %q, have: %s, want: %s\n", encryptType, have, want)
+		}
+	}
+}
+
+func TestWriteResponseAES(t *testing.T) {
+	r := newTestReplyRequest("aes")
+
+	w := httptest.NewRecorder()
+	if err := r.WriteResponse(w, testReply); err != nil {
+		t.Fatal(err)
+	}
+
+	var body ResponseHttpBody
+	if err := xml.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Timestamp != r.Timestamp || body.Nonce != r.Nonce {
+		t.Errorf("TestWriteResponseAES failed, have timestamp: %d, nonce: %s\n", body.Timestamp, body.Nonce)
+	}
+	wantSignature := util.MsgSign(r.Token, strconv.FormatInt(r.Timestamp, 10), r.Nonce, body.EncryptedMsg)
+	if body.MsgSignature != wantSignature {
+		t.Errorf("TestWriteResponseAES failed, have signature: %s, want: %s\n", body.MsgSignature, wantSignature)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(body.EncryptedMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random, rawMsgXML, appId, err := util.AESDecryptMsg(ciphertext, r.AESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := xml.Marshal(testReply)
+	if !bytes.Equal(rawMsgXML, want) {
+		t.Errorf("TestWriteResponseAES failed, have: %s, want: %s\n", rawMsgXML, want)
+	}
+	if !bytes.Equal(random, r.Random) || string(appId) != r.AppId {
+		t.Errorf("TestWriteResponseAES failed, have random: %s, appid: %s\n", random, appId)
+	}
+}
+
+func TestWriteResponseUnknownEncryptType(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := WriteResponse(w, newTestReplyRequest("rsa"), testReply); err == nil {
+		t.Errorf("TestWriteResponseUnknownEncryptType failed, want error\n")
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("TestWriteResponseUnknownEncryptType failed, have body: %s\n", w.Body.Bytes())
+	}
+	if err := WriteResponse(w, nil, testReply); err == nil {
+		t.Errorf("TestWriteResponseUnknownEncryptType failed, want nil Request error\n")
+	}
+}
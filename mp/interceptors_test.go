@@ -0,0 +1,154 @@
+package mp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testInterceptorErrors []error
+
+func (errs *testInterceptorErrors) ServeError(w http.ResponseWriter, r *http.Request, err error) {
+	*errs = append(*errs, err)
+}
+
+func TestInterceptorChain(t *testing.T) {
+	var calls []string
+	interceptor := func(name string, shouldContinue bool) Interceptor {
+		return InterceptorFunc(func(w http.ResponseWriter, r *http.Request, queryValues url.Values) bool {
+			calls = append(calls, name)
+			return shouldContinue
+		})
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	chain := InterceptorChain{interceptor("a", true), nil, interceptor("b", true)}
+	if !chain.Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Errorf("TestInterceptorChain failed, want continue\n")
+	}
+	if have := strings.Join(calls, ","); have != "a,b" {
+		t.Errorf("TestInterceptorChain failed, have: %s, want: %s\n", have, "a,b")
+	}
+
+	// 有一个返回 false 则后面的不再调用
+	calls = nil
+	chain = InterceptorChain{interceptor("a", true), interceptor("b", false), interceptor("c", true)}
+	if chain.Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Errorf("TestInterceptorChain failed, want stop\n")
+	}
+	if have := strings.Join(calls, ","); have != "a,b" {
+		t.Errorf("TestInterceptorChain failed, have: %s, want: %s\n", have, "a,b")
+	}
+
+	if !InterceptorChain(nil).Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Errorf("TestInterceptorChain failed, empty chain want continue\n")
+	}
+}
+
+func TestMaxBodySizeInterceptor(t *testing.T) {
+	var errs testInterceptorErrors
+	interceptor := NewMaxBodySizeInterceptor(8, &errs)
+
+	// Content-Length 超过限制直接拒绝
+	r := httptest.NewRequest("POST", "/", strings.NewReader("0123456789"))
+	if interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Errorf("TestMaxBodySizeInterceptor failed, large body allowed\n")
+	}
+	if len(errs) != 1 || errs[0] != ErrRequestBodyTooLarge {
+		t.Errorf("TestMaxBodySizeInterceptor failed, have errors: %v\n", errs)
+	}
+
+	// 没有 Content-Length 时读取超过限制返回错误
+	r = httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader("0123456789")))
+	r.ContentLength = -1
+	if !interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Fatalf("TestMaxBodySizeInterceptor failed, unknown length denied\n")
+	}
+	if _, err := io.ReadAll(r.Body); err == nil {
+		t.Errorf("TestMaxBodySizeInterceptor failed, want read error\n")
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("01234567"))
+	if !interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query()) {
+		t.Fatalf("TestMaxBodySizeInterceptor failed, small body denied\n")
+	}
+	if body, err := io.ReadAll(r.Body); err != nil || string(body) != "01234567" {
+		t.Errorf("TestMaxBodySizeInterceptor failed, have: %s, %v\n", body, err)
+	}
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	var errs testInterceptorErrors
+	interceptor, err := NewRateLimitInterceptor(0.001, 2, []string{"10.0.0.0/8"}, &errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intercept := func(remoteAddr, forwardedFor string) bool {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query())
+	}
+
+	for i, want := range []bool{true, true, false} {
+		if have := intercept("1.2.3.4:1234", ""); have != want {
+			t.Errorf("TestRateLimitInterceptor failed, request %d, have: %t, want: %t\n", i, have, want)
+		}
+	}
+	if len(errs) != 1 || errs[0] != ErrTooManyRequests {
+		t.Errorf("TestRateLimitInterceptor failed, have errors: %v\n", errs)
+	}
+
+	// 来自受信任的反向代理的请求按 X-Forwarded-For 里的来源 IP 限流
+	if !intercept("10.0.0.1:1234", "5.6.7.8") || !intercept("10.0.0.2:1234", "5.6.7.8") {
+		t.Errorf("TestRateLimitInterceptor failed, proxied request denied\n")
+	}
+	if intercept("10.0.0.3:1234", "5.6.7.8") {
+		t.Errorf("TestRateLimitInterceptor failed, proxied request allowed over limit\n")
+	}
+	if intercept("10.0.0.1:1234", "1.2.3.4") {
+		t.Errorf("TestRateLimitInterceptor failed, proxied request allowed over limit\n")
+	}
+
+	if _, err = NewRateLimitInterceptor(1, 1, []string{"not an ip"}, nil); err == nil {
+		t.Errorf("TestRateLimitInterceptor failed, want invalid trustedProxies error\n")
+	}
+}
+
+func TestRequestCheckInterceptor(t *testing.T) {
+	tests := []struct {
+		method string
+		query  string
+		body   string
+		want   bool
+	}{
+		{"GET", "signature=s&timestamp=1&nonce=n&echostr=e", "", true},
+		{"GET", "signature=s&timestamp=1&nonce=n", "", false},
+		{"POST", "signature=s&timestamp=1&nonce=n", "<xml/>", true},
+		{"POST", "signature=s&timestamp=1&nonce=n", "", false},
+		{"POST", "encrypt_type=aes&msg_signature=s&timestamp=1&nonce=n", "<xml/>", true},
+		{"POST", "encrypt_type=aes&signature=s&timestamp=1&nonce=n", "<xml/>", false},
+		{"POST", "timestamp=1&nonce=n", "<xml/>", false},
+		{"POST", "signature=s&nonce=n", "<xml/>", false},
+		{"POST", "signature=s&timestamp=abc&nonce=n", "<xml/>", false},
+		{"POST", "signature=s&timestamp=1", "<xml/>", false},
+		{"PUT", "signature=s&timestamp=1&nonce=n", "<xml/>", false},
+	}
+
+	for _, test := range tests {
+		var errs testInterceptorErrors
+		interceptor := NewRequestCheckInterceptor(&errs)
+		r := httptest.NewRequest(test.method, "/?"+test.query, strings.NewReader(test.body))
+		if have := interceptor.Intercept(httptest.NewRecorder(), r, r.URL.Query()); have != test.want {
+			t.Errorf("TestRequestCheckInterceptor failed, %s %s, have: %t, want: %t\n", test.method, test.query, have, test.want)
+		}
+		if test.want == (len(errs) != 0) {
+			t.Errorf("TestRequestCheckInterceptor failed, %s %s, have errors: %v\n", test.method, test.query, errs)
+		}
+	}
+}
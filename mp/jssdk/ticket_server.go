@@ -6,11 +6,13 @@
 package jssdk
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/chanxuehong/wechat/internal/daemon"
 	"github.com/chanxuehong/wechat/mp"
 )
 
@@ -42,7 +44,8 @@ var _ TicketServer = (*DefaultTicketServer)(nil)
 type DefaultTicketServer struct {
 	mpClient *mp.Client
 
-	resetTickerChan chan time.Duration // 用于重置 ticketDaemon 里的 ticker
+	ticketDaemon    *daemon.Daemon     // 定时刷新 jsapi_ticket 的后台 goroutine
+	refreshNotifier mp.RefreshNotifier // 刷新事件的订阅列表
 
 	ticketGet struct {
 		sync.Mutex
@@ -52,7 +55,8 @@ type DefaultTicketServer struct {
 
 	ticketCache struct {
 		sync.RWMutex
-		Ticket string
+		Ticket    string
+		ExpiresAt int64 // Ticket 的过期时间, unixtime
 	}
 }
 
@@ -63,11 +67,11 @@ func NewDefaultTicketServer(clt *mp.Client) (srv *DefaultTicketServer) {
 	}
 
 	srv = &DefaultTicketServer{
-		mpClient:        clt,
-		resetTickerChan: make(chan time.Duration),
+		mpClient: clt,
 	}
 
-	go srv.ticketDaemon(time.Hour * 24) // 启动 tokenDaemon
+	srv.ticketDaemon = daemon.New(srv.daemonRefresh)
+	srv.ticketDaemon.Start(time.Hour * 24) // 启动 ticketDaemon
 	return
 }
 
@@ -76,51 +80,78 @@ func (srv *DefaultTicketServer) TagB38894EBFE9911E4BE17A4DB30FED8E1() {}
 func (srv *DefaultTicketServer) Ticket() (ticket string, err error) {
 	srv.ticketCache.RLock()
 	ticket = srv.ticketCache.Ticket
+	expiresAt := srv.ticketCache.ExpiresAt
 	srv.ticketCache.RUnlock()
 
-	if ticket != "" {
+	// 刷新失败时在过期之前继续使用旧的 jsapi_ticket
+	if ticket != "" && time.Now().Unix() < expiresAt {
 		return
 	}
 	return srv.TicketRefresh()
 }
 
 func (srv *DefaultTicketServer) TicketRefresh() (ticket string, err error) {
-	ticketInfo, cached, err := srv.getTicket()
+	ticketInfo, cached, err := srv.refreshTicket()
 	if err != nil {
 		return
 	}
 	if !cached {
-		srv.resetTickerChan <- time.Duration(ticketInfo.ExpiresIn) * time.Second
+		srv.ticketDaemon.Reset(time.Duration(ticketInfo.ExpiresIn) * time.Second)
 	}
 	ticket = ticketInfo.Ticket
 	return
 }
 
-func (srv *DefaultTicketServer) ticketDaemon(tickDuration time.Duration) {
-NEW_TICK_DURATION:
-	ticker := time.NewTicker(tickDuration)
-
-	for {
-		select {
-		case tickDuration = <-srv.resetTickerChan:
-			ticker.Stop()
-			goto NEW_TICK_DURATION
-
-		case <-ticker.C:
-			ticketInfo, cached, err := srv.getTicket()
-			if err != nil {
-				break
-			}
-			if !cached {
-				newTickDuration := time.Duration(ticketInfo.ExpiresIn) * time.Second
-				if tickDuration != newTickDuration {
-					tickDuration = newTickDuration
-					ticker.Stop()
-					goto NEW_TICK_DURATION
-				}
-			}
-		}
+// 启动(重启)后台定时刷新 jsapi_ticket 的 goroutine, NewDefaultTicketServer 已经启动过一次.
+//  如果已经在运行则什么都不做.
+func (srv *DefaultTicketServer) Start() {
+	srv.ticketDaemon.Start(srv.daemonPeriod())
+}
+
+// 停止后台定时刷新 jsapi_ticket 的 goroutine, 并等待正在进行的刷新完成.
+//  如果 ctx 在这之前结束则返回 ctx.Err();
+//  Stop 之后仍然可以调用 Ticket, TicketRefresh, 也可以调用 Start 重新启动.
+func (srv *DefaultTicketServer) Stop(ctx context.Context) error {
+	return srv.ticketDaemon.Stop(ctx)
+}
+
+// 同 Stop(context.Background()).
+func (srv *DefaultTicketServer) Close() error {
+	return srv.Stop(context.Background())
+}
+
+// 订阅刷新 jsapi_ticket 的事件, 返回取消订阅的函数, 比如刷新失败时告警.
+//  见 mp.RefreshNotifier.Subscribe.
+func (srv *DefaultTicketServer) Subscribe(fn func(*mp.RefreshEvent)) (unsubscribe func()) {
+	return srv.refreshNotifier.Subscribe(fn)
+}
+
+// 后台 goroutine 第一次刷新的时间间隔, 为当前 jsapi_ticket 剩余的有效时间, 如果没有则为 24 小时.
+func (srv *DefaultTicketServer) daemonPeriod() time.Duration {
+	srv.ticketGet.Lock()
+	lastTimestamp := srv.ticketGet.LastTimestamp
+	expiresIn := srv.ticketGet.LastTicketInfo.ExpiresIn
+	srv.ticketGet.Unlock()
+
+	if lastTimestamp == 0 {
+		return time.Hour * 24
+	}
+	if period := time.Duration(lastTimestamp+expiresIn-time.Now().Unix()) * time.Second; period > 0 {
+		return period
+	}
+	return time.Second
+}
+
+// 后台 goroutine 的刷新函数, 返回下一次刷新的时间间隔.
+func (srv *DefaultTicketServer) daemonRefresh() (next time.Duration, err error) {
+	ticketInfo, cached, err := srv.refreshTicket()
+	if err != nil {
+		return
 	}
+	if !cached {
+		next = time.Duration(ticketInfo.ExpiresIn) * time.Second
+	}
+	return
 }
 
 type ticketInfo struct {
@@ -128,6 +159,19 @@ type ticketInfo struct {
 	ExpiresIn int64  `json:"expires_in"` // 有效时间, seconds
 }
 
+// 同 getTicket, 在没有命中收敛缓存时通知刷新事件的订阅者.
+func (srv *DefaultTicketServer) refreshTicket() (ticket ticketInfo, cached bool, err error) {
+	if ticket, cached, err = srv.getTicket(); cached {
+		return
+	}
+	srv.refreshNotifier.Notify(&mp.RefreshEvent{
+		Time:      time.Now(),
+		ExpiresIn: ticket.ExpiresIn,
+		Err:       err,
+	})
+	return
+}
+
 // 从微信服务器获取 jsapi_ticket.
 //  同一时刻只能一个 goroutine 进入, 防止没必要的重复获取.
 func (srv *DefaultTicketServer) getTicket() (ticket ticketInfo, cached bool, err error) {
@@ -154,17 +198,10 @@ func (srv *DefaultTicketServer) getTicket() (ticket ticketInfo, cached bool, err
 
 	incompleteURL := "https://api.weixin.qq.com/cgi-bin/ticket/getticket?type=jsapi&access_token="
 	if err = srv.mpClient.GetJSON(incompleteURL, &result); err != nil {
-		srv.ticketCache.Lock()
-		srv.ticketCache.Ticket = ""
-		srv.ticketCache.Unlock()
 		return
 	}
 
 	if result.ErrCode != mp.ErrCodeOK {
-		srv.ticketCache.Lock()
-		srv.ticketCache.Ticket = ""
-		srv.ticketCache.Unlock()
-
 		err = &result.Error
 		return
 	}
@@ -172,10 +209,6 @@ func (srv *DefaultTicketServer) getTicket() (ticket ticketInfo, cached bool, err
 	// 由于网络的延时, jsapi_ticket 过期时间留了一个缓冲区
 	switch {
 	case result.ExpiresIn > 31556952: // 60*60*24*365.2425
-		srv.ticketCache.Lock()
-		srv.ticketCache.Ticket = ""
-		srv.ticketCache.Unlock()
-
 		err = errors.New("expires_in too large: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	case result.ExpiresIn > 60*60:
@@ -187,10 +220,6 @@ func (srv *DefaultTicketServer) getTicket() (ticket ticketInfo, cached bool, err
 	case result.ExpiresIn > 60:
 		result.ExpiresIn -= 10
 	default:
-		srv.ticketCache.Lock()
-		srv.ticketCache.Ticket = ""
-		srv.ticketCache.Unlock()
-
 		err = errors.New("expires_in too small: " + strconv.FormatInt(result.ExpiresIn, 10))
 		return
 	}
@@ -200,6 +229,7 @@ func (srv *DefaultTicketServer) getTicket() (ticket ticketInfo, cached bool, err
 
 	srv.ticketCache.Lock()
 	srv.ticketCache.Ticket = result.ticketInfo.Ticket
+	srv.ticketCache.ExpiresAt = timeNowUnix + result.ticketInfo.ExpiresIn
 	srv.ticketCache.Unlock()
 
 	ticket = result.ticketInfo
@@ -0,0 +1,296 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/daemon"
+	"github.com/chanxuehong/wechat/mp"
+	"github.com/chanxuehong/wechat/mp/component"
+)
+
+// 公众号的配置.
+//  直接管理的公众号 AppSecret 不能为空;
+//  通过第三方平台授权的公众号 AppSecret 为空, AuthorizerRefreshToken 和 RefreshTokenStorage 不能都为空.
+type Config struct {
+	AppId                  string
+	AppSecret              string
+	AuthorizerRefreshToken string
+
+	// 不为 nil 时 authorizer_refresh_token 从这里读取并保存微信返回的新值, 忽略 AuthorizerRefreshToken;
+	// 否则 Tenant 被淘汰后重新创建时用的还是 AuthorizerRefreshToken, 可能已经失效.
+	RefreshTokenStorage component.RefreshTokenStorage
+}
+
+// 公众号配置的提供者, 比如从数据库里加载.
+type ConfigProvider interface {
+	// 获取 appId 对应的公众号的配置.
+	Config(appId string) (*Config, error)
+}
+
+type ConfigProviderFunc func(appId string) (*Config, error)
+
+func (fn ConfigProviderFunc) Config(appId string) (*Config, error) {
+	return fn(appId)
+}
+
+// 多公众号的 Client 管理器, 第一次使用某个公众号时才创建它的中控服务器和 Client, 然后缓存起来;
+// 长时间没有使用的公众号会被移出缓存, 并且停止它的中控服务器的后台 goroutine.
+//  所有公众号共用同一个 http.Client(Transport). Manager 并发安全.
+//  NOTE: 同一个公众号的中控服务器整个系统只能有一个, 所以每个公众号只能由一个 Manager 管理.
+type Manager struct {
+	provider        ConfigProvider
+	componentClient *component.Client
+	httpClient      *http.Client
+	idleTimeout     time.Duration
+
+	evictDaemon *daemon.Daemon // 定时移除空闲公众号的后台 goroutine
+
+	rwmutex   sync.RWMutex
+	tenantMap map[string]*Tenant
+	inflight  map[string]*tenantCall   // 正在创建的公众号, 同一个公众号同时只创建一次
+	closing   map[string]chan struct{} // 正在停止中控服务器的公众号, 停止完成之前不会重新创建
+}
+
+type tenantCall struct {
+	done chan struct{}
+	t    *Tenant
+	err  error
+}
+
+// 创建一个新的 Manager.
+//  provider:        公众号配置的提供者
+//  componentClient: 第三方平台的 Client, 用于通过第三方平台授权的公众号, 可以为 nil
+//  httpClient:      所有公众号共用的 http.Client, 为 nil 则用 http.DefaultClient
+//  idleTimeout:     公众号空闲多久后被移出缓存, <=0 表示不移出; 每 idleTimeout/2(1秒到1分钟之间) 检查一次
+func NewManager(provider ConfigProvider, componentClient *component.Client,
+	httpClient *http.Client, idleTimeout time.Duration) (mgr *Manager) {
+
+	if provider == nil {
+		panic("nil ConfigProvider")
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	mgr = &Manager{
+		provider:        provider,
+		componentClient: componentClient,
+		httpClient:      httpClient,
+		idleTimeout:     idleTimeout,
+		tenantMap:       make(map[string]*Tenant),
+		inflight:        make(map[string]*tenantCall),
+		closing:         make(map[string]chan struct{}),
+	}
+
+	if idleTimeout > 0 {
+		mgr.evictDaemon = daemon.New(mgr.daemonEvict)
+		mgr.evictDaemon.Start(mgr.evictPeriod()) // 启动 evictDaemon
+	}
+	return
+}
+
+// 获取 appId 对应的公众号, 如果没有缓存则根据配置创建.
+//  创建(读取配置, 读取 authorizer_refresh_token 等)不持有 Manager 的锁, 不会阻塞其他公众号;
+//  同一个公众号同时只创建一次, 其他 goroutine 等待创建的结果.
+func (mgr *Manager) Tenant(appId string) (t *Tenant, err error) {
+	if appId == "" {
+		err = errors.New("empty appId")
+		return
+	}
+
+	mgr.rwmutex.RLock()
+	t = mgr.tenantMap[appId]
+	mgr.rwmutex.RUnlock()
+
+	if t == nil {
+		if t, err = mgr.loadTenant(appId); err != nil {
+			return
+		}
+	}
+	t.touch(time.Now())
+	return
+}
+
+func (mgr *Manager) loadTenant(appId string) (t *Tenant, err error) {
+	mgr.rwmutex.Lock()
+	if t = mgr.tenantMap[appId]; t != nil { // 其他 goroutine 已经创建了
+		mgr.rwmutex.Unlock()
+		return
+	}
+	if call := mgr.inflight[appId]; call != nil { // 其他 goroutine 正在创建
+		mgr.rwmutex.Unlock()
+		<-call.done
+		return call.t, call.err
+	}
+	call := &tenantCall{
+		done: make(chan struct{}),
+	}
+	mgr.inflight[appId] = call
+	closing := mgr.closing[appId]
+	mgr.rwmutex.Unlock()
+
+	defer func() {
+		mgr.rwmutex.Lock()
+		delete(mgr.inflight, appId)
+		if call.err == nil && call.t != nil {
+			mgr.tenantMap[appId] = call.t
+		}
+		mgr.rwmutex.Unlock()
+		close(call.done)
+	}()
+
+	call.err = errors.New("create tenant panicked for appId: " + appId) // newTenant panic 时等待的 goroutine 得到这个错误
+	if closing != nil {
+		<-closing // 等待被移除的 Tenant 停止, 同一个公众号不能同时有两个中控服务器
+	}
+	call.t, call.err = mgr.buildTenant(appId)
+	return call.t, call.err
+}
+
+func (mgr *Manager) buildTenant(appId string) (t *Tenant, err error) {
+	config, err := mgr.provider.Config(appId)
+	if err != nil {
+		return
+	}
+	if config == nil {
+		err = errors.New("nil Config for appId: " + appId)
+		return
+	}
+	if t, err = mgr.newTenant(appId, config); err != nil {
+		return
+	}
+	t.touch(time.Now())
+	return
+}
+
+func (mgr *Manager) newTenant(appId string, config *Config) (t *Tenant, err error) {
+	var srv mp.AccessTokenServer
+	switch {
+	case config.AppSecret != "":
+		srv = mp.NewDefaultAccessTokenServer(appId, config.AppSecret, mgr.httpClient)
+	case config.AuthorizerRefreshToken != "" || config.RefreshTokenStorage != nil:
+		if mgr.componentClient == nil {
+			err = errors.New("nil component.Client for authorizer appId: " + appId)
+			return
+		}
+		if config.RefreshTokenStorage != nil {
+			if srv, err = component.NewAuthorizerAccessTokenServerWithStorage(mgr.componentClient, appId, config.RefreshTokenStorage); err != nil {
+				return
+			}
+		} else {
+			srv = component.NewAuthorizerAccessTokenServer(mgr.componentClient, appId, config.AuthorizerRefreshToken)
+		}
+	default:
+		err = errors.New("AppSecret, AuthorizerRefreshToken and RefreshTokenStorage are all empty for appId: " + appId)
+		return
+	}
+
+	t = &Tenant{
+		AppId:             appId,
+		AccessTokenServer: srv,
+		Client:            mp.NewClient(srv, mgr.httpClient),
+	}
+	return
+}
+
+// 把 appId 对应的公众号移出缓存, 并且停止它的中控服务器的后台 goroutine, 比如公众号的配置修改后.
+func (mgr *Manager) Evict(appId string) (err error) {
+	mgr.rwmutex.Lock()
+	t := mgr.tenantMap[appId]
+	var done chan struct{}
+	if t != nil {
+		done = mgr.removeTenantLocked(appId)
+	}
+	mgr.rwmutex.Unlock()
+
+	if t == nil {
+		return
+	}
+	return mgr.closeTenant(appId, t, done)
+}
+
+// 把 appId 对应的公众号移出缓存并标记为正在停止, 返回停止完成时需要关闭的 chan, 调用者需要持有写锁.
+func (mgr *Manager) removeTenantLocked(appId string) (done chan struct{}) {
+	delete(mgr.tenantMap, appId)
+	done = make(chan struct{})
+	mgr.closing[appId] = done
+	return
+}
+
+// 停止被移除的公众号的中控服务器, 之后才允许重新创建.
+func (mgr *Manager) closeTenant(appId string, t *Tenant, done chan struct{}) error {
+	defer func() {
+		mgr.rwmutex.Lock()
+		if mgr.closing[appId] == done {
+			delete(mgr.closing, appId)
+		}
+		mgr.rwmutex.Unlock()
+		close(done)
+	}()
+	return t.close()
+}
+
+// 停止定时移除空闲公众号的后台 goroutine, 并且移除所有的公众号.
+func (mgr *Manager) Close() (err error) {
+	if mgr.evictDaemon != nil {
+		mgr.evictDaemon.Stop(context.Background())
+	}
+
+	mgr.rwmutex.Lock()
+	tenantMap := make(map[string]*Tenant, len(mgr.tenantMap))
+	doneMap := make(map[string]chan struct{}, len(mgr.tenantMap))
+	for appId, t := range mgr.tenantMap {
+		tenantMap[appId] = t
+		doneMap[appId] = mgr.removeTenantLocked(appId)
+	}
+	mgr.rwmutex.Unlock()
+
+	for appId, t := range tenantMap {
+		if closeErr := mgr.closeTenant(appId, t, doneMap[appId]); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// 检查空闲公众号的时间间隔, idleTimeout 的一半, 在 [time.Second, time.Minute] 之间.
+func (mgr *Manager) evictPeriod() time.Duration {
+	switch period := mgr.idleTimeout / 2; {
+	case period < time.Second:
+		return time.Second
+	case period < time.Minute:
+		return period
+	default:
+		return time.Minute
+	}
+}
+
+// 后台 goroutine 的移除函数.
+func (mgr *Manager) daemonEvict() (next time.Duration, err error) {
+	deadline := time.Now().Add(-mgr.idleTimeout)
+
+	idleTenants := make(map[string]*Tenant)
+	doneMap := make(map[string]chan struct{})
+	mgr.rwmutex.Lock()
+	for appId, t := range mgr.tenantMap {
+		if t.idleSince().Before(deadline) {
+			idleTenants[appId] = t
+			doneMap[appId] = mgr.removeTenantLocked(appId)
+		}
+	}
+	mgr.rwmutex.Unlock()
+
+	for appId, t := range idleTenants {
+		mgr.closeTenant(appId, t, doneMap[appId])
+	}
+	return
+}
@@ -0,0 +1,334 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp"
+	"github.com/chanxuehong/wechat/mp/component"
+)
+
+type testComponentTokenServer struct{}
+
+func (testComponentTokenServer) Token() (string, error)               { return "component_access_token", nil }
+func (testComponentTokenServer) TokenRefresh() (string, error)        { return "component_access_token", nil }
+func (testComponentTokenServer) Tag7B36CB9FFE9911E48469A4DB30FED8E1() {}
+
+type testRefreshTokenStorage struct {
+	loads int32
+	err   error
+}
+
+func (storage *testRefreshTokenStorage) LoadRefreshToken(appId string) (string, error) {
+	atomic.AddInt32(&storage.loads, 1)
+	if storage.err != nil {
+		return "", storage.err
+	}
+	return "refresh_token_" + appId, nil
+}
+
+func (storage *testRefreshTokenStorage) SaveRefreshToken(appId, refreshToken string) error {
+	return nil
+}
+
+func testDaemonRunning(t *Tenant) bool {
+	return t.AccessTokenServer.(mp.TokenStatusServer).Status().DaemonRunning
+}
+
+// 同一个公众号并发获取只创建一次.
+func TestManagerTenantOnce(t *testing.T) {
+	var calls int32
+	provider := ConfigProviderFunc(func(appId string) (*Config, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 50)
+		return &Config{AppId: appId, AppSecret: "secret"}, nil
+	})
+	mgr := NewManager(provider, nil, nil, 0)
+	defer mgr.Close()
+
+	var wg sync.WaitGroup
+	tenants := make([]*Tenant, 20)
+	for i := range tenants {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tenant, err := mgr.Tenant("wx1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tenants[i] = tenant
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("TestManagerTenantOnce failed, have Config calls: %d, want: 1\n", n)
+	}
+	for _, tenant := range tenants {
+		if tenant != tenants[0] {
+			t.Fatal("TestManagerTenantOnce failed, got different tenants")
+		}
+	}
+	if tenants[0].AppId != "wx1" || !testDaemonRunning(tenants[0]) {
+		t.Errorf("TestManagerTenantOnce failed, have tenant: %+v\n", tenants[0])
+	}
+}
+
+// 一个公众号创建得慢不会阻塞其他公众号.
+func TestManagerTenantSlowBuild(t *testing.T) {
+	release := make(chan struct{})
+	provider := ConfigProviderFunc(func(appId string) (*Config, error) {
+		if appId == "slow" {
+			<-release
+		}
+		return &Config{AppId: appId, AppSecret: "secret"}, nil
+	})
+	mgr := NewManager(provider, nil, nil, 0)
+	defer mgr.Close()
+
+	slowDone := make(chan error)
+	go func() {
+		_, err := mgr.Tenant("slow")
+		slowDone <- err
+	}()
+	time.Sleep(time.Millisecond * 20)
+
+	fastDone := make(chan error)
+	go func() {
+		_, err := mgr.Tenant("fast")
+		fastDone <- err
+	}()
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("TestManagerTenantSlowBuild failed, fast tenant blocked by slow tenant")
+	}
+
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 创建失败不缓存, 下次重新创建.
+func TestManagerTenantError(t *testing.T) {
+	var calls int32
+	provider := ConfigProviderFunc(func(appId string) (*Config, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errors.New("database is down")
+		}
+		return &Config{AppId: appId, AppSecret: "secret"}, nil
+	})
+	mgr := NewManager(provider, nil, nil, 0)
+	defer mgr.Close()
+
+	if _, err := mgr.Tenant("wx1"); err == nil {
+		t.Fatal("TestManagerTenantError failed, want error")
+	}
+	if _, err := mgr.Tenant("wx1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Tenant(""); err == nil {
+		t.Error("TestManagerTenantError failed, want error for empty appId")
+	}
+}
+
+// 空闲的公众号被移出缓存并停止中控服务器的后台 goroutine.
+func TestManagerEvictIdle(t *testing.T) {
+	var calls int32
+	provider := ConfigProviderFunc(func(appId string) (*Config, error) {
+		atomic.AddInt32(&calls, 1)
+		return &Config{AppId: appId, AppSecret: "secret"}, nil
+	})
+	mgr := NewManager(provider, nil, nil, time.Hour)
+	defer mgr.Close()
+
+	idle, err := mgr.Tenant("idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := mgr.Tenant("active")
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&idle.lastUsed, time.Now().Add(-time.Hour*2).Unix())
+
+	mgr.daemonEvict()
+
+	if testDaemonRunning(idle) {
+		t.Error("TestManagerEvictIdle failed, idle tenant daemon still running")
+	}
+	if !testDaemonRunning(active) {
+		t.Error("TestManagerEvictIdle failed, active tenant daemon stopped")
+	}
+	if tenant, _ := mgr.Tenant("active"); tenant != active {
+		t.Error("TestManagerEvictIdle failed, active tenant evicted")
+	}
+	tenant, err := mgr.Tenant("idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant == idle || atomic.LoadInt32(&calls) != 3 {
+		t.Error("TestManagerEvictIdle failed, idle tenant not recreated")
+	}
+
+	if err = mgr.Evict("active"); err != nil {
+		t.Fatal(err)
+	}
+	if testDaemonRunning(active) {
+		t.Error("TestManagerEvictIdle failed, evicted tenant daemon still running")
+	}
+}
+
+// idleTimeout 很小时检查的时间间隔不为 0, 后台 goroutine 正常移除空闲的公众号.
+func TestManagerEvictPeriod(t *testing.T) {
+	for _, test := range []struct {
+		idleTimeout time.Duration
+		want        time.Duration
+	}{
+		{time.Nanosecond, time.Second},
+		{time.Second, time.Second},
+		{time.Second * 10, time.Second * 5},
+		{time.Hour, time.Minute},
+	} {
+		mgr := &Manager{idleTimeout: test.idleTimeout}
+		if have := mgr.evictPeriod(); have != test.want {
+			t.Errorf("TestManagerEvictPeriod failed, idleTimeout: %s, have: %s, want: %s\n", test.idleTimeout, have, test.want)
+		}
+	}
+
+	provider := ConfigProviderFunc(func(appId string) (*Config, error) {
+		return &Config{AppId: appId, AppSecret: "secret"}, nil
+	})
+	mgr := NewManager(provider, nil, nil, time.Nanosecond)
+	defer mgr.Close()
+
+	tenant, err := mgr.Tenant("wx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second * 3); testDaemonRunning(tenant); {
+		if time.Now().After(deadline) {
+			t.Fatal("TestManagerEvictPeriod failed, idle tenant not evicted")
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+// 被移除的公众号的中控服务器停止之后才会重新创建, 同一个公众号不会同时有两个中控服务器.
+func TestManagerRebuildAfterEvict(t *testing.T) {
+	var mutex sync.Mutex
+	var tenants []*Tenant
+	var running int32
+	provider := ConfigProviderFunc(func(appId string) (*Config, error) {
+		mutex.Lock()
+		for _, tenant := range tenants {
+			if testDaemonRunning(tenant) {
+				atomic.AddInt32(&running, 1)
+			}
+		}
+		mutex.Unlock()
+		return &Config{AppId: appId, AppSecret: "secret"}, nil
+	})
+	mgr := NewManager(provider, nil, nil, 0)
+	defer mgr.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			mgr.Evict("wx1")
+		}()
+		go func() {
+			defer wg.Done()
+			tenant, err := mgr.Tenant("wx1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mutex.Lock()
+			tenants = append(tenants, tenant)
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("TestManagerRebuildAfterEvict failed, %d tenants rebuilt while the old one was running\n", n)
+	}
+
+	// 移除之后重新创建的是新的 Tenant
+	old, err := mgr.Tenant("wx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mgr.Evict("wx1"); err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := mgr.Tenant("wx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant == old || testDaemonRunning(old) || !testDaemonRunning(tenant) {
+		t.Error("TestManagerRebuildAfterEvict failed, tenant not rebuilt after Evict")
+	}
+}
+
+// 通过第三方平台授权的公众号.
+func TestManagerComponentAuthorizer(t *testing.T) {
+	storage := &testRefreshTokenStorage{}
+	provider := ConfigProviderFunc(func(appId string) (*Config, error) {
+		if appId == "static" {
+			return &Config{AppId: appId, AuthorizerRefreshToken: "static_refresh_token"}, nil
+		}
+		return &Config{AppId: appId, RefreshTokenStorage: storage}, nil
+	})
+
+	// 没有第三方平台的 Client
+	mgr := NewManager(provider, nil, nil, 0)
+	if _, err := mgr.Tenant("wx1"); err == nil {
+		t.Error("TestManagerComponentAuthorizer failed, want error for nil component.Client")
+	}
+	mgr.Close()
+
+	componentClient := component.NewClient("component_appid", testComponentTokenServer{}, nil)
+	mgr = NewManager(provider, componentClient, nil, 0)
+	defer mgr.Close()
+
+	tenant, err := mgr.Tenant("wx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, ok := tenant.AccessTokenServer.(*component.AuthorizerAccessTokenServer)
+	if !ok {
+		t.Fatalf("TestManagerComponentAuthorizer failed, have AccessTokenServer: %T\n", tenant.AccessTokenServer)
+	}
+	if have := srv.RefreshToken(); have != "refresh_token_wx1" {
+		t.Errorf("TestManagerComponentAuthorizer failed, have refresh token: %s, want: refresh_token_wx1\n", have)
+	}
+	if _, err = mgr.Tenant("wx1"); err != nil || atomic.LoadInt32(&storage.loads) != 1 {
+		t.Errorf("TestManagerComponentAuthorizer failed, have loads: %d, want: 1\n", storage.loads)
+	}
+
+	tenant, err = mgr.Tenant("static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := tenant.AccessTokenServer.(*component.AuthorizerAccessTokenServer).RefreshToken(); have != "static_refresh_token" {
+		t.Errorf("TestManagerComponentAuthorizer failed, have refresh token: %s, want: static_refresh_token\n", have)
+	}
+
+	// 读取 authorizer_refresh_token 失败不缓存
+	storage.err = errors.New("not found")
+	if _, err = mgr.Tenant("wx2"); err == nil {
+		t.Error("TestManagerComponentAuthorizer failed, want storage error")
+	}
+}
@@ -0,0 +1,83 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package manager
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp"
+	"github.com/chanxuehong/wechat/mp/account"
+	"github.com/chanxuehong/wechat/mp/datacube"
+	"github.com/chanxuehong/wechat/mp/material"
+	"github.com/chanxuehong/wechat/mp/media"
+	"github.com/chanxuehong/wechat/mp/menu"
+	"github.com/chanxuehong/wechat/mp/message/custom"
+	"github.com/chanxuehong/wechat/mp/message/mass"
+	"github.com/chanxuehong/wechat/mp/message/template"
+	"github.com/chanxuehong/wechat/mp/poi"
+	"github.com/chanxuehong/wechat/mp/user"
+)
+
+// 一个公众号的中控服务器和 Client.
+//  各个子包的 Client 都是 mp.Client 的别名, 所以共用同一个中控服务器和 http.Client.
+type Tenant struct {
+	AppId             string
+	AccessTokenServer mp.AccessTokenServer
+	Client            *mp.Client
+
+	lastUsed int64 // 最后一次使用的时间, unixtime, 原子操作
+}
+
+// 各个子包的 Client.
+func (t *Tenant) Account() *account.Client {
+	return (*account.Client)(t.Client)
+}
+func (t *Tenant) Datacube() *datacube.Client {
+	return (*datacube.Client)(t.Client)
+}
+func (t *Tenant) Material() *material.Client {
+	return (*material.Client)(t.Client)
+}
+func (t *Tenant) Media() *media.Client {
+	return (*media.Client)(t.Client)
+}
+func (t *Tenant) Menu() *menu.Client {
+	return (*menu.Client)(t.Client)
+}
+func (t *Tenant) Custom() *custom.Client {
+	return (*custom.Client)(t.Client)
+}
+func (t *Tenant) Mass() *mass.Client {
+	return (*mass.Client)(t.Client)
+}
+func (t *Tenant) Template() *template.Client {
+	return (*template.Client)(t.Client)
+}
+func (t *Tenant) POI() *poi.Client {
+	return (*poi.Client)(t.Client)
+}
+func (t *Tenant) User() *user.Client {
+	return (*user.Client)(t.Client)
+}
+
+func (t *Tenant) touch(timeNow time.Time) {
+	atomic.StoreInt64(&t.lastUsed, timeNow.Unix())
+}
+
+func (t *Tenant) idleSince() time.Time {
+	return time.Unix(atomic.LoadInt64(&t.lastUsed), 0)
+}
+
+// 停止中控服务器的后台 goroutine.
+//  停止之后 Tenant 仍然可以使用, 只是 access_token 不再定时刷新, 而是在过期后按需刷新.
+func (t *Tenant) close() error {
+	if closer, ok := t.AccessTokenServer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -23,6 +23,18 @@ const (
 	EventTypeLocationSelect  = "location_select"    // location_select: 弹出地理位置选择器的事件推送
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeClick, (*ClickEvent)(nil))
+	mp.RegisterEventType(EventTypeView, (*ViewEvent)(nil))
+	mp.RegisterEventType(EventTypeScanCodePush, (*ScanCodePushEvent)(nil))
+	mp.RegisterEventType(EventTypeScanCodeWaitMsg, (*ScanCodeWaitMsgEvent)(nil))
+	mp.RegisterEventType(EventTypePicSysPhoto, (*PicSysPhotoEvent)(nil))
+	mp.RegisterEventType(EventTypePicPhotoOrAlbum, (*PicPhotoOrAlbumEvent)(nil))
+	mp.RegisterEventType(EventTypePicWeixin, (*PicWeixinEvent)(nil))
+	mp.RegisterEventType(EventTypeLocationSelect, (*LocationSelectEvent)(nil))
+}
+
 // 点击菜单拉取消息时的事件推送
 type ClickEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
@@ -13,6 +13,11 @@ const (
 	EventTypeMassSendJobFinish = "MASSSENDJOBFINISH"
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeMassSendJobFinish, (*MassSendJobFinishEvent)(nil))
+}
+
 // 高级群发消息, 事件推送群发结果
 type MassSendJobFinishEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
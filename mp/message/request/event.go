@@ -20,6 +20,14 @@ const (
 	EventTypeLocation    = "LOCATION"    // 上报地理位置事件
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeSubscribe, (*SubscribeEvent)(nil))
+	mp.RegisterEventType(EventTypeUnsubscribe, (*UnsubscribeEvent)(nil))
+	mp.RegisterEventType(EventTypeScan, (*ScanEvent)(nil))
+	mp.RegisterEventType(EventTypeLocation, (*LocationEvent)(nil))
+}
+
 // 关注
 type SubscribeEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
@@ -20,6 +20,17 @@ const (
 	MsgTypeLink       = "link"       // 链接消息
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterMessageType(MsgTypeText, (*Text)(nil))
+	mp.RegisterMessageType(MsgTypeImage, (*Image)(nil))
+	mp.RegisterMessageType(MsgTypeVoice, (*Voice)(nil))
+	mp.RegisterMessageType(MsgTypeVideo, (*Video)(nil))
+	mp.RegisterMessageType(MsgTypeShortVideo, (*ShortVideo)(nil))
+	mp.RegisterMessageType(MsgTypeLocation, (*Location)(nil))
+	mp.RegisterMessageType(MsgTypeLink, (*Link)(nil))
+}
+
 // 文本消息
 type Text struct {
 	XMLName struct{} `xml:"xml" json:"-"`
@@ -0,0 +1,103 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package response
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 下面的 ReplyXxx 函数根据请求消息 r 自动填充回复消息的 ToUserName, FromUserName, CreateTime,
+// 并且根据 r.EncryptType 自动选择明文模式或者安全模式回复, 见 mp.WriteResponse.
+
+// 从请求消息中获取回复消息的 ToUserName, FromUserName, CreateTime.
+func replyHeader(r *mp.Request) (to, from string, timestamp int64, err error) {
+	if r == nil {
+		err = errors.New("nil Request")
+		return
+	}
+	if r.MixedMsg == nil {
+		err = errors.New("nil Request.MixedMsg")
+		return
+	}
+	to = r.MixedMsg.FromUserName
+	from = r.MixedMsg.ToUserName
+	timestamp = r.Timestamp
+	return
+}
+
+// 回复文本消息.
+func ReplyText(w http.ResponseWriter, r *mp.Request, content string) (err error) {
+	to, from, timestamp, err := replyHeader(r)
+	if err != nil {
+		return
+	}
+	return mp.WriteResponse(w, r, NewText(to, from, timestamp, content))
+}
+
+// 回复图片消息.
+func ReplyImage(w http.ResponseWriter, r *mp.Request, mediaId string) (err error) {
+	to, from, timestamp, err := replyHeader(r)
+	if err != nil {
+		return
+	}
+	return mp.WriteResponse(w, r, NewImage(to, from, timestamp, mediaId))
+}
+
+// 回复语音消息.
+func ReplyVoice(w http.ResponseWriter, r *mp.Request, mediaId string) (err error) {
+	to, from, timestamp, err := replyHeader(r)
+	if err != nil {
+		return
+	}
+	return mp.WriteResponse(w, r, NewVoice(to, from, timestamp, mediaId))
+}
+
+// 回复视频消息.
+//  title, description 可以为空.
+func ReplyVideo(w http.ResponseWriter, r *mp.Request, mediaId, title, description string) (err error) {
+	to, from, timestamp, err := replyHeader(r)
+	if err != nil {
+		return
+	}
+	return mp.WriteResponse(w, r, NewVideo(to, from, timestamp, mediaId, title, description))
+}
+
+// 回复音乐消息.
+func ReplyMusic(w http.ResponseWriter, r *mp.Request, thumbMediaId, musicURL,
+	HQMusicURL, title, description string) (err error) {
+
+	to, from, timestamp, err := replyHeader(r)
+	if err != nil {
+		return
+	}
+	return mp.WriteResponse(w, r, NewMusic(to, from, timestamp, thumbMediaId, musicURL, HQMusicURL, title, description))
+}
+
+// 回复图文消息.
+func ReplyNews(w http.ResponseWriter, r *mp.Request, articles []Article) (err error) {
+	to, from, timestamp, err := replyHeader(r)
+	if err != nil {
+		return
+	}
+	news := NewNews(to, from, timestamp, articles)
+	if err = news.CheckValid(); err != nil {
+		return
+	}
+	return mp.WriteResponse(w, r, news)
+}
+
+// 将消息转发到多客服.
+//  如果不指定客服则 kfAccount 留空.
+func ReplyTransferToCustomerService(w http.ResponseWriter, r *mp.Request, kfAccount string) (err error) {
+	to, from, timestamp, err := replyHeader(r)
+	if err != nil {
+		return
+	}
+	return mp.WriteResponse(w, r, NewTransferToCustomerService(to, from, timestamp, kfAccount))
+}
@@ -0,0 +1,83 @@
+package response
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+func newTestRequest(encryptType string) *mp.Request {
+	r := &mp.Request{
+		Token:       "token",
+		Timestamp:   1460000000,
+		Nonce:       "nonce",
+		EncryptType: encryptType,
+		MixedMsg: &mp.MixedMessage{
+			MessageHeader: mp.MessageHeader{
+				ToUserName:   "gh_account",
+				FromUserName: "user",
+				CreateTime:   1459999999,
+				MsgType:      "text",
+			},
+		},
+		Random: []byte("0123456789abcdef"),
+		AppId:  "wx0000000000000000",
+	}
+	copy(r.AESKey[:], "0123456789abcdef0123456789abcdef")
+	return r
+}
+
+func checkTestText(t *testing.T, rawMsgXML []byte) {
+	var text Text
+	if err := xml.Unmarshal(rawMsgXML, &text); err != nil {
+		t.Fatal(err)
+	}
+	if text.ToUserName != "user" || text.FromUserName != "gh_account" || text.CreateTime != 1460000000 ||
+		text.MsgType != MsgTypeText || text.Content != "hello" {
+		t.Errorf("TestReplyText failed, have: %+v\n", text)
+	}
+}
+
+func TestReplyText(t *testing.T) {
+	// 明文模式
+	w := httptest.NewRecorder()
+	if err := ReplyText(w, newTestRequest("raw"), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	checkTestText(t, w.Body.Bytes())
+
+	// 安全模式
+	r := newTestRequest("aes")
+	w = httptest.NewRecorder()
+	if err := ReplyText(w, r, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	var body mp.ResponseHttpBody
+	if err := xml.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(body.EncryptedMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rawMsgXML, _, err := util.AESDecryptMsg(ciphertext, r.AESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestText(t, rawMsgXML)
+}
+
+func TestReplyNilMixedMsg(t *testing.T) {
+	r := newTestRequest("raw")
+	r.MixedMsg = nil
+	if err := ReplyText(httptest.NewRecorder(), r, "hello"); err == nil {
+		t.Errorf("TestReplyNilMixedMsg failed, want error\n")
+	}
+	if err := ReplyText(httptest.NewRecorder(), nil, "hello"); err == nil {
+		t.Errorf("TestReplyNilMixedMsg failed, want error\n")
+	}
+}
@@ -13,6 +13,11 @@ const (
 	EventTypeTemplateSendJobFinish = "TEMPLATESENDJOBFINISH"
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeTemplateSendJobFinish, (*TemplateSendJobFinishEvent)(nil))
+}
+
 const (
 	TemplateSendStatusSuccess            = "success"               // 送达成功时
 	TemplateSendStatusFailedUserBlock    = "failed:user block"     // 送达由于用户拒收(用户设置拒绝接收公众号消息)而失败
@@ -39,6 +39,7 @@ type Request struct {
 	// 下面的字段是 AES 模式才有的
 	MsgSignature string   // 请求 URL 中的消息体签名: msg_signature
 	AESKey       [32]byte // 当前消息 AES 加密的 key
+	AESKeyId     string   // 解密当前消息的 AES Key 的 Id, 见 AESKeyRing
 	Random       []byte   // 当前消息加密时所用的 random, 16 bytes
 	AppId        string   // 当前消息加密时所用的 AppId
 }
@@ -142,6 +143,12 @@ type MixedMessage struct {
 	VendorId    string `xml:"VendorId"    json:"VendorId"`
 	PlaceId     int64  `xml:"PlaceId"     json:"PlaceId"`
 	DeviceNo    string `xml:"DeviceNo"    json:"DeviceNo"`
+
+	// wxa
+	SuccTime   int64  `xml:"SuccTime"   json:"SuccTime"`
+	FailTime   int64  `xml:"FailTime"   json:"FailTime"`
+	Reason     string `xml:"Reason"     json:"Reason"`
+	ScreenShot string `xml:"ScreenShot" json:"ScreenShot"`
 }
 
 // 和 github.com/chanxuehong/wechat/mp/shakearound.ChosenBeacon 一样, 同步修改
@@ -0,0 +1,118 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mp
+
+import (
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+var ErrMessageTypeNotRegistered = errors.New("message type not registered")
+
+// 消息(事件)类型注册表, 各个子包在 init 里注册自己的消息(事件)结构.
+var msgTypeRegistry = struct {
+	rwmutex  sync.RWMutex
+	msgMap   map[string]reflect.Type // map[MsgType]reflect.Type
+	eventMap map[string]reflect.Type // map[EventType]reflect.Type
+}{
+	msgMap:   make(map[string]reflect.Type),
+	eventMap: make(map[string]reflect.Type),
+}
+
+// 检查 typ 是否是结构体的指针, 返回结构体的类型.
+func registryStructType(typ interface{}) reflect.Type {
+	t := reflect.TypeOf(typ)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic("typ must be a pointer to struct")
+	}
+	return t.Elem()
+}
+
+// 注册特定类型消息的结构.
+//  typ 是该结构的指针, 一般用 nil 指针即可, 比如 (*request.Text)(nil).
+//  同一个 msgType 多次注册以最后一次为准.
+func RegisterMessageType(msgType string, typ interface{}) {
+	if msgType == "" {
+		panic("empty msgType")
+	}
+	t := registryStructType(typ)
+
+	msgTypeRegistry.rwmutex.Lock()
+	msgTypeRegistry.msgMap[util.ToLower(msgType)] = t
+	msgTypeRegistry.rwmutex.Unlock()
+}
+
+// 注册特定类型事件的结构.
+//  typ 是该结构的指针, 一般用 nil 指针即可, 比如 (*menu.ClickEvent)(nil).
+//  同一个 eventType 多次注册以最后一次为准.
+func RegisterEventType(eventType string, typ interface{}) {
+	if eventType == "" {
+		panic("empty eventType")
+	}
+	t := registryStructType(typ)
+
+	msgTypeRegistry.rwmutex.Lock()
+	msgTypeRegistry.eventMap[util.ToLower(eventType)] = t
+	msgTypeRegistry.rwmutex.Unlock()
+}
+
+// 获取 msgType, eventType 对应的结构类型, 不区分大小写, 如果没有注册返回 nil.
+func registeredType(msgType, eventType string) (t reflect.Type) {
+	msgType = util.ToLower(msgType)
+
+	msgTypeRegistry.rwmutex.RLock()
+	if msgType == "event" {
+		t = msgTypeRegistry.eventMap[util.ToLower(eventType)]
+	} else {
+		t = msgTypeRegistry.msgMap[msgType]
+	}
+	msgTypeRegistry.rwmutex.RUnlock()
+	return
+}
+
+// 根据 MsgType 和 Event 把 rawMsgXML 解析到注册的结构, 返回该结构的指针.
+//  如果没有注册对应的结构, 返回 ErrMessageTypeNotRegistered.
+func DecodeMessage(msgType, eventType string, rawMsgXML []byte) (msg interface{}, err error) {
+	t := registeredType(msgType, eventType)
+	if t == nil {
+		err = ErrMessageTypeNotRegistered
+		return
+	}
+
+	v := reflect.New(t)
+	if err = xml.Unmarshal(rawMsgXML, v.Interface()); err != nil {
+		return
+	}
+	msg = v.Interface()
+	return
+}
+
+// 把消息(事件)解析到注册的结构, 返回该结构的指针, 可以用 type switch 来判断具体的类型, 比如:
+//
+//  msg, err := r.DecodeMessage()
+//  if err != nil {
+//      ...
+//  }
+//  switch msg := msg.(type) {
+//  case *request.Text:
+//      ...
+//  case *menu.ClickEvent:
+//      ...
+//  }
+//
+//  NOTE: 直接从 RawMsgXML 解析, 所以 MixedMessage 里没有的字段也能解析;
+//  如果没有注册对应的结构(没有 import 对应的子包), 返回 ErrMessageTypeNotRegistered.
+func (r *Request) DecodeMessage() (msg interface{}, err error) {
+	if r.MixedMsg == nil {
+		err = errors.New("nil Request.MixedMsg")
+		return
+	}
+	return DecodeMessage(r.MixedMsg.MsgType, r.MixedMsg.Event, r.RawMsgXML)
+}
@@ -0,0 +1,128 @@
+package mp
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+type testRegistryText struct {
+	XMLName struct{} `xml:"xml"`
+	MessageHeader
+	Content string `xml:"Content"`
+}
+
+type testRegistryEvent struct {
+	XMLName struct{} `xml:"xml"`
+	MessageHeader
+	Event    string `xml:"Event"`
+	EventKey string `xml:"EventKey"`
+}
+
+type testRegistryEvent2 struct {
+	XMLName struct{} `xml:"xml"`
+	MessageHeader
+	Event string `xml:"Event"`
+}
+
+func init() {
+	RegisterMessageType("test_registry_text", (*testRegistryText)(nil))
+	RegisterEventType("Test_Registry_Event", (*testRegistryEvent)(nil))
+}
+
+func TestDecodeMessage(t *testing.T) {
+	textXML := []byte(`<xml><ToUserName>gh</ToUserName><FromUserName>user</FromUserName><CreateTime>1</CreateTime><MsgType>test_registry_text</MsgType><Content>hello</Content></xml>`)
+	for _, msgType := range []string{"test_registry_text", "TEST_REGISTRY_TEXT"} {
+		msg, err := DecodeMessage(msgType, "", textXML)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, ok := msg.(*testRegistryText)
+		if !ok || text.Content != "hello" || text.FromUserName != "user" {
+			t.Errorf("TestDecodeMessage failed, msgType: %s, have: %#v\n", msgType, msg)
+		}
+	}
+
+	eventXML := []byte(`<xml><ToUserName>gh</ToUserName><FromUserName>user</FromUserName><CreateTime>1</CreateTime><MsgType>event</MsgType><Event>test_registry_event</Event><EventKey>key</EventKey></xml>`)
+	for _, msgType := range []string{"event", "EVENT", "Event"} {
+		msg, err := DecodeMessage(msgType, "TEST_registry_event", eventXML)
+		if err != nil {
+			t.Fatalf("TestDecodeMessage failed, msgType: %s, error: %v\n", msgType, err)
+		}
+		event, ok := msg.(*testRegistryEvent)
+		if !ok || event.EventKey != "key" {
+			t.Errorf("TestDecodeMessage failed, msgType: %s, have: %#v\n", msgType, msg)
+		}
+	}
+
+	if _, err := DecodeMessage("test_registry_unknown", "", textXML); err != ErrMessageTypeNotRegistered {
+		t.Errorf("TestDecodeMessage failed, have: %v, want: %v\n", err, ErrMessageTypeNotRegistered)
+	}
+	if _, err := DecodeMessage("event", "test_registry_unknown", eventXML); err != ErrMessageTypeNotRegistered {
+		t.Errorf("TestDecodeMessage failed, have: %v, want: %v\n", err, ErrMessageTypeNotRegistered)
+	}
+	// 事件类型和消息类型是两个表
+	if _, err := DecodeMessage("test_registry_event", "", eventXML); err != ErrMessageTypeNotRegistered {
+		t.Errorf("TestDecodeMessage failed, have: %v, want: %v\n", err, ErrMessageTypeNotRegistered)
+	}
+	if _, err := DecodeMessage("test_registry_text", "", []byte("<xml>")); err == nil {
+		t.Errorf("TestDecodeMessage failed, want xml error\n")
+	}
+}
+
+func TestRequestDecodeMessage(t *testing.T) {
+	rawMsgXML := []byte(`<xml><ToUserName>gh</ToUserName><FromUserName>user</FromUserName><CreateTime>1</CreateTime><MsgType>EVENT</MsgType><Event>TEST_REGISTRY_EVENT</Event><EventKey>key</EventKey></xml>`)
+	var mixedMsg MixedMessage
+	if err := xml.Unmarshal(rawMsgXML, &mixedMsg); err != nil {
+		t.Fatal(err)
+	}
+	r := &Request{
+		RawMsgXML: rawMsgXML,
+		MixedMsg:  &mixedMsg,
+	}
+	msg, err := r.DecodeMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := msg.(*testRegistryEvent); !ok || event.EventKey != "key" {
+		t.Errorf("TestRequestDecodeMessage failed, have: %#v\n", msg)
+	}
+
+	r.MixedMsg = nil
+	if _, err = r.DecodeMessage(); err == nil {
+		t.Errorf("TestRequestDecodeMessage failed, want nil MixedMsg error\n")
+	}
+}
+
+func TestRegisterEventTypeOverride(t *testing.T) {
+	RegisterEventType("test_registry_override", (*testRegistryEvent)(nil))
+	RegisterEventType("TEST_REGISTRY_OVERRIDE", (*testRegistryEvent2)(nil))
+
+	msg, err := DecodeMessage("event", "test_registry_override", []byte(`<xml><Event>test_registry_override</Event></xml>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := msg.(*testRegistryEvent2); !ok {
+		t.Errorf("TestRegisterEventTypeOverride failed, have: %T, want: %T\n", msg, (*testRegistryEvent2)(nil))
+	}
+}
+
+func TestRegisterInvalidType(t *testing.T) {
+	for _, typ := range []interface{}{nil, testRegistryText{}, new(int)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("TestRegisterInvalidType failed, want panic for %T\n", typ)
+				}
+			}()
+			RegisterMessageType("test_registry_invalid", typ)
+		}()
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("TestRegisterInvalidType failed, want panic for empty eventType\n")
+			}
+		}()
+		RegisterEventType("", (*testRegistryEvent)(nil))
+	}()
+}
@@ -25,8 +25,12 @@ import (
 //  来增加一个 Server 来处理 wechat_server=1234567890 的消息(事件).
 //
 //  MultiServerFrontend 并发安全, 可以在运行中动态增加和删除 Server.
+//
+//  如果 Server 很多(比如配置保存在数据库里), 可以用 NewMultiServerFrontendWithRegistry 创建,
+//  通过 ServerRegistry 查找 Server, 也可以根据 URL 的路径来索引 Server, 见 PathServerKey.
 type MultiServerFrontend struct {
-	urlServerQueryName string
+	serverKeyFunc ServerKeyFunc
+	registry      ServerRegistry // 可以为 nil
 
 	errHandler  ErrorHandler
 	interceptor Interceptor
@@ -48,10 +52,37 @@ func NewMultiServerFrontend(urlServerQueryName string, errHandler ErrorHandler,
 	}
 
 	return &MultiServerFrontend{
-		urlServerQueryName: urlServerQueryName,
-		errHandler:         errHandler,
-		interceptor:        interceptor,
-		serverMap:          make(map[string]Server),
+		serverKeyFunc: QueryServerKey(urlServerQueryName),
+		errHandler:    errHandler,
+		interceptor:   interceptor,
+		serverMap:     make(map[string]Server),
+	}
+}
+
+// NewMultiServerFrontendWithRegistry 创建一个通过 ServerRegistry 查找 Server 的 MultiServerFrontend.
+//  registry:      Server 的注册表, 通过 SetServer 增加的 Server 优先
+//  serverKeyFunc: 从请求中获取索引 Server 的 key, 见 QueryServerKey, PathServerKey
+//  errHandler:    错误处理 handler, 可以为 nil
+//  interceptor:   拦截器, 可以为 nil
+func NewMultiServerFrontendWithRegistry(registry ServerRegistry, serverKeyFunc ServerKeyFunc,
+	errHandler ErrorHandler, interceptor Interceptor) *MultiServerFrontend {
+
+	if registry == nil {
+		panic("nil ServerRegistry")
+	}
+	if serverKeyFunc == nil {
+		panic("nil ServerKeyFunc")
+	}
+	if errHandler == nil {
+		errHandler = DefaultErrorHandler
+	}
+
+	return &MultiServerFrontend{
+		serverKeyFunc: serverKeyFunc,
+		registry:      registry,
+		errHandler:    errHandler,
+		interceptor:   interceptor,
+		serverMap:     make(map[string]Server),
 	}
 }
 
@@ -92,9 +123,9 @@ func (frontend *MultiServerFrontend) ServeHTTP(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	serverKey := queryValues.Get(frontend.urlServerQueryName)
+	serverKey := frontend.serverKeyFunc(r, queryValues)
 	if serverKey == "" {
-		err := fmt.Errorf("the url query value with name %s is empty", frontend.urlServerQueryName)
+		err := errors.New("can not get the server key from request url: " + r.URL.String())
 		frontend.errHandler.ServeError(w, r, err)
 		return
 	}
@@ -103,8 +134,15 @@ func (frontend *MultiServerFrontend) ServeHTTP(w http.ResponseWriter, r *http.Re
 	server := frontend.serverMap[serverKey]
 	frontend.rwmutex.RUnlock()
 
+	if server == nil && frontend.registry != nil {
+		if server, err = frontend.registry.Server(serverKey); err != nil && err != ErrServerNotFound {
+			frontend.errHandler.ServeError(w, r, err)
+			return
+		}
+	}
+
 	if server == nil {
-		err := fmt.Errorf("Not found Server for %s == %s", frontend.urlServerQueryName, serverKey)
+		err := fmt.Errorf("Not found Server for server key == %s", serverKey)
 		frontend.errHandler.ServeError(w, r, err)
 		return
 	}
@@ -13,6 +13,11 @@ const (
 	EventTypePoiCheckNotify = "poi_check_notify" // Poi 审核结果事件推送
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypePoiCheckNotify, (*PoiCheckNotifyEvent)(nil))
+}
+
 // Poi 审核结果事件推送
 type PoiCheckNotifyEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
@@ -0,0 +1,37 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mp
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+// ServeCallback 处理微信服务器的回调请求, 和 ServeHTTP 一样, 但是不依赖 net/http,
+// 可以用于 serverless, 消息队列和其他的 http 框架.
+//  method:      回调请求的方法, GET(验证回调 URL) 或者 POST(推送消息)
+//  queryValues: 回调 URL 的查询参数
+//  body:        回调请求的 body, GET 请求为 nil
+//  返回需要回复给微信服务器的内容和 http 状态码; 如果请求不合法(比如签名错误)返回 err, 此时由调用者决定如何回复.
+//  NOTE: 传递给 MessageHandler 的 Request.HttpRequest 为 nil, MessageHandler 写入 http.ResponseWriter 的内容就是 reply.
+func ServeCallback(method string, queryValues url.Values, body []byte, srv Server) (reply []byte, statusCode int, err error) {
+	if srv == nil {
+		panic("nil Server")
+	}
+
+	errHandler := ErrorHandlerFunc(func(w http.ResponseWriter, r *http.Request, e error) {
+		err = e
+	})
+	w := util.NewResponseBuffer()
+	serve(w, nil, method, bytes.NewReader(body), queryValues, srv, errHandler)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return w.Body.Bytes(), w.StatusCode, nil
+}
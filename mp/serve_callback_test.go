@@ -0,0 +1,100 @@
+package mp
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+func newTestCallbackServer() *DefaultServer {
+	handler := MessageHandlerFunc(func(w http.ResponseWriter, r *Request) {
+		if r.HttpRequest != nil {
+			panic("HttpRequest is not nil")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "reply:"+r.MixedMsg.Content)
+	})
+	aesKey := testAESKey("", 1, time.Time{}, time.Time{})
+	return NewDefaultServer("gh_123456789abc", "token", "wx1234567890", aesKey.Key[:], handler)
+}
+
+const testCallbackMsg = "<xml><ToUserName>gh_123456789abc</ToUserName><FromUserName>o</FromUserName><CreateTime>1</CreateTime><MsgType>text</MsgType><Content>hi</Content></xml>"
+
+func TestServeCallbackGET(t *testing.T) {
+	srv := newTestCallbackServer()
+	queryValues := url.Values{
+		"signature": {util.Sign("token", "1460000000", "nonce")},
+		"timestamp": {"1460000000"},
+		"nonce":     {"nonce"},
+		"echostr":   {"echo"},
+	}
+	reply, statusCode, err := ServeCallback("GET", queryValues, nil, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "echo" || statusCode != http.StatusOK {
+		t.Errorf("TestServeCallbackGET failed, have: %s, %d, want: echo, 200\n", reply, statusCode)
+	}
+
+	queryValues.Set("signature", "bad")
+	if reply, statusCode, err = ServeCallback("GET", queryValues, nil, srv); err == nil || reply != nil || statusCode != http.StatusBadRequest {
+		t.Errorf("TestServeCallbackGET failed, have: %s, %d, %v, want signature error\n", reply, statusCode, err)
+	}
+}
+
+func TestServeCallbackPOST(t *testing.T) {
+	srv := newTestCallbackServer()
+
+	// 明文模式
+	queryValues := url.Values{
+		"signature": {util.Sign("token", "1460000000", "nonce")},
+		"timestamp": {"1460000000"},
+		"nonce":     {"nonce"},
+	}
+	reply, statusCode, err := ServeCallback("POST", queryValues, []byte(testCallbackMsg), srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "reply:hi" || statusCode != http.StatusOK {
+		t.Errorf("TestServeCallbackPOST failed, have: %s, %d, want: reply:hi, 200\n", reply, statusCode)
+	}
+
+	// 安全模式
+	encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg([]byte("0123456789abcdef"), []byte(testCallbackMsg), "wx1234567890", srv.CurrentAESKey()))
+	queryValues = url.Values{
+		"encrypt_type":  {"aes"},
+		"timestamp":     {"1460000000"},
+		"nonce":         {"nonce"},
+		"msg_signature": {util.MsgSign("token", "1460000000", "nonce", encryptedMsg)},
+	}
+	body := []byte("<xml><ToUserName>gh_123456789abc</ToUserName><Encrypt>" + encryptedMsg + "</Encrypt></xml>")
+	if reply, _, err = ServeCallback("POST", queryValues, body, srv); err != nil || string(reply) != "reply:hi" {
+		t.Errorf("TestServeCallbackPOST failed, have: %s, %v, want: reply:hi\n", reply, err)
+	}
+
+	queryValues.Set("msg_signature", "bad")
+	if reply, statusCode, err = ServeCallback("POST", queryValues, body, srv); err == nil || reply != nil || statusCode != http.StatusBadRequest {
+		t.Errorf("TestServeCallbackPOST failed, have: %s, %d, %v, want signature error\n", reply, statusCode, err)
+	}
+}
+
+func TestServeCallbackMethod(t *testing.T) {
+	srv := newTestCallbackServer()
+	queryValues := url.Values{
+		"signature": {util.Sign("token", "1460000000", "nonce")},
+		"timestamp": {"1460000000"},
+		"nonce":     {"nonce"},
+		"echostr":   {"echo"},
+	}
+	for _, method := range []string{"PUT", "HEAD", "get", ""} {
+		reply, statusCode, err := ServeCallback(method, queryValues, []byte(testCallbackMsg), srv)
+		if err == nil || reply != nil || statusCode != http.StatusBadRequest {
+			t.Errorf("TestServeCallbackMethod failed, method: %q, have: %s, %d, %v, want error\n", method, reply, statusCode, err)
+		}
+	}
+}
@@ -38,7 +38,14 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 	LogInfoln("[WECHAT_DEBUG] request remote-addr:", r.RemoteAddr)
 	LogInfoln("[WECHAT_DEBUG] request user-agent:", r.UserAgent())
 
-	switch r.Method {
+	serve(w, r, r.Method, r.Body, queryValues, srv, errHandler)
+}
+
+// ServeHTTP 的实现, r 可以为 nil, 见 ServeCallback.
+func serve(w http.ResponseWriter, r *http.Request, method string, body io.Reader,
+	queryValues url.Values, srv Server, errHandler ErrorHandler) {
+
+	switch method {
 	case "POST": // 消息处理
 		switch encryptType := queryValues.Get("encrypt_type"); encryptType {
 		case "aes": // 安全模式, 兼容模式
@@ -69,7 +76,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 				return
 			}
 
-			reqBody, err := ioutil.ReadAll(r.Body)
+			reqBody, err := ioutil.ReadAll(body)
 			if err != nil {
 				errHandler.ServeError(w, r, err)
 				return
@@ -108,23 +115,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 				return
 			}
 
-			aesKey := srv.CurrentAESKey()
-			random, rawMsgXML, haveAppIdBytes, err := util.AESDecryptMsg(encryptedMsgBytes, aesKey)
+			random, rawMsgXML, haveAppIdBytes, aesKey, err := AESDecryptMsg(srv, encryptedMsgBytes)
 			if err != nil {
-				// 尝试用上一次的 AESKey 来解密
-				lastAESKey, isLastAESKeyValid := srv.LastAESKey()
-				if !isLastAESKeyValid {
-					errHandler.ServeError(w, r, err)
-					return
-				}
-
-				aesKey = lastAESKey // NOTE
-
-				random, rawMsgXML, haveAppIdBytes, err = util.AESDecryptMsg(encryptedMsgBytes, aesKey)
-				if err != nil {
-					errHandler.ServeError(w, r, err)
-					return
-				}
+				errHandler.ServeError(w, r, err)
+				return
 			}
 			haveAppId := string(haveAppIdBytes)
 			wantAppId := srv.AppId()
@@ -166,7 +160,8 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 				MixedMsg:    &mixedMsg,
 
 				MsgSignature: msgSignature1,
-				AESKey:       aesKey,
+				AESKey:       aesKey.Key,
+				AESKeyId:     aesKey.Id,
 				Random:       random,
 				AppId:        haveAppId,
 			}
@@ -208,7 +203,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			}
 
 			// 验证签名成功, 解析 MixedMessage
-			rawMsgXML, err := ioutil.ReadAll(r.Body)
+			rawMsgXML, err := ioutil.ReadAll(body)
 			if err != nil {
 				errHandler.ServeError(w, r, err)
 				return
@@ -287,5 +282,8 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 		}
 
 		io.WriteString(w, echostr)
+
+	default:
+		errHandler.ServeError(w, r, errors.New("Not expect Request.Method: "+method))
 	}
 }
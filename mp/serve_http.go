@@ -34,7 +34,14 @@ type RequestHttpBody struct {
 // ServeHTTP 处理 http 消息请求
 //  NOTE: 调用者保证所有参数有效
 func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, srv Server, errHandler ErrorHandler) {
-	switch r.Method {
+	serve(w, r, r.Method, r.Body, queryValues, srv, errHandler)
+}
+
+// ServeHTTP 的实现, r 可以为 nil, 见 ServeCallback.
+func serve(w http.ResponseWriter, r *http.Request, method string, body io.Reader,
+	queryValues url.Values, srv Server, errHandler ErrorHandler) {
+
+	switch method {
 	case "POST": // 消息处理
 		switch encryptType := queryValues.Get("encrypt_type"); encryptType {
 		case "aes": // 安全模式, 兼容模式
@@ -66,7 +73,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			}
 
 			var requestHttpBody RequestHttpBody
-			if err := xml.NewDecoder(r.Body).Decode(&requestHttpBody); err != nil {
+			if err := xml.NewDecoder(body).Decode(&requestHttpBody); err != nil {
 				errHandler.ServeError(w, r, err)
 				return
 			}
@@ -97,23 +104,10 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 				return
 			}
 
-			aesKey := srv.CurrentAESKey()
-			random, rawMsgXML, haveAppIdBytes, err := util.AESDecryptMsg(encryptedMsgBytes, aesKey)
+			random, rawMsgXML, haveAppIdBytes, aesKey, err := AESDecryptMsg(srv, encryptedMsgBytes)
 			if err != nil {
-				// 尝试用上一次的 AESKey 来解密
-				lastAESKey, isLastAESKeyValid := srv.LastAESKey()
-				if !isLastAESKeyValid {
-					errHandler.ServeError(w, r, err)
-					return
-				}
-
-				aesKey = lastAESKey // NOTE
-
-				random, rawMsgXML, haveAppIdBytes, err = util.AESDecryptMsg(encryptedMsgBytes, aesKey)
-				if err != nil {
-					errHandler.ServeError(w, r, err)
-					return
-				}
+				errHandler.ServeError(w, r, err)
+				return
 			}
 			haveAppId := string(haveAppIdBytes)
 			wantAppId := srv.AppId()
@@ -153,7 +147,8 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 				MixedMsg:    &mixedMsg,
 
 				MsgSignature: msgSignature1,
-				AESKey:       aesKey,
+				AESKey:       aesKey.Key,
+				AESKeyId:     aesKey.Id,
 				Random:       random,
 				AppId:        haveAppId,
 			}
@@ -195,7 +190,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 			}
 
 			// 验证签名成功, 解析 MixedMessage
-			rawMsgXML, err := ioutil.ReadAll(r.Body)
+			rawMsgXML, err := ioutil.ReadAll(body)
 			if err != nil {
 				errHandler.ServeError(w, r, err)
 				return
@@ -272,5 +267,8 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request, queryValues url.Values, s
 		}
 
 		io.WriteString(w, echostr)
+
+	default:
+		errHandler.ServeError(w, r, errors.New("Not expect Request.Method: "+method))
 	}
 }
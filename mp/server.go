@@ -6,9 +6,8 @@
 package mp
 
 import (
-	"bytes"
 	"errors"
-	"sync"
+	"time"
 )
 
 type Server interface {
@@ -23,16 +22,14 @@ type Server interface {
 }
 
 var _ Server = (*DefaultServer)(nil)
+var _ AESKeyRingServer = (*DefaultServer)(nil)
 
 type DefaultServer struct {
 	oriId string
 	appId string
 	token string
 
-	rwmutex           sync.RWMutex
-	currentAESKey     [32]byte
-	lastAESKey        [32]byte
-	isLastAESKeyValid bool
+	aesKeyRing *AESKeyRing
 
 	messageHandler MessageHandler
 }
@@ -51,9 +48,14 @@ func NewDefaultServer(oriId, token, appId string, aesKey []byte, handler Message
 		oriId:          oriId,
 		appId:          appId,
 		token:          token,
+		aesKeyRing:     NewAESKeyRing(),
 		messageHandler: handler,
 	}
-	copy(srv.currentAESKey[:], aesKey)
+	if aesKey != nil {
+		var key AESKey
+		copy(key.Key[:], aesKey)
+		srv.aesKeyRing.SetKeys(key)
+	}
 	return
 }
 
@@ -70,33 +72,43 @@ func (srv *DefaultServer) MessageHandler() MessageHandler {
 	return srv.messageHandler
 }
 func (srv *DefaultServer) CurrentAESKey() (key [32]byte) {
-	srv.rwmutex.RLock()
-	key = srv.currentAESKey
-	srv.rwmutex.RUnlock()
+	if aesKey, ok := srv.aesKeyRing.CurrentKey(); ok {
+		key = aesKey.Key
+	}
 	return
 }
 func (srv *DefaultServer) LastAESKey() (key [32]byte, valid bool) {
-	srv.rwmutex.RLock()
-	key = srv.lastAESKey
-	valid = srv.isLastAESKeyValid
-	srv.rwmutex.RUnlock()
+	if keys := srv.aesKeyRing.ValidKeys(time.Now()); len(keys) > 1 {
+		key = keys[1].Key
+		valid = true
+	}
 	return
 }
 
+// 返回 AESKeyRing, 可以通过它设置多个 AES 加密 Key 及其有效期, 或者从外部配置源刷新.
+func (srv *DefaultServer) AESKeyRing() *AESKeyRing {
+	return srv.aesKeyRing
+}
+
+// 更新 AES 加密 Key, 新的 Key 立即生效, 原来的 Key 最晚在 DefaultLastAESKeyTTL 之后过期.
+//  同 UpdateAESKeyWithTTL(aesKey, 0).
 func (srv *DefaultServer) UpdateAESKey(aesKey []byte) (err error) {
+	return srv.UpdateAESKeyWithTTL(aesKey, 0)
+}
+
+// 更新 AES 加密 Key, 新的 Key 立即生效, 原来的 Key 最晚在 lastKeyTTL 之后过期, 见 AESKeyRing.AddKey.
+//  lastKeyTTL <= 0 时使用 DefaultLastAESKeyTTL, 过期的 Key 在下一次更新时被移除, 不会一直累积.
+//  在 AESKeyRing 的锁里完成, 和 AESKeyRing.SetKeys, AESKeyRing.Refresh 并发安全.
+func (srv *DefaultServer) UpdateAESKeyWithTTL(aesKey []byte, lastKeyTTL time.Duration) (err error) {
 	if len(aesKey) != 32 {
 		return errors.New("the length of aesKey must equal to 32")
 	}
 
-	srv.rwmutex.Lock()
-	defer srv.rwmutex.Unlock()
-
-	if bytes.Equal(aesKey, srv.currentAESKey[:]) {
-		return
+	var key AESKey
+	copy(key.Key[:], aesKey)
+	if lastKeyTTL <= 0 {
+		lastKeyTTL = DefaultLastAESKeyTTL
 	}
-
-	srv.isLastAESKeyValid = true
-	srv.lastAESKey = srv.currentAESKey
-	copy(srv.currentAESKey[:], aesKey)
+	srv.aesKeyRing.AddKey(key, lastKeyTTL)
 	return
 }
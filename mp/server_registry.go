@@ -0,0 +1,188 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mp
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrServerNotFound = errors.New("server not found")
+
+// Server 的注册表, MultiServerFrontend 通过它根据 serverKey 查找 Server,
+// 比如从数据库里加载公众号的配置然后创建 Server.
+type ServerRegistry interface {
+	// 根据 serverKey 查找 Server, 没有找到返回 ErrServerNotFound.
+	Server(serverKey string) (Server, error)
+}
+
+type ServerRegistryFunc func(serverKey string) (Server, error)
+
+func (fn ServerRegistryFunc) Server(serverKey string) (Server, error) {
+	return fn(serverKey)
+}
+
+var _ ServerRegistry = (*CachedServerRegistry)(nil)
+
+// 带缓存的 ServerRegistry, 缓存底层 ServerRegistry 查找到的 Server.
+//  公众号的配置修改后调用 Invalidate 使缓存失效.
+//  没有找到的 serverKey 也会缓存一小段时间, 新增公众号后同样调用 Invalidate; 同一个 serverKey 同时只查找一次.
+type CachedServerRegistry struct {
+	registry ServerRegistry
+	ttl      time.Duration
+
+	rwmutex  sync.RWMutex
+	cacheMap map[string]cachedServer
+	inflight map[string]*cachedServerCall // 正在查找的 serverKey, 同一个 serverKey 同时只查找一次
+}
+
+type cachedServer struct {
+	server    Server    // nil 表示没有找到
+	expiresAt time.Time // 零值表示不过期
+}
+
+type cachedServerCall struct {
+	done        chan struct{}
+	server      Server
+	err         error
+	invalidated bool // 查找期间调用了 Invalidate, 结果不能缓存
+}
+
+// 没有找到的 serverKey 也缓存一段时间, 避免不存在的 serverKey 的请求每次都查找底层 ServerRegistry.
+const serverNotFoundTTL = time.Second * 10
+
+// 创建一个新的 CachedServerRegistry.
+//  ttl 为缓存的有效时间, <=0 表示一直有效, 直到调用 Invalidate.
+func NewCachedServerRegistry(registry ServerRegistry, ttl time.Duration) *CachedServerRegistry {
+	if registry == nil {
+		panic("nil ServerRegistry")
+	}
+	return &CachedServerRegistry{
+		registry: registry,
+		ttl:      ttl,
+		cacheMap: make(map[string]cachedServer),
+		inflight: make(map[string]*cachedServerCall),
+	}
+}
+
+func (registry *CachedServerRegistry) Server(serverKey string) (server Server, err error) {
+	registry.rwmutex.RLock()
+	cache, ok := registry.cacheMap[serverKey]
+	registry.rwmutex.RUnlock()
+
+	if ok && (cache.expiresAt.IsZero() || time.Now().Before(cache.expiresAt)) {
+		if server = cache.server; server == nil {
+			err = ErrServerNotFound
+		}
+		return
+	}
+
+	// 同一个 serverKey 同时只查找一次
+	registry.rwmutex.Lock()
+	if call := registry.inflight[serverKey]; call != nil {
+		registry.rwmutex.Unlock()
+		<-call.done
+		return call.server, call.err
+	}
+	call := &cachedServerCall{
+		done: make(chan struct{}),
+		err:  errors.New("find Server panicked"), // 查找 panic 时等待的 goroutine 得到这个错误
+	}
+	registry.inflight[serverKey] = call
+	registry.rwmutex.Unlock()
+
+	defer func() {
+		registry.rwmutex.Lock()
+		if registry.inflight[serverKey] == call {
+			delete(registry.inflight, serverKey)
+		}
+		if !call.invalidated {
+			registry.store(serverKey, call.server, call.err)
+		}
+		registry.rwmutex.Unlock()
+		close(call.done)
+	}()
+
+	call.server, call.err = registry.registry.Server(serverKey)
+	if call.err == nil && call.server == nil {
+		call.err = ErrServerNotFound
+	}
+	return call.server, call.err
+}
+
+// 缓存查找的结果, 其他错误不缓存, 调用者需要持有 registry.rwmutex 的写锁.
+func (registry *CachedServerRegistry) store(serverKey string, server Server, err error) {
+	var cache cachedServer
+	switch {
+	case err == nil:
+		cache.server = server
+		if registry.ttl > 0 {
+			cache.expiresAt = time.Now().Add(registry.ttl)
+		}
+	case err == ErrServerNotFound:
+		ttl := serverNotFoundTTL
+		if registry.ttl > 0 && registry.ttl < ttl {
+			ttl = registry.ttl
+		}
+		cache.expiresAt = time.Now().Add(ttl)
+	default:
+		return
+	}
+	registry.cacheMap[serverKey] = cache
+}
+
+// 使 serverKey 对应的缓存失效.
+func (registry *CachedServerRegistry) Invalidate(serverKey string) {
+	registry.rwmutex.Lock()
+	delete(registry.cacheMap, serverKey)
+	if call := registry.inflight[serverKey]; call != nil {
+		call.invalidated = true
+		delete(registry.inflight, serverKey)
+	}
+	registry.rwmutex.Unlock()
+}
+
+// 使所有的缓存失效.
+func (registry *CachedServerRegistry) InvalidateAll() {
+	registry.rwmutex.Lock()
+	registry.cacheMap = make(map[string]cachedServer)
+	for _, call := range registry.inflight {
+		call.invalidated = true
+	}
+	registry.inflight = make(map[string]*cachedServerCall)
+	registry.rwmutex.Unlock()
+}
+
+// 从 http 请求中获取索引 Server 的 key, 获取不到返回空字符串.
+type ServerKeyFunc func(r *http.Request, queryValues url.Values) (serverKey string)
+
+// 从回调 URL 的查询参数获取 serverKey, 例如 name == "wechat_server":
+//  http://www.xxx.com/weixin?wechat_server=1234567890 的 serverKey 为 1234567890.
+func QueryServerKey(name string) ServerKeyFunc {
+	return func(r *http.Request, queryValues url.Values) string {
+		return queryValues.Get(name)
+	}
+}
+
+// 从回调 URL 的路径获取 serverKey, 取 prefix 后面的第一段, 例如 prefix == "/weixin/":
+//  http://www.xxx.com/weixin/1234567890 的 serverKey 为 1234567890.
+func PathServerKey(prefix string) ServerKeyFunc {
+	return func(r *http.Request, queryValues url.Values) string {
+		path := r.URL.Path
+		if !strings.HasPrefix(path, prefix) {
+			return ""
+		}
+		path = path[len(prefix):]
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			path = path[:i]
+		}
+		return path
+	}
+}
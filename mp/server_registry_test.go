@@ -0,0 +1,168 @@
+package mp
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testRegistryServer struct {
+	Server
+	key string
+}
+
+// 记录查找次数的 ServerRegistry, servers 里没有的 serverKey 返回 nil, nil.
+type testServerRegistry struct {
+	calls   int32
+	block   chan struct{} // 不为 nil 时查找等待它关闭
+	err     error
+	servers map[string]Server
+}
+
+func (registry *testServerRegistry) Server(serverKey string) (Server, error) {
+	atomic.AddInt32(&registry.calls, 1)
+	if registry.block != nil {
+		<-registry.block
+	}
+	if registry.err != nil {
+		return nil, registry.err
+	}
+	return registry.servers[serverKey], nil
+}
+
+func (registry *testServerRegistry) Calls() int32 {
+	return atomic.LoadInt32(&registry.calls)
+}
+
+func TestCachedServerRegistry(t *testing.T) {
+	server := &testRegistryServer{key: "gh_1"}
+	registry := &testServerRegistry{servers: map[string]Server{"gh_1": server}}
+	cached := NewCachedServerRegistry(registry, 0)
+
+	for i := 0; i < 2; i++ {
+		have, err := cached.Server("gh_1")
+		if err != nil || have != server {
+			t.Errorf("TestCachedServerRegistry failed, have: %v, %v\n", have, err)
+		}
+	}
+	if n := registry.Calls(); n != 1 {
+		t.Errorf("TestCachedServerRegistry failed, have calls: %d, want: 1\n", n)
+	}
+
+	cached.Invalidate("gh_1")
+	if _, err := cached.Server("gh_1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := registry.Calls(); n != 2 {
+		t.Errorf("TestCachedServerRegistry failed, have calls: %d, want: 2\n", n)
+	}
+}
+
+func TestCachedServerRegistryNotFound(t *testing.T) {
+	registry := &testServerRegistry{servers: map[string]Server{}}
+	cached := NewCachedServerRegistry(registry, 0)
+
+	// 没有找到的结果也缓存
+	for i := 0; i < 3; i++ {
+		if server, err := cached.Server("gh_unknown"); err != ErrServerNotFound || server != nil {
+			t.Errorf("TestCachedServerRegistryNotFound failed, have: %v, %v, want: %v\n", server, err, ErrServerNotFound)
+		}
+	}
+	if n := registry.Calls(); n != 1 {
+		t.Errorf("TestCachedServerRegistryNotFound failed, have calls: %d, want: 1\n", n)
+	}
+
+	// 新增公众号后 Invalidate 马上生效
+	server := &testRegistryServer{key: "gh_unknown"}
+	registry.servers["gh_unknown"] = server
+	cached.Invalidate("gh_unknown")
+	if have, err := cached.Server("gh_unknown"); err != nil || have != server {
+		t.Errorf("TestCachedServerRegistryNotFound failed, have: %v, %v\n", have, err)
+	}
+
+	// 没有找到的缓存时间不超过 ttl
+	registry = &testServerRegistry{servers: map[string]Server{}}
+	cached = NewCachedServerRegistry(registry, time.Millisecond*20)
+	cached.Server("gh_unknown")
+	time.Sleep(time.Millisecond * 30)
+	cached.Server("gh_unknown")
+	if n := registry.Calls(); n != 2 {
+		t.Errorf("TestCachedServerRegistryNotFound failed, have calls: %d, want: 2\n", n)
+	}
+}
+
+// 其他错误不缓存.
+func TestCachedServerRegistryError(t *testing.T) {
+	registry := &testServerRegistry{err: errors.New("database is down")}
+	cached := NewCachedServerRegistry(registry, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Server("gh_1"); err != registry.err {
+			t.Errorf("TestCachedServerRegistryError failed, have: %v, want: %v\n", err, registry.err)
+		}
+	}
+	if n := registry.Calls(); n != 2 {
+		t.Errorf("TestCachedServerRegistryError failed, have calls: %d, want: 2\n", n)
+	}
+}
+
+// 同一个 serverKey 同时只查找一次.
+func TestCachedServerRegistryConcurrent(t *testing.T) {
+	server := &testRegistryServer{key: "gh_1"}
+	registry := &testServerRegistry{
+		block:   make(chan struct{}),
+		servers: map[string]Server{"gh_1": server},
+	}
+	cached := NewCachedServerRegistry(registry, 0)
+
+	var wg sync.WaitGroup
+	results := make([]Server, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cached.Server("gh_1")
+		}(i)
+	}
+	time.Sleep(time.Millisecond * 50) // 让其他 goroutine 都等待在 inflight 上
+	close(registry.block)
+	wg.Wait()
+
+	if n := registry.Calls(); n != 1 {
+		t.Errorf("TestCachedServerRegistryConcurrent failed, have calls: %d, want: 1\n", n)
+	}
+	for i, have := range results {
+		if have != server {
+			t.Errorf("TestCachedServerRegistryConcurrent failed, result %d: %v\n", i, have)
+		}
+	}
+}
+
+// 查找期间调用 Invalidate, 查找的结果不缓存.
+func TestCachedServerRegistryInvalidateInflight(t *testing.T) {
+	registry := &testServerRegistry{
+		block:   make(chan struct{}),
+		servers: map[string]Server{"gh_1": &testRegistryServer{key: "old"}},
+	}
+	cached := NewCachedServerRegistry(registry, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cached.Server("gh_1")
+	}()
+	for registry.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cached.InvalidateAll()
+	close(registry.block)
+	<-done
+
+	server := &testRegistryServer{key: "new"}
+	registry.servers = map[string]Server{"gh_1": server}
+	if have, err := cached.Server("gh_1"); err != nil || have != server {
+		t.Errorf("TestCachedServerRegistryInvalidateInflight failed, have: %v, %v\n", have, err)
+	}
+}
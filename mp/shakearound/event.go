@@ -16,6 +16,11 @@ const (
 	EventTypeUserShake = "ShakearoundUserShake" // 摇一摇事件通知
 )
 
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeUserShake, (*UserShakeEvent)(nil))
+}
+
 type UserShakeEvent struct {
 	XMLName struct{} `xml:"xml" json:"-"`
 	mp.MessageHeader
@@ -0,0 +1,94 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mp
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/util/security"
+
+	"github.com/chanxuehong/wechat/json"
+)
+
+// 中控服务器的状态, 用于排查问题(比如 api 返回 40001 的时候).
+type TokenServerStatus struct {
+	LastRefreshTime time.Time `json:"last_refresh_time"` // 最后一次成功刷新的时间, 零值表示还没有成功刷新过
+	ExpiresAt       time.Time `json:"expires_at"`        // 当前缓存的 access_token 的过期时间, 零值表示没有缓存
+	LastError       string    `json:"last_error"`        // 最后一次刷新失败的错误, 刷新成功后清空
+	LastErrorTime   time.Time `json:"last_error_time"`   // 最后一次刷新失败的时间
+	RefreshCount    int64     `json:"refresh_count"`     // 成功刷新的次数
+	ErrorCount      int64     `json:"error_count"`       // 刷新失败的次数
+	DaemonRunning   bool      `json:"daemon_running"`    // 后台定时刷新的 goroutine 是否在运行
+}
+
+// 可以查询状态的中控服务器, DefaultAccessTokenServer, component.DefaultAccessTokenServer,
+// component.AuthorizerAccessTokenServer 都实现了该接口.
+type TokenStatusServer interface {
+	// 请求中控服务器到微信服务器刷新 access_token.
+	TokenRefresh() (string, error)
+
+	// 返回中控服务器当前的状态.
+	Status() TokenServerStatus
+}
+
+// 中控服务器的管理接口:
+//  GET  返回 srv.Status() 的 JSON;
+//  POST 强制刷新 access_token, 然后返回 srv.Status() 的 JSON, 刷新失败时 http 状态码为 502.
+//
+//  POST 需要认证, 请求头为 Authorization: Bearer <adminToken>;
+//  如果 adminToken 为空则不允许 POST. 返回的 JSON 里不包含 access_token.
+func NewTokenStatusHandler(srv TokenStatusServer, adminToken string) http.Handler {
+	if srv == nil {
+		panic("nil TokenStatusServer")
+	}
+	return &tokenStatusHandler{
+		srv:        srv,
+		adminToken: adminToken,
+	}
+}
+
+type tokenStatusHandler struct {
+	srv        TokenStatusServer
+	adminToken string
+}
+
+func (h *tokenStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusOK
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if !h.authorized(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if _, err := h.srv.TokenRefresh(); err != nil {
+			code = http.StatusBadGateway
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(h.srv.Status())
+}
+
+func (h *tokenStatusHandler) authorized(r *http.Request) bool {
+	if h.adminToken == "" {
+		return false
+	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return security.SecureCompareString(auth[len(prefix):], h.adminToken)
+}
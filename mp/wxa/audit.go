@@ -0,0 +1,112 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"github.com/chanxuehong/wechat/mp"
+)
+
+const (
+	AuditStatusSuccess   = 0 // 审核成功
+	AuditStatusFail      = 1 // 审核失败
+	AuditStatusAuditing  = 2 // 审核中
+	AuditStatusWithdrawn = 3 // 已撤回
+)
+
+// 提交审核的页面配置, 类目信息来自 GetCategory, 页面来自 GetPage.
+type AuditItem struct {
+	Address     string `json:"address"`               // 小程序的页面, 可通过 GetPage 获取
+	Tag         string `json:"tag"`                   // 小程序的标签, 多个标签用空格分隔, 标签不能多于 10 个, 标签长度不超过 20
+	Title       string `json:"title"`                 // 小程序页面的标题, 标题长度不超过 32
+	FirstClass  string `json:"first_class"`           // 一级类目名称
+	SecondClass string `json:"second_class"`          // 二级类目名称
+	ThirdClass  string `json:"third_class,omitempty"` // 三级类目名称
+	FirstId     int64  `json:"first_id"`              // 一级类目的ID编号
+	SecondId    int64  `json:"second_id"`             // 二级类目的ID编号
+	ThirdId     int64  `json:"third_id,omitempty"`    // 三级类目的ID编号
+}
+
+// 将第三方提交的代码包提交审核, 返回审核编号.
+//  审核结果通过 weapp_audit_success, weapp_audit_fail 事件推送, 见 AuditSuccessEvent, AuditFailEvent.
+func (clt *Client) SubmitAudit(itemList []AuditItem) (auditId int64, err error) {
+	request := struct {
+		ItemList []AuditItem `json:"item_list"`
+	}{
+		ItemList: itemList,
+	}
+
+	var result struct {
+		mp.Error
+		AuditId int64 `json:"auditid"`
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/submit_audit?access_token="
+	if err = ((*mp.Client)(clt)).PostJSON(incompleteURL, &request, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	auditId = result.AuditId
+	return
+}
+
+// 审核状态.
+type AuditStatus struct {
+	AuditId    int64  `json:"auditid,omitempty"` // 审核编号, 只有 GetLatestAuditStatus 返回
+	Status     int    `json:"status"`            // 审核状态, AuditStatusSuccess, AuditStatusFail, AuditStatusAuditing, AuditStatusWithdrawn
+	Reason     string `json:"reason"`            // 审核失败时的原因
+	ScreenShot string `json:"screenshot"`        // 审核失败时的截图示例, 多个用 | 分隔, 是临时素材的 media_id
+}
+
+// 查询某个指定版本的审核状态.
+func (clt *Client) GetAuditStatus(auditId int64) (status *AuditStatus, err error) {
+	request := struct {
+		AuditId int64 `json:"auditid"`
+	}{
+		AuditId: auditId,
+	}
+
+	var result struct {
+		mp.Error
+		AuditStatus
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/get_auditstatus?access_token="
+	if err = ((*mp.Client)(clt)).PostJSON(incompleteURL, &request, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	result.AuditStatus.AuditId = auditId
+	status = &result.AuditStatus
+	return
+}
+
+// 查询最新一次提交的审核状态.
+func (clt *Client) GetLatestAuditStatus() (status *AuditStatus, err error) {
+	var result struct {
+		mp.Error
+		AuditStatus
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/get_latest_auditstatus?access_token="
+	if err = ((*mp.Client)(clt)).GetJSON(incompleteURL, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	status = &result.AuditStatus
+	return
+}
@@ -0,0 +1,60 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 小程序帐号的可选类目.
+type Category struct {
+	FirstClass  string `json:"first_class"`  // 一级类目名称
+	SecondClass string `json:"second_class"` // 二级类目名称
+	ThirdClass  string `json:"third_class"`  // 三级类目名称
+	FirstId     int64  `json:"first_id"`     // 一级类目的ID编号
+	SecondId    int64  `json:"second_id"`    // 二级类目的ID编号
+	ThirdId     int64  `json:"third_id"`     // 三级类目的ID编号
+}
+
+// 获取授权小程序帐号的可选类目.
+func (clt *Client) GetCategory() (categoryList []Category, err error) {
+	var result struct {
+		mp.Error
+		CategoryList []Category `json:"category_list"`
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/get_category?access_token="
+	if err = ((*mp.Client)(clt)).GetJSON(incompleteURL, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	categoryList = result.CategoryList
+	return
+}
+
+// 获取小程序的第三方提交代码的页面配置.
+func (clt *Client) GetPage() (pageList []string, err error) {
+	var result struct {
+		mp.Error
+		PageList []string `json:"page_list"`
+	}
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/get_page?access_token="
+	if err = ((*mp.Client)(clt)).GetJSON(incompleteURL, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	pageList = result.PageList
+	return
+}
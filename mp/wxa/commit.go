@@ -0,0 +1,58 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 为授权的小程序帐号上传小程序代码.
+//  templateId:  代码库中的代码模版ID
+//  extJSON:     第三方自定义的配置, 可以是 JSON 字符串, 也可以是任意可以 JSON 编码的值(比如 map, struct), 可以为 nil
+//  userVersion: 代码版本号, 开发者可自定义
+//  userDesc:    代码描述, 开发者可自定义
+func (clt *Client) Commit(templateId int64, extJSON interface{}, userVersion, userDesc string) (err error) {
+	var extJSONString string
+	switch v := extJSON.(type) {
+	case nil:
+	case string:
+		extJSONString = v
+	case []byte:
+		extJSONString = string(v)
+	default:
+		var b []byte
+		if b, err = json.Marshal(v); err != nil {
+			return
+		}
+		extJSONString = string(b)
+	}
+
+	request := struct {
+		TemplateId  int64  `json:"template_id"`
+		ExtJSON     string `json:"ext_json,omitempty"`
+		UserVersion string `json:"user_version"`
+		UserDesc    string `json:"user_desc"`
+	}{
+		TemplateId:  templateId,
+		ExtJSON:     extJSONString,
+		UserVersion: userVersion,
+		UserDesc:    userDesc,
+	}
+
+	var result mp.Error
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/commit?access_token="
+	if err = ((*mp.Client)(clt)).PostJSON(incompleteURL, &request, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result
+		return
+	}
+	return
+}
@@ -0,0 +1,146 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chanxuehong/util/security"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/json"
+)
+
+var ErrWatermarkMismatch = errors.New("watermark appid mismatch")
+
+// 加密数据的水印.
+type Watermark struct {
+	AppId     string `json:"appid"`     // 小程序的 AppId
+	Timestamp int64  `json:"timestamp"` // 获取加密数据的时间戳
+}
+
+// 校验水印, appid 必须等于 appId; maxAge > 0 时, 获取加密数据的时间距今不能超过 maxAge.
+func (w *Watermark) Check(appId string, maxAge time.Duration) (err error) {
+	if w.AppId != appId {
+		return ErrWatermarkMismatch
+	}
+	if maxAge > 0 {
+		if age := time.Since(time.Unix(w.Timestamp, 0)); age > maxAge || age < -maxAge {
+			return fmt.Errorf("watermark timestamp expired: %d", w.Timestamp)
+		}
+	}
+	return
+}
+
+// 用户信息, wx.getUserInfo 的 encryptedData 解密后的数据.
+type UserInfo struct {
+	OpenId    string    `json:"openId"`
+	UnionId   string    `json:"unionId"`
+	Nickname  string    `json:"nickName"`
+	Gender    int       `json:"gender"` // 0: 未知, 1: 男性, 2: 女性
+	City      string    `json:"city"`
+	Province  string    `json:"province"`
+	Country   string    `json:"country"`
+	AvatarURL string    `json:"avatarUrl"`
+	Language  string    `json:"language"`
+	Watermark Watermark `json:"watermark"`
+}
+
+// 用户绑定的手机号, getPhoneNumber 的 encryptedData 解密后的数据.
+type PhoneNumber struct {
+	PhoneNumber     string    `json:"phoneNumber"`     // 用户绑定的手机号(国外手机号会有区号)
+	PurePhoneNumber string    `json:"purePhoneNumber"` // 没有区号的手机号
+	CountryCode     string    `json:"countryCode"`     // 区号
+	Watermark       Watermark `json:"watermark"`
+}
+
+// 转发信息, wx.getShareInfo 的 encryptedData 解密后的数据.
+type ShareInfo struct {
+	OpenGId   string    `json:"openGId"` // 群对当前小程序的唯一ID
+	Watermark Watermark `json:"watermark"`
+}
+
+// 校验 rawData 的签名, signature == sha1(rawData + session_key).
+func CheckSignature(rawData, sessionKey, signature string) bool {
+	hashsum := sha1.Sum([]byte(rawData + sessionKey))
+	return security.SecureCompareString(signature, hex.EncodeToString(hashsum[:]))
+}
+
+// 用 session_key 解密 encryptedData, sessionKey, encryptedData, iv 都是 base64 编码的.
+func Decrypt(sessionKey, encryptedData, iv string) (plaintext []byte, err error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil {
+		return
+	}
+	if len(key) != 16 {
+		err = fmt.Errorf("the length of session_key is incorrect: %d", len(key))
+		return
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return
+	}
+	ivBytes, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil {
+		return
+	}
+	return util.AESCBCDecrypt(ciphertext, key, ivBytes)
+}
+
+// 解密 encryptedData 到 v, 并校验数据中的水印, 见 Watermark.Check.
+//  v 一般为 *UserInfo, *PhoneNumber, *ShareInfo, 也可以是其他结构的指针.
+func DecryptTo(appId, sessionKey, encryptedData, iv string, maxAge time.Duration, v interface{}) (err error) {
+	plaintext, err := Decrypt(sessionKey, encryptedData, iv)
+	if err != nil {
+		return
+	}
+
+	var data struct {
+		Watermark *Watermark `json:"watermark"`
+	}
+	if err = json.Unmarshal(plaintext, &data); err != nil {
+		return
+	}
+	if data.Watermark == nil {
+		return errors.New("watermark not found")
+	}
+	if err = data.Watermark.Check(appId, maxAge); err != nil {
+		return
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// 解密用户信息.
+func DecryptUserInfo(appId, sessionKey, encryptedData, iv string, maxAge time.Duration) (info *UserInfo, err error) {
+	info = &UserInfo{}
+	if err = DecryptTo(appId, sessionKey, encryptedData, iv, maxAge, info); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 解密用户绑定的手机号.
+func DecryptPhoneNumber(appId, sessionKey, encryptedData, iv string, maxAge time.Duration) (phone *PhoneNumber, err error) {
+	phone = &PhoneNumber{}
+	if err = DecryptTo(appId, sessionKey, encryptedData, iv, maxAge, phone); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 解密转发信息.
+func DecryptShareInfo(appId, sessionKey, encryptedData, iv string, maxAge time.Duration) (info *ShareInfo, err error) {
+	info = &ShareInfo{}
+	if err = DecryptTo(appId, sessionKey, encryptedData, iv, maxAge, info); err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package wxa
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 微信公众平台文档里的示例数据
+const (
+	testAppId         = "wx4f4bc4dec97d474b"
+	testSessionKey    = "tiihtNczf5v6AKRyjwEUhQ=="
+	testIV            = "r7BXXKkLb8qrSNn05n0qiA=="
+	testEncryptedData = "CiyLU1Aw2KjvrjMdj8YKliAjtP4gsMZMQmRzooG2xrDcvSnxIMXFufNstNGTyaGS9uT5geRa0W4oTOb1WT7fJlAC+oNPdbB+3hVbJSRgv+4lGOETKUQz6OYStslQ142dNCuabNPGBzlooOmB231qMM85d2/fV6ChevvXvQP8Hkue1poOFtnEtpyxVLW1zAo6/1Xx1COxFvrc2d7UL/lmHInNlxuacJXwu0fjpXfz/YqYzBIBzD6WUfTIF9GRHpOn/Hz7saL8xz+W//FRAUid1OksQaQx4CMs8LOddcQhULW4ucetDf96JcR3g0gfRK4PC7E/r7Z6xNrXd2UIeorGj5Ef7b1pJAYB6Y5anaHqZ9J6nKEBvB4DnNLIVWSgARns/8wR2SiRS7MNACwTyrGvt9ts8p12PKFdlqYTopNHR1Vf7XjfhQlVsAJdNiKdYmYVoKlaRv85IfVunYzO0IKXsyl7JCUjCpoG20f0a04COwfneQAGGwd5oa+T8yO5hzuyDb/XcxxmK01EpqOyuxINew=="
+)
+
+// 用示例的 session_key 和 iv 加密 plaintext, pad 为 false 时不补位, len(plaintext) 必须是 aes.BlockSize 的整数倍.
+func testEncrypt(plaintext []byte, pad bool) string {
+	key, _ := base64.StdEncoding.DecodeString(testSessionKey)
+	iv, _ := base64.StdEncoding.DecodeString(testIV)
+	if pad {
+		amountToPad := aes.BlockSize - len(plaintext)%aes.BlockSize
+		plaintext = append(plaintext, bytes.Repeat([]byte{byte(amountToPad)}, amountToPad)...)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func TestDecryptUserInfo(t *testing.T) {
+	info, err := DecryptUserInfo(testAppId, testSessionKey, testEncryptedData, testIV, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UserInfo{
+		OpenId:   "oGZUI0egBJY1zhBYw2KhdUfwVJJE",
+		UnionId:  "ocMvos6NjeKLIBqg5Mr9QjxrP1FA",
+		Nickname: "Band",
+		Gender:   1,
+		City:     "Guangzhou",
+		Watermark: Watermark{
+			AppId:     testAppId,
+			Timestamp: 1477314187,
+		},
+	}
+	if info.OpenId != want.OpenId || info.UnionId != want.UnionId || info.Nickname != want.Nickname ||
+		info.Gender != want.Gender || info.City != want.City || info.Watermark != want.Watermark {
+		t.Errorf("TestDecryptUserInfo failed, have: %+v, want: %+v\n", info, want)
+	}
+}
+
+func TestDecryptWatermark(t *testing.T) {
+	// 示例数据的时间戳早就过期了
+	if _, err := DecryptUserInfo(testAppId, testSessionKey, testEncryptedData, testIV, time.Hour); err == nil || !strings.HasPrefix(err.Error(), "watermark timestamp expired") {
+		t.Errorf("TestDecryptWatermark failed, have: %v, want timestamp expired error\n", err)
+	}
+	if _, err := DecryptUserInfo("wx0000000000000000", testSessionKey, testEncryptedData, testIV, 0); err != ErrWatermarkMismatch {
+		t.Errorf("TestDecryptWatermark failed, have: %v, want: %v\n", err, ErrWatermarkMismatch)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	encryptedData := testEncrypt([]byte(`{"openGId":"group","watermark":{"appid":"`+testAppId+`","timestamp":`+timestamp+`}}`), true)
+	info, err := DecryptShareInfo(testAppId, testSessionKey, encryptedData, testIV, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.OpenGId != "group" {
+		t.Errorf("TestDecryptWatermark failed, have: %s, want: %s\n", info.OpenGId, "group")
+	}
+
+	encryptedData = testEncrypt([]byte(`{"openGId":"group"}`), true)
+	if _, err = DecryptShareInfo(testAppId, testSessionKey, encryptedData, testIV, 0); err == nil {
+		t.Errorf("TestDecryptWatermark failed, want watermark not found error\n")
+	}
+}
+
+func TestWatermarkCheck(t *testing.T) {
+	timeNow := time.Now()
+	tests := []struct {
+		timestamp time.Time
+		maxAge    time.Duration
+		ok        bool
+	}{
+		{timeNow.Add(-time.Minute), time.Hour, true},
+		{timeNow.Add(-time.Hour * 2), time.Hour, false},
+		{timeNow.Add(time.Hour * 2), time.Hour, false}, // 未来的时间戳
+		{timeNow.Add(-time.Hour * 24 * 365), 0, true},  // maxAge <= 0 不检查时间戳
+	}
+	for _, test := range tests {
+		w := Watermark{AppId: testAppId, Timestamp: test.timestamp.Unix()}
+		if err := w.Check(testAppId, test.maxAge); (err == nil) != test.ok {
+			t.Errorf("TestWatermarkCheck failed, timestamp: %s, maxAge: %s, have: %v\n", test.timestamp, test.maxAge, err)
+		}
+	}
+	w := Watermark{AppId: testAppId, Timestamp: timeNow.Unix()}
+	if err := w.Check("wx0000000000000000", time.Hour); err != ErrWatermarkMismatch {
+		t.Errorf("TestWatermarkCheck failed, have: %v, want: %v\n", err, ErrWatermarkMismatch)
+	}
+}
+
+func TestDecryptBadInput(t *testing.T) {
+	// 最后一个字节为 0, 补位不正确
+	badPadding := testEncrypt(append(bytes.Repeat([]byte{'a'}, aes.BlockSize-1), 0), false)
+	if _, err := Decrypt(testSessionKey, badPadding, testIV); err == nil || !strings.HasPrefix(err.Error(), "the amount to pad is incorrect") {
+		t.Errorf("TestDecryptBadInput failed, have: %v, want padding error\n", err)
+	}
+
+	shortIV := base64.StdEncoding.EncodeToString(make([]byte, 8))
+	if _, err := Decrypt(testSessionKey, testEncryptedData, shortIV); err == nil || !strings.HasPrefix(err.Error(), "the length of iv is incorrect") {
+		t.Errorf("TestDecryptBadInput failed, have: %v, want iv length error\n", err)
+	}
+
+	shortKey := base64.StdEncoding.EncodeToString(make([]byte, 8))
+	if _, err := Decrypt(shortKey, testEncryptedData, testIV); err == nil || !strings.HasPrefix(err.Error(), "the length of session_key is incorrect") {
+		t.Errorf("TestDecryptBadInput failed, have: %v, want session_key length error\n", err)
+	}
+
+	if _, err := Decrypt(testSessionKey, "not base64!", testIV); err == nil {
+		t.Errorf("TestDecryptBadInput failed, want base64 error\n")
+	}
+}
@@ -0,0 +1,9 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 小程序接口: 登录, 会话管理, 加密数据解密, 小程序码, 代码管理.
+//  代码管理是第三方平台代小程序实现业务的接口, 使用授权方(小程序)的 authorizer_access_token 调用,
+//  一般用 component.AuthorizerAccessTokenServer 或者 component.AuthorizerTokenPool 作为 mp.AccessTokenServer.
+package wxa
@@ -0,0 +1,60 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"github.com/chanxuehong/wechat/mp"
+)
+
+const (
+	// 推送到小程序消息与事件接收 URL 上的事件类型
+	EventTypeAuditSuccess = "weapp_audit_success" // 代码审核通过
+	EventTypeAuditFail    = "weapp_audit_fail"    // 代码审核不通过
+)
+
+// 注册消息(事件)结构, 见 mp.Request.DecodeMessage
+func init() {
+	mp.RegisterEventType(EventTypeAuditSuccess, (*AuditSuccessEvent)(nil))
+	mp.RegisterEventType(EventTypeAuditFail, (*AuditFailEvent)(nil))
+}
+
+// 代码审核通过事件推送
+type AuditSuccessEvent struct {
+	XMLName struct{} `xml:"xml" json:"-"`
+	mp.MessageHeader
+
+	Event    string `xml:"Event"    json:"Event"`    // 事件类型, weapp_audit_success
+	SuccTime int64  `xml:"SuccTime" json:"SuccTime"` // 审核成功的时间
+}
+
+func GetAuditSuccessEvent(msg *mp.MixedMessage) *AuditSuccessEvent {
+	return &AuditSuccessEvent{
+		MessageHeader: msg.MessageHeader,
+		Event:         msg.Event,
+		SuccTime:      msg.SuccTime,
+	}
+}
+
+// 代码审核不通过事件推送
+type AuditFailEvent struct {
+	XMLName struct{} `xml:"xml" json:"-"`
+	mp.MessageHeader
+
+	Event      string `xml:"Event"      json:"Event"`      // 事件类型, weapp_audit_fail
+	Reason     string `xml:"Reason"     json:"Reason"`     // 审核失败的原因
+	FailTime   int64  `xml:"FailTime"   json:"FailTime"`   // 审核失败的时间
+	ScreenShot string `xml:"ScreenShot" json:"ScreenShot"` // 审核失败的截图示例, 多个用 | 分隔, 是临时素材的 media_id
+}
+
+func GetAuditFailEvent(msg *mp.MixedMessage) *AuditFailEvent {
+	return &AuditFailEvent{
+		MessageHeader: msg.MessageHeader,
+		Event:         msg.Event,
+		Reason:        msg.Reason,
+		FailTime:      msg.FailTime,
+		ScreenShot:    msg.ScreenShot,
+	}
+}
@@ -0,0 +1,57 @@
+package wxa
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+func TestDecodeAuditSuccessEvent(t *testing.T) {
+	rawMsgXML := []byte(`<xml><ToUserName><![CDATA[gh_fb9688c2a4b2]]></ToUserName><FromUserName><![CDATA[od1P50M-fNQI5Gcq-trm4a7apsU8]]></FromUserName><CreateTime>1488856741</CreateTime><MsgType><![CDATA[event]]></MsgType><Event><![CDATA[weapp_audit_success]]></Event><SuccTime>1488856741</SuccTime></xml>`)
+
+	msg, err := mp.DecodeMessage("event", EventTypeAuditSuccess, rawMsgXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, ok := msg.(*AuditSuccessEvent)
+	if !ok {
+		t.Fatalf("TestDecodeAuditSuccessEvent failed, have type: %T, want: %T\n", msg, event)
+	}
+	if event.ToUserName != "gh_fb9688c2a4b2" || event.Event != EventTypeAuditSuccess || event.SuccTime != 1488856741 {
+		t.Errorf("TestDecodeAuditSuccessEvent failed, have: %+v\n", event)
+	}
+
+	var mixedMsg mp.MixedMessage
+	if err = xml.Unmarshal(rawMsgXML, &mixedMsg); err != nil {
+		t.Fatal(err)
+	}
+	if have := GetAuditSuccessEvent(&mixedMsg); !reflect.DeepEqual(have, event) {
+		t.Errorf("TestDecodeAuditSuccessEvent failed, have: %+v, want: %+v\n", have, event)
+	}
+}
+
+func TestDecodeAuditFailEvent(t *testing.T) {
+	rawMsgXML := []byte(`<xml><ToUserName><![CDATA[gh_fb9688c2a4b2]]></ToUserName><FromUserName><![CDATA[od1P50M-fNQI5Gcq-trm4a7apsU8]]></FromUserName><CreateTime>1488856591</CreateTime><MsgType><![CDATA[event]]></MsgType><Event><![CDATA[weapp_audit_fail]]></Event><Reason><![CDATA[1:账号信息不符合规范]]></Reason><FailTime>1488856591</FailTime><ScreenShot><![CDATA[xxx|yyy|zzz]]></ScreenShot></xml>`)
+
+	msg, err := mp.DecodeMessage("event", EventTypeAuditFail, rawMsgXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, ok := msg.(*AuditFailEvent)
+	if !ok {
+		t.Fatalf("TestDecodeAuditFailEvent failed, have type: %T, want: %T\n", msg, event)
+	}
+	if event.Event != EventTypeAuditFail || event.Reason != "1:账号信息不符合规范" || event.FailTime != 1488856591 || event.ScreenShot != "xxx|yyy|zzz" {
+		t.Errorf("TestDecodeAuditFailEvent failed, have: %+v\n", event)
+	}
+
+	var mixedMsg mp.MixedMessage
+	if err = xml.Unmarshal(rawMsgXML, &mixedMsg); err != nil {
+		t.Fatal(err)
+	}
+	if have := GetAuditFailEvent(&mixedMsg); !reflect.DeepEqual(have, event) {
+		t.Errorf("TestDecodeAuditFailEvent failed, have: %+v, want: %+v\n", have, event)
+	}
+}
@@ -0,0 +1,44 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// +build wechatdebug
+
+package wxa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// GET 不需要 access_token 的接口, 然后将微信服务器返回的 JSON 解析到 response.
+func getJSON(clt *http.Client, url string, response interface{}) (err error) {
+	if clt == nil {
+		clt = mp.TextHttpClient
+	}
+
+	mp.LogInfoln("[WECHAT_DEBUG] request url:", url)
+
+	httpResp, err := clt.Get(url)
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http.Status: %s", httpResp.Status)
+	}
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return
+	}
+	mp.LogInfoln("[WECHAT_DEBUG] response json:", string(respBody))
+
+	return json.Unmarshal(respBody, response)
+}
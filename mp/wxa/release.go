@@ -0,0 +1,71 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"github.com/chanxuehong/wechat/mp"
+)
+
+const (
+	VisitStatusOpen  = "open"  // 线上代码可见
+	VisitStatusClose = "close" // 线上代码不可见
+)
+
+// 发布已通过审核的小程序.
+func (clt *Client) Release() (err error) {
+	var request struct{}
+
+	var result mp.Error
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/release?access_token="
+	if err = ((*mp.Client)(clt)).PostJSON(incompleteURL, &request, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result
+		return
+	}
+	return
+}
+
+// 小程序版本回退, 回退到上一个线上版本.
+func (clt *Client) RevertCodeRelease() (err error) {
+	var result mp.Error
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/revertcoderelease?access_token="
+	if err = ((*mp.Client)(clt)).GetJSON(incompleteURL, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result
+		return
+	}
+	return
+}
+
+// 修改小程序线上代码的可见状态, action 为 VisitStatusOpen 或 VisitStatusClose.
+func (clt *Client) ChangeVisitStatus(action string) (err error) {
+	request := struct {
+		Action string `json:"action"`
+	}{
+		Action: action,
+	}
+
+	var result mp.Error
+
+	incompleteURL := "https://api.weixin.qq.com/wxa/change_visitstatus?access_token="
+	if err = ((*mp.Client)(clt)).PostJSON(incompleteURL, &request, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result
+		return
+	}
+	return
+}
@@ -0,0 +1,44 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 小程序登录会话, session_key 不能下发到小程序, 也不要在网络上传输.
+type Session struct {
+	OpenId     string `json:"openid"`            // 用户唯一标识
+	SessionKey string `json:"session_key"`       // 会话密钥, 用于解密 encryptedData 和校验 rawData 的签名
+	UnionId    string `json:"unionid,omitempty"` // 用户在开放平台的唯一标识符, 满足 UnionID 下发条件时返回
+}
+
+// 小程序登录, 用 wx.login 得到的 code 换取 Session.
+//  httpClient: 如果为 nil 则使用 mp.TextHttpClient
+func JSCode2Session(appId, appSecret, code string, httpClient *http.Client) (session *Session, err error) {
+	_url := "https://api.weixin.qq.com/sns/jscode2session?appid=" + url.QueryEscape(appId) +
+		"&secret=" + url.QueryEscape(appSecret) +
+		"&js_code=" + url.QueryEscape(code) +
+		"&grant_type=authorization_code"
+
+	var result struct {
+		mp.Error
+		Session
+	}
+	if err = getJSON(httpClient, _url, &result); err != nil {
+		return
+	}
+
+	if result.ErrCode != mp.ErrCodeOK {
+		err = &result.Error
+		return
+	}
+	session = &result.Session
+	return
+}
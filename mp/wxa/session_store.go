@@ -0,0 +1,119 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// 小程序登录会话的存储, key 为开发者服务器下发给小程序的自定义登录态(见 NewSessionId), 而不是 session_key.
+//  多个副本共享会话需要用 redis, 数据库等实现该接口.
+type SessionStore interface {
+	// 获取会话, 不存在或者过期返回 ErrSessionNotFound.
+	GetSession(sessionId string) (session *Session, err error)
+
+	// 保存会话.
+	PutSession(sessionId string, session *Session) (err error)
+
+	// 删除会话, 不存在也返回 nil.
+	DeleteSession(sessionId string) (err error)
+}
+
+// 生成一个新的随机的自定义登录态, 32 个十六进制字符.
+func NewSessionId() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+// 基于内存的 SessionStore, 会话保存 maxAge 时间后过期.
+type MemorySessionStore struct {
+	maxAge time.Duration
+
+	rwmutex   sync.RWMutex
+	m         map[string]*memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	session   *Session
+	expiresAt time.Time
+}
+
+// 创建一个新的 MemorySessionStore, maxAge 必须大于 0.
+func NewMemorySessionStore(maxAge time.Duration) *MemorySessionStore {
+	if maxAge <= 0 {
+		panic("maxAge must be positive")
+	}
+	return &MemorySessionStore{
+		maxAge:    maxAge,
+		m:         make(map[string]*memorySession),
+		lastSweep: time.Now(),
+	}
+}
+
+func (store *MemorySessionStore) GetSession(sessionId string) (session *Session, err error) {
+	store.rwmutex.RLock()
+	v := store.m[sessionId]
+	store.rwmutex.RUnlock()
+
+	if v == nil || time.Now().After(v.expiresAt) {
+		err = ErrSessionNotFound
+		return
+	}
+	session = v.session
+	return
+}
+
+func (store *MemorySessionStore) PutSession(sessionId string, session *Session) (err error) {
+	if sessionId == "" {
+		return errors.New("empty sessionId")
+	}
+	if session == nil {
+		return errors.New("nil session")
+	}
+
+	timeNow := time.Now()
+
+	store.rwmutex.Lock()
+	defer store.rwmutex.Unlock()
+
+	store.m[sessionId] = &memorySession{
+		session:   session,
+		expiresAt: timeNow.Add(store.maxAge),
+	}
+	if timeNow.Sub(store.lastSweep) >= store.maxAge {
+		store.sweep(timeNow)
+	}
+	return
+}
+
+func (store *MemorySessionStore) DeleteSession(sessionId string) (err error) {
+	store.rwmutex.Lock()
+	delete(store.m, sessionId)
+	store.rwmutex.Unlock()
+	return
+}
+
+// 删除过期的会话, 调用者需要持有写锁.
+func (store *MemorySessionStore) sweep(timeNow time.Time) {
+	for k, v := range store.m {
+		if timeNow.After(v.expiresAt) {
+			delete(store.m, k)
+		}
+	}
+	store.lastSweep = timeNow
+}
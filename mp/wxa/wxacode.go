@@ -0,0 +1,203 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 小程序码线条颜色, auto_color 为 false 时生效.
+type LineColor struct {
+	R int `json:"r"`
+	G int `json:"g"`
+	B int `json:"b"`
+}
+
+// 小程序码, 适用于需要的码数量较少的业务场景, 与 CreateWXAQRCode 总共生成的码数量限制为 100,000.
+type WXACode struct {
+	Path      string     `json:"path"`                 // 扫码进入的小程序页面路径, 最大长度 128 字节, 可以带参数
+	Width     int        `json:"width,omitempty"`      // 二维码的宽度, 单位 px, 默认 430
+	AutoColor bool       `json:"auto_color,omitempty"` // 自动配置线条颜色
+	LineColor *LineColor `json:"line_color,omitempty"` // auto_color 为 false 时生效
+	IsHyaline bool       `json:"is_hyaline,omitempty"` // 是否需要透明底色
+}
+
+// 小程序码, 适用于需要的码数量极多的业务场景, 数量暂无限制.
+type WXACodeUnlimit struct {
+	Scene     string     `json:"scene"`                // 最大 32 个可见字符, 小程序里通过 query.scene 获取
+	Page      string     `json:"page,omitempty"`       // 已经发布的小程序存在的页面, 不能带参数, 为空时跳主页
+	Width     int        `json:"width,omitempty"`      // 二维码的宽度, 单位 px, 默认 430
+	AutoColor bool       `json:"auto_color,omitempty"` // 自动配置线条颜色
+	LineColor *LineColor `json:"line_color,omitempty"` // auto_color 为 false 时生效
+	IsHyaline bool       `json:"is_hyaline,omitempty"` // 是否需要透明底色
+}
+
+// 小程序二维码, 适用于需要的码数量较少的业务场景, 与 GetWXACode 总共生成的码数量限制为 100,000.
+type WXAQRCode struct {
+	Path  string `json:"path"`            // 扫码进入的小程序页面路径, 最大长度 128 字节, 可以带参数
+	Width int    `json:"width,omitempty"` // 二维码的宽度, 单位 px, 默认 430
+}
+
+const (
+	getWXACodeURL        = "https://api.weixin.qq.com/wxa/getwxacode?access_token="
+	getWXACodeUnlimitURL = "https://api.weixin.qq.com/wxa/getwxacodeunlimit?access_token="
+	createWXAQRCodeURL   = "https://api.weixin.qq.com/cgi-bin/wxaapp/createwxaqrcode?access_token="
+)
+
+// 获取小程序码, 写入到 filepath 路径的文件.
+func (clt *Client) GetWXACode(code *WXACode, filepath string) (written int64, err error) {
+	if code == nil {
+		err = errors.New("nil WXACode")
+		return
+	}
+	return clt.postToFile(getWXACodeURL, code, filepath)
+}
+
+// 获取小程序码, 写入到 writer.
+func (clt *Client) GetWXACodeToWriter(code *WXACode, writer io.Writer) (written int64, err error) {
+	if code == nil {
+		err = errors.New("nil WXACode")
+		return
+	}
+	if writer == nil {
+		err = errors.New("nil writer")
+		return
+	}
+	return clt.postToWriter(getWXACodeURL, code, writer)
+}
+
+// 获取不限数量的小程序码, 写入到 filepath 路径的文件.
+func (clt *Client) GetWXACodeUnlimit(code *WXACodeUnlimit, filepath string) (written int64, err error) {
+	if code == nil {
+		err = errors.New("nil WXACodeUnlimit")
+		return
+	}
+	return clt.postToFile(getWXACodeUnlimitURL, code, filepath)
+}
+
+// 获取不限数量的小程序码, 写入到 writer.
+func (clt *Client) GetWXACodeUnlimitToWriter(code *WXACodeUnlimit, writer io.Writer) (written int64, err error) {
+	if code == nil {
+		err = errors.New("nil WXACodeUnlimit")
+		return
+	}
+	if writer == nil {
+		err = errors.New("nil writer")
+		return
+	}
+	return clt.postToWriter(getWXACodeUnlimitURL, code, writer)
+}
+
+// 获取小程序二维码, 写入到 filepath 路径的文件.
+func (clt *Client) CreateWXAQRCode(code *WXAQRCode, filepath string) (written int64, err error) {
+	if code == nil {
+		err = errors.New("nil WXAQRCode")
+		return
+	}
+	return clt.postToFile(createWXAQRCodeURL, code, filepath)
+}
+
+// 获取小程序二维码, 写入到 writer.
+func (clt *Client) CreateWXAQRCodeToWriter(code *WXAQRCode, writer io.Writer) (written int64, err error) {
+	if code == nil {
+		err = errors.New("nil WXAQRCode")
+		return
+	}
+	if writer == nil {
+		err = errors.New("nil writer")
+		return
+	}
+	return clt.postToWriter(createWXAQRCodeURL, code, writer)
+}
+
+func (clt *Client) postToFile(incompleteURL string, request interface{}, filepath string) (written int64, err error) {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		file.Close()
+		if err != nil {
+			os.Remove(filepath)
+		}
+	}()
+
+	return clt.postToWriter(incompleteURL, request, file)
+}
+
+// POST request 到微信服务器, 返回的是图片则写入到 writer, 返回的是 JSON 则解析为错误.
+func (clt *Client) postToWriter(incompleteURL string, request interface{}, writer io.Writer) (written int64, err error) {
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+
+	token, err := clt.Token()
+	if err != nil {
+		return
+	}
+
+	hasRetried := false
+RETRY:
+	finalURL := incompleteURL + url.QueryEscape(token)
+
+	httpResp, err := clt.HttpClient.Post(finalURL, "application/json; charset=utf-8", bytes.NewReader(requestBody))
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http.Status: %s", httpResp.Status)
+		return
+	}
+
+	ContentType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if ContentType != "text/plain" && ContentType != "application/json" { // 返回的是图片
+		return io.Copy(writer, httpResp.Body)
+	}
+
+	// 返回的是错误信息
+	var result mp.Error
+	if err = json.NewDecoder(httpResp.Body).Decode(&result); err != nil {
+		return
+	}
+
+	switch result.ErrCode {
+	case mp.ErrCodeOK:
+		return // 基本不会出现
+	case mp.ErrCodeInvalidCredential, mp.ErrCodeAccessTokenExpired: // 失效(过期)重试一次
+		mp.LogInfoln("[WECHAT_RETRY] err_code:", result.ErrCode, ", err_msg:", result.ErrMsg)
+		mp.LogInfoln("[WECHAT_RETRY] current token:", token)
+
+		if !hasRetried {
+			hasRetried = true
+
+			if token, err = clt.TokenRefresh(); err != nil {
+				return
+			}
+			mp.LogInfoln("[WECHAT_RETRY] new token:", token)
+
+			result = mp.Error{}
+			goto RETRY
+		}
+		mp.LogInfoln("[WECHAT_RETRY] fallthrough, current token:", token)
+		fallthrough
+	default:
+		err = &result
+		return
+	}
+}
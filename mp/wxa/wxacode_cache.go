@@ -0,0 +1,203 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wxa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/chanxuehong/wechat/internal/util"
+	"github.com/chanxuehong/wechat/json"
+)
+
+// 小程序码的本地缓存, 文件名为 "接口 + 参数" 的 sha256, 相同参数的码只调用一次接口.
+//  每个小程序要用单独的目录, 因为不同小程序相同参数的码是不一样的.
+//  NOTE: 小程序码永久有效, 缓存不会过期, 需要重新生成时自己删除对应的文件.
+type WXACodeCache struct {
+	clt *Client
+	dir string
+
+	mutex    sync.Mutex
+	inflight map[string]*wxacodeCall // 正在调用接口的 key
+}
+
+type wxacodeCall struct {
+	done chan struct{}
+	err  error
+}
+
+// 创建一个新的 WXACodeCache, 目录不存在则创建.
+func NewWXACodeCache(clt *Client, dir string) (cache *WXACodeCache, err error) {
+	if clt == nil {
+		panic("nil Client")
+	}
+	if dir == "" {
+		return nil, errors.New("empty dir")
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	cache = &WXACodeCache{
+		clt:      clt,
+		dir:      dir,
+		inflight: make(map[string]*wxacodeCall),
+	}
+	return
+}
+
+// 获取小程序码, 返回缓存的图片文件路径.
+func (cache *WXACodeCache) GetWXACode(code *WXACode) (filename string, err error) {
+	if code == nil {
+		err = errors.New("nil WXACode")
+		return
+	}
+	return cache.get(getWXACodeURL, code)
+}
+
+// 获取不限数量的小程序码, 返回缓存的图片文件路径.
+func (cache *WXACodeCache) GetWXACodeUnlimit(code *WXACodeUnlimit) (filename string, err error) {
+	if code == nil {
+		err = errors.New("nil WXACodeUnlimit")
+		return
+	}
+	return cache.get(getWXACodeUnlimitURL, code)
+}
+
+// 获取小程序二维码, 返回缓存的图片文件路径.
+func (cache *WXACodeCache) CreateWXAQRCode(code *WXAQRCode) (filename string, err error) {
+	if code == nil {
+		err = errors.New("nil WXAQRCode")
+		return
+	}
+	return cache.get(createWXAQRCodeURL, code)
+}
+
+// 获取小程序码写入到 writer, 见 GetWXACode.
+func (cache *WXACodeCache) GetWXACodeToWriter(code *WXACode, writer io.Writer) (written int64, err error) {
+	filename, err := cache.GetWXACode(code)
+	if err != nil {
+		return
+	}
+	return copyFile(writer, filename)
+}
+
+// 获取不限数量的小程序码写入到 writer, 见 GetWXACodeUnlimit.
+func (cache *WXACodeCache) GetWXACodeUnlimitToWriter(code *WXACodeUnlimit, writer io.Writer) (written int64, err error) {
+	filename, err := cache.GetWXACodeUnlimit(code)
+	if err != nil {
+		return
+	}
+	return copyFile(writer, filename)
+}
+
+// 获取小程序二维码写入到 writer, 见 CreateWXAQRCode.
+func (cache *WXACodeCache) CreateWXAQRCodeToWriter(code *WXAQRCode, writer io.Writer) (written int64, err error) {
+	filename, err := cache.CreateWXAQRCode(code)
+	if err != nil {
+		return
+	}
+	return copyFile(writer, filename)
+}
+
+func (cache *WXACodeCache) get(incompleteURL string, request interface{}) (filename string, err error) {
+	key, err := wxacodeCacheKey(incompleteURL, request)
+	if err != nil {
+		return
+	}
+	filename = filepath.Join(cache.dir, key)
+
+	if _, err = os.Stat(filename); err == nil {
+		return
+	}
+	if !os.IsNotExist(err) {
+		return
+	}
+
+	// 同一个 key 同时只调用一次接口
+	cache.mutex.Lock()
+	if call := cache.inflight[key]; call != nil {
+		cache.mutex.Unlock()
+		<-call.done
+		err = call.err
+		return
+	}
+	if _, err = os.Stat(filename); err == nil { // 别的 goroutine 刚刚写好
+		cache.mutex.Unlock()
+		return
+	}
+	call := &wxacodeCall{
+		done: make(chan struct{}),
+		err:  errors.New("fetch wxacode panicked"), // fetch panic 时等待的 goroutine 得到这个错误
+	}
+	cache.inflight[key] = call
+	cache.mutex.Unlock()
+
+	// fetch panic 时也要清理, 否则之后相同 key 的调用会一直等待
+	defer func() {
+		cache.mutex.Lock()
+		delete(cache.inflight, key)
+		cache.mutex.Unlock()
+		close(call.done)
+	}()
+
+	call.err = cache.fetch(incompleteURL, request, filename)
+	err = call.err
+	return
+}
+
+// 调用接口, 把图片原子地写入到 filename, 出错时不会留下不完整的文件.
+func (cache *WXACodeCache) fetch(incompleteURL string, request interface{}, filename string) (err error) {
+	var buf bytes.Buffer
+	written, err := cache.clt.postToWriter(incompleteURL, request, &buf)
+	if err != nil {
+		return
+	}
+
+	// 微信返回 errcode 为 0 的 JSON 时没有错误, 但是也没有图片, 不能缓存
+	if written == 0 {
+		return errors.New("empty wxacode response")
+	}
+	if contentType := http.DetectContentType(buf.Bytes()); !strings.HasPrefix(contentType, "image/") {
+		return errors.New("wxacode response is not an image: " + contentType)
+	}
+	return util.WriteFileAtomic(filename, buf.Bytes(), 0644)
+}
+
+// sha256(incompleteURL + "\n" + JSON(request)), 结构体的字段顺序固定, 所以相同参数的 JSON 一样.
+func wxacodeCacheKey(incompleteURL string, request interface{}) (key string, err error) {
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+	hash := sha256.New()
+	io.WriteString(hash, incompleteURL)
+	hash.Write([]byte{'\n'})
+	hash.Write(requestBytes)
+	key = hex.EncodeToString(hash.Sum(nil))
+	return
+}
+
+func copyFile(writer io.Writer, filename string) (written int64, err error) {
+	if writer == nil {
+		err = errors.New("nil writer")
+		return
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	return io.Copy(writer, file)
+}
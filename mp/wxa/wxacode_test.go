@@ -0,0 +1,352 @@
+package wxa
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp"
+)
+
+// 模拟 access_token 中控服务器, TokenRefresh 之后返回新的 access_token.
+type testAccessTokenServer struct {
+	mutex    sync.Mutex
+	token    string
+	refreshs int
+}
+
+func (srv *testAccessTokenServer) TagCE90001AFE9C11E48611A4DB30FED8E1() {}
+
+func (srv *testAccessTokenServer) Token() (string, error) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.token, nil
+}
+
+func (srv *testAccessTokenServer) TokenRefresh() (string, error) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.refreshs++
+	srv.token = "token-refreshed"
+	return srv.token, nil
+}
+
+// 把所有请求转发到 httptest.Server, panicking 为 true 时 RoundTrip panic.
+type testRewriteTransport struct {
+	target *url.URL
+
+	mutex     sync.Mutex
+	panicking bool
+}
+
+func (t *testRewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	panicking := t.panicking
+	t.mutex.Unlock()
+	if panicking {
+		panic("test RoundTrip panic")
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+type testWXACodeRequest struct {
+	Path        string
+	AccessToken string
+}
+
+// 模拟小程序码接口, handler 返回响应; 记录所有的请求.
+type testWXACodeAPI struct {
+	transport *testRewriteTransport
+	tokenSrv  *testAccessTokenServer
+
+	mutex    sync.Mutex
+	requests []testWXACodeRequest
+}
+
+func (api *testWXACodeAPI) calls() int {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	return len(api.requests)
+}
+
+func newTestWXACodeClient(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*Client, *testWXACodeAPI) {
+	api := &testWXACodeAPI{
+		tokenSrv: &testAccessTokenServer{token: "token"},
+	}
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var code WXACode
+		json.NewDecoder(r.Body).Decode(&code)
+
+		api.mutex.Lock()
+		api.requests = append(api.requests, testWXACodeRequest{
+			Path:        code.Path,
+			AccessToken: r.URL.Query().Get("access_token"),
+		})
+		api.mutex.Unlock()
+
+		handler(w, r)
+	}))
+	t.Cleanup(apiServer.Close)
+
+	target, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.transport = &testRewriteTransport{target: target}
+	return NewClient(api.tokenSrv, &http.Client{Transport: api.transport}), api
+}
+
+var testWXACodeImage = []byte("\x89PNG\r\n\x1a\ntest image")
+
+func writeTestWXACodeImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(testWXACodeImage)
+}
+
+func TestGetWXACodeImage(t *testing.T) {
+	clt, api := newTestWXACodeClient(t, writeTestWXACodeImage)
+
+	var buf bytes.Buffer
+	written, err := clt.GetWXACodeToWriter(&WXACode{Path: "pages/index"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(len(testWXACodeImage)) || !bytes.Equal(buf.Bytes(), testWXACodeImage) {
+		t.Errorf("TestGetWXACodeImage failed, have: %q, want: %q\n", buf.Bytes(), testWXACodeImage)
+	}
+	if len(api.requests) != 1 || api.requests[0].Path != "pages/index" || api.requests[0].AccessToken != "token" {
+		t.Errorf("TestGetWXACodeImage failed, have requests: %+v\n", api.requests)
+	}
+}
+
+func TestGetWXACodeError(t *testing.T) {
+	for _, contentType := range []string{"application/json; charset=utf-8", "text/plain"} {
+		clt, _ := newTestWXACodeClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			io.WriteString(w, `{"errcode":45029,"errmsg":"qrcode count out of limit"}`)
+		})
+
+		var buf bytes.Buffer
+		_, err := clt.GetWXACodeToWriter(&WXACode{Path: "pages/index"}, &buf)
+		if e, ok := err.(*mp.Error); !ok || e.ErrCode != 45029 {
+			t.Errorf("TestGetWXACodeError failed, Content-Type: %s, have: %v, want errcode 45029\n", contentType, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("TestGetWXACodeError failed, have written: %q\n", buf.Bytes())
+		}
+	}
+}
+
+func TestGetWXACodeRetry(t *testing.T) {
+	clt, api := newTestWXACodeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "token-refreshed" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"errcode":40001,"errmsg":"invalid credential"}`)
+			return
+		}
+		writeTestWXACodeImage(w, r)
+	})
+
+	var buf bytes.Buffer
+	if _, err := clt.GetWXACodeToWriter(&WXACode{Path: "pages/index"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testWXACodeImage) {
+		t.Errorf("TestGetWXACodeRetry failed, have: %q, want: %q\n", buf.Bytes(), testWXACodeImage)
+	}
+	if api.calls() != 2 || api.tokenSrv.refreshs != 1 {
+		t.Errorf("TestGetWXACodeRetry failed, have calls: %d, refreshs: %d, want: 2, 1\n", api.calls(), api.tokenSrv.refreshs)
+	}
+
+	// 刷新之后仍然失效, 只重试一次
+	clt, api = newTestWXACodeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"errcode":40001,"errmsg":"invalid credential"}`)
+	})
+	_, err := clt.GetWXACodeToWriter(&WXACode{Path: "pages/index"}, &buf)
+	if e, ok := err.(*mp.Error); !ok || e.ErrCode != mp.ErrCodeInvalidCredential {
+		t.Errorf("TestGetWXACodeRetry failed, have: %v, want errcode 40001\n", err)
+	}
+	if api.calls() != 2 {
+		t.Errorf("TestGetWXACodeRetry failed, have calls: %d, want: 2\n", api.calls())
+	}
+}
+
+func TestWXACodeCacheConcurrent(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	clt, api := newTestWXACodeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+		<-release
+		writeTestWXACodeImage(w, r)
+	})
+	cache, err := NewWXACodeCache(clt, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	filenames := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			filenames[i], errs[i] = cache.GetWXACode(&WXACode{Path: "pages/index"})
+		}(i)
+	}
+	<-arrived
+	time.Sleep(time.Millisecond * 50) // 让其他 goroutine 都等待在 inflight 上
+	close(release)
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if filenames[i] != filenames[0] {
+			t.Errorf("TestWXACodeCacheConcurrent failed, have: %s, want: %s\n", filenames[i], filenames[0])
+		}
+	}
+	if api.calls() != 1 {
+		t.Errorf("TestWXACodeCacheConcurrent failed, have calls: %d, want: 1\n", api.calls())
+	}
+	data, err := os.ReadFile(filenames[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testWXACodeImage) {
+		t.Errorf("TestWXACodeCacheConcurrent failed, have: %q, want: %q\n", data, testWXACodeImage)
+	}
+
+	// 已经缓存, 不再调用接口; 不同的参数是不同的文件
+	var buf bytes.Buffer
+	if _, err = cache.GetWXACodeToWriter(&WXACode{Path: "pages/index"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testWXACodeImage) || api.calls() != 1 {
+		t.Errorf("TestWXACodeCacheConcurrent failed, have calls: %d, want: 1\n", api.calls())
+	}
+	filename, err := cache.GetWXACode(&WXACode{Path: "pages/other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename == filenames[0] || api.calls() != 2 {
+		t.Errorf("TestWXACodeCacheConcurrent failed, have filename: %s, calls: %d\n", filename, api.calls())
+	}
+}
+
+func TestWXACodeCacheError(t *testing.T) {
+	clt, api := newTestWXACodeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"errcode":45029,"errmsg":"qrcode count out of limit"}`)
+	})
+	dir := t.TempDir()
+	cache, err := NewWXACodeCache(clt, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 出错不缓存, 也不留下文件
+	for i := 1; i <= 2; i++ {
+		if _, err = cache.GetWXACode(&WXACode{Path: "pages/index"}); err == nil {
+			t.Fatalf("TestWXACodeCacheError failed, want error\n")
+		}
+		if api.calls() != i {
+			t.Errorf("TestWXACodeCacheError failed, have calls: %d, want: %d\n", api.calls(), i)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("TestWXACodeCacheError failed, have %d files, want: 0\n", len(entries))
+	}
+}
+
+func TestWXACodeCachePanic(t *testing.T) {
+	clt, api := newTestWXACodeClient(t, writeTestWXACodeImage)
+	cache, err := NewWXACodeCache(clt, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api.transport.panicking = true
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("TestWXACodeCachePanic failed, want panic\n")
+			}
+		}()
+		cache.GetWXACode(&WXACode{Path: "pages/index"})
+	}()
+	api.transport.panicking = false
+
+	// panic 之后相同 key 的调用不会一直等待
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.GetWXACode(&WXACode{Path: "pages/index"})
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("TestWXACodeCachePanic failed, blocked after panic\n")
+	}
+	if api.calls() != 1 {
+		t.Errorf("TestWXACodeCachePanic failed, have calls: %d, want: 1\n", api.calls())
+	}
+}
+
+func TestWXACodeCacheNotImage(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"errcode":0,"errmsg":"ok"}`},
+		{"image/jpeg", ""},
+		{"image/jpeg", "<html><body>busy</body></html>"},
+	}
+	for _, test := range tests {
+		clt, _ := newTestWXACodeClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			io.WriteString(w, test.body)
+		})
+		dir := t.TempDir()
+		cache, err := NewWXACodeCache(clt, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 不是图片时返回错误, 不缓存
+		if _, err = cache.GetWXACode(&WXACode{Path: "pages/index"}); err == nil {
+			t.Errorf("TestWXACodeCacheNotImage failed, %s %q: want error\n", test.contentType, test.body)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("TestWXACodeCacheNotImage failed, %s %q: have %d files, want: 0\n", test.contentType, test.body, len(entries))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package msgcrypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+// 把长度为 43 的 EncodingAESKey base64 decode 成 32 字节的 AES key, 同 util.AESKeyDecode.
+func AESKeyDecode(encodingAESKey string) (aesKey [32]byte, err error) {
+	if len(encodingAESKey) != 43 {
+		err = errors.New("the length of EncodingAESKey must be equal to 43, now is " + strconv.Itoa(len(encodingAESKey)))
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return
+	}
+	if len(key) != 32 {
+		err = errors.New("the length of decoded AES key must be equal to 32, now is " + strconv.Itoa(len(key)))
+		return
+	}
+	copy(aesKey[:], key)
+	return
+}
+
+// 加密消息.
+//  ciphertext = AES_Encrypt[random(16B) + msg_len(4B) + rawXMLMsg + appId]
+func AESEncryptMsg(random, rawXMLMsg []byte, appId string, aesKey [32]byte) (ciphertext []byte) {
+	return util.AESEncryptMsg(random, rawXMLMsg, appId, aesKey)
+}
+
+// 解密消息.
+//  ciphertext = AES_Encrypt[random(16B) + msg_len(4B) + rawXMLMsg + appId]
+func AESDecryptMsg(ciphertext []byte, aesKey [32]byte) (random, rawXMLMsg, appId []byte, err error) {
+	return util.AESDecryptMsg(ciphertext, aesKey)
+}
+
+// 加密消息并签名, 返回安全模式下 http body 里的 Encrypt 和对应的 msg_signature.
+//  appId 对于企业号是 CorpId; random 为 nil 则随机生成.
+func EncryptMsg(token string, aesKey [32]byte, appId, timestamp, nonce string, random, rawXMLMsg []byte) (base64EncryptedMsg, msgSignature string, err error) {
+	if random == nil {
+		random = make([]byte, 16)
+		if _, err = rand.Read(random); err != nil {
+			return
+		}
+	} else if len(random) != 16 {
+		err = errors.New("the length of random must be equal to 16")
+		return
+	}
+
+	encryptedMsg := AESEncryptMsg(random, rawXMLMsg, appId, aesKey)
+	base64EncryptedMsg = base64.StdEncoding.EncodeToString(encryptedMsg)
+	msgSignature = MsgSign(token, timestamp, nonce, base64EncryptedMsg)
+	return
+}
+
+// 校验 msg_signature 并解密消息, 返回的错误说明了是哪一步失败, 更详细的诊断见 Diagnose.
+//  appId 对于企业号是 CorpId, 为空则不校验.
+func DecryptMsg(token string, aesKey [32]byte, appId, msgSignature, timestamp, nonce, base64EncryptedMsg string) (random, rawXMLMsg []byte, err error) {
+	if !CheckMsgSign(msgSignature, token, timestamp, nonce, base64EncryptedMsg) {
+		err = errors.New("check msg_signature failed")
+		return
+	}
+
+	encryptedMsg, err := base64.StdEncoding.DecodeString(base64EncryptedMsg)
+	if err != nil {
+		err = errors.New("base64 decode Encrypt failed: " + err.Error())
+		return
+	}
+
+	random, rawXMLMsg, haveAppId, err := AESDecryptMsg(encryptedMsg, aesKey)
+	if err != nil {
+		err = errors.New("aes decrypt failed: " + err.Error())
+		return
+	}
+	if appId != "" && string(haveAppId) != appId {
+		err = errors.New("the message AppId mismatch, have: " + string(haveAppId) + ", want: " + appId)
+		return
+	}
+	return
+}
@@ -0,0 +1,199 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package msgcrypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 抓取到的一次回调请求及其对应的配置.
+type Callback struct {
+	Token          string // 配置的 Token
+	EncodingAESKey string // 配置的 EncodingAESKey, 明文模式可以为空
+	AppId          string // 配置的 AppId(企业号为 CorpId), 为空则不校验
+	ToUserName     string // 配置的公众号原始ID(企业号为 CorpId), 为空则不校验
+
+	Query url.Values // 回调请求 URL 中的查询参数
+	Body  []byte     // 回调请求的 http body, 企业号 URL 验证的 GET 请求为空, 此时解密 echostr
+}
+
+// 诊断过程中的一项检查.
+type Check struct {
+	Name   string // 检查项, 比如 signature, msg_signature, aes_decrypt
+	OK     bool
+	Detail string // 检查的细节, 失败时说明原因和可能的问题
+}
+
+// 诊断报告.
+type Report struct {
+	Checks []Check // 按顺序执行的检查, 遇到第一个失败即停止
+
+	Encrypted bool   // 是否是安全模式(加密)的消息
+	AppId     string // 消息解密后得到的 AppId(企业号为 CorpId)
+	RawMsgXML []byte // 消息的 XML 文本, 对于安全模式是解密后的消息
+}
+
+// 是否所有检查都通过.
+func (r *Report) OK() bool {
+	return r.FirstFailure() == nil
+}
+
+// 第一个失败的检查, 没有则返回 nil.
+func (r *Report) FirstFailure() *Check {
+	for i := range r.Checks {
+		if !r.Checks[i].OK {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+func (r *Report) pass(name, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, OK: true, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) fail(name, format string, args ...interface{}) *Report {
+	r.Checks = append(r.Checks, Check{Name: name, OK: false, Detail: fmt.Sprintf(format, args...)})
+	return r
+}
+
+// 诊断一次回调请求: 按 mp, corp 处理回调的顺序逐项检查, 并说明失败的检查项可能的原因.
+func Diagnose(cb *Callback) (report *Report) {
+	report = &Report{}
+	query := cb.Query
+
+	// 查询参数
+	timestampStr := query.Get("timestamp")
+	if timestampStr == "" {
+		return report.fail("timestamp", "timestamp is empty")
+	}
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return report.fail("timestamp", "can not parse timestamp to int64: %s", timestampStr)
+	}
+	report.pass("timestamp", "%s (%s)", timestampStr, time.Unix(timestamp, 0).Format(time.RFC3339))
+
+	nonce := query.Get("nonce")
+	if nonce == "" {
+		return report.fail("nonce", "nonce is empty")
+	}
+	report.pass("nonce", "%s", nonce)
+
+	// URL 签名, 企业号没有此参数
+	if signature := query.Get("signature"); signature != "" {
+		want := Sign(cb.Token, timestampStr, nonce)
+		if signature != want {
+			return report.fail("signature", "have %s, want %s; sha1(sort(token, timestamp, nonce)) mismatch, the Token is probably wrong", signature, want)
+		}
+		report.pass("signature", "%s", signature)
+	}
+
+	msgSignature := query.Get("msg_signature")
+	switch encryptType := query.Get("encrypt_type"); encryptType {
+	case "aes":
+		report.Encrypted = true
+	case "", "raw":
+		report.Encrypted = encryptType == "" && msgSignature != "" // 企业号没有 encrypt_type
+	default:
+		return report.fail("encrypt_type", "unknown encrypt_type: %s", encryptType)
+	}
+
+	if !report.Encrypted {
+		if query.Get("signature") == "" {
+			return report.fail("signature", "signature is empty")
+		}
+		if len(cb.Body) > 0 {
+			if err = xml.Unmarshal(cb.Body, new(struct{})); err != nil {
+				return report.fail("body", "the http body is not a valid XML: %s", err)
+			}
+		}
+		report.RawMsgXML = cb.Body
+		return
+	}
+
+	if msgSignature == "" {
+		return report.fail("msg_signature", "msg_signature is empty")
+	}
+
+	// 获取 Encrypt
+	var base64EncryptedMsg string
+	if len(bytes.TrimSpace(cb.Body)) == 0 {
+		if base64EncryptedMsg = query.Get("echostr"); base64EncryptedMsg == "" {
+			return report.fail("body", "the http body is empty and there is no echostr in the query")
+		}
+		report.pass("body", "empty http body, use echostr")
+	} else {
+		var requestHttpBody struct {
+			XMLName      struct{} `xml:"xml"`
+			ToUserName   string   `xml:"ToUserName"`
+			EncryptedMsg string   `xml:"Encrypt"`
+		}
+		if err = xml.Unmarshal(cb.Body, &requestHttpBody); err != nil {
+			return report.fail("body", "the http body is not a valid XML: %s; is the body truncated?", err)
+		}
+		if requestHttpBody.EncryptedMsg == "" {
+			return report.fail("body", "no Encrypt element in the http body")
+		}
+		base64EncryptedMsg = requestHttpBody.EncryptedMsg
+		report.pass("body", "Encrypt is %d bytes", len(base64EncryptedMsg))
+
+		if cb.ToUserName != "" && requestHttpBody.ToUserName != "" {
+			if requestHttpBody.ToUserName != cb.ToUserName {
+				return report.fail("ToUserName", "have %s, want %s; the message is for another account", requestHttpBody.ToUserName, cb.ToUserName)
+			}
+			report.pass("ToUserName", "%s", requestHttpBody.ToUserName)
+		}
+	}
+
+	// 消息体签名
+	if want := MsgSign(cb.Token, timestampStr, nonce, base64EncryptedMsg); msgSignature != want {
+		hint := "the Token is probably wrong"
+		if query.Get("signature") != "" {
+			// signature 已经校验通过, 说明 Token 是对的
+			hint = "the Token is right (signature passed), so the Encrypt was probably modified or truncated"
+		}
+		return report.fail("msg_signature", "have %s, want %s; sha1(sort(token, timestamp, nonce, Encrypt)) mismatch, %s", msgSignature, want, hint)
+	}
+	report.pass("msg_signature", "%s", msgSignature)
+
+	// 解密
+	aesKey, err := AESKeyDecode(cb.EncodingAESKey)
+	if err != nil {
+		return report.fail("EncodingAESKey", "%s", err)
+	}
+	report.pass("EncodingAESKey", "ok")
+
+	encryptedMsg, err := base64.StdEncoding.DecodeString(base64EncryptedMsg)
+	if err != nil {
+		return report.fail("base64", "base64 decode Encrypt failed: %s; the Encrypt is probably truncated or url-decoded incorrectly", err)
+	}
+	if len(encryptedMsg) < 32 || len(encryptedMsg)%32 != 0 {
+		return report.fail("base64", "the length of decoded Encrypt is %d, not a positive multiple of 32; the Encrypt is probably truncated", len(encryptedMsg))
+	}
+	report.pass("base64", "%d bytes", len(encryptedMsg))
+
+	_, rawXMLMsg, appId, err := AESDecryptMsg(encryptedMsg, aesKey)
+	if err != nil {
+		return report.fail("aes_decrypt", "%s; the EncodingAESKey is probably wrong, or it was changed and this message is encrypted with the old one", err)
+	}
+	report.AppId = string(appId)
+	report.RawMsgXML = rawXMLMsg
+	report.pass("aes_decrypt", "%d bytes message", len(rawXMLMsg))
+
+	if cb.AppId != "" {
+		if report.AppId != cb.AppId {
+			return report.fail("appid", "have %s, want %s; the message is encrypted for another account", report.AppId, cb.AppId)
+		}
+		report.pass("appid", "%s", report.AppId)
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package msgcrypto
+
+import (
+	"net/url"
+	"testing"
+)
+
+const (
+	testToken          = "testtoken"
+	testEncodingAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+	testAppId          = "wx0123456789abcdef"
+)
+
+func testCallback(t *testing.T) *Callback {
+	aesKey, err := AESKeyDecode(testEncodingAESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp, nonce := "1409304348", "xxxxxx"
+	rawXMLMsg := []byte("<xml><ToUserName><![CDATA[gh_test]]></ToUserName><Content><![CDATA[hello]]></Content></xml>")
+	encryptedMsg, msgSignature, err := EncryptMsg(testToken, aesKey, testAppId, timestamp, nonce, []byte("0123456789abcdef"), rawXMLMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Callback{
+		Token:          testToken,
+		EncodingAESKey: testEncodingAESKey,
+		AppId:          testAppId,
+		ToUserName:     "gh_test",
+		Query: url.Values{
+			"signature":     {Sign(testToken, timestamp, nonce)},
+			"timestamp":     {timestamp},
+			"nonce":         {nonce},
+			"encrypt_type":  {"aes"},
+			"msg_signature": {msgSignature},
+		},
+		Body: []byte("<xml><ToUserName><![CDATA[gh_test]]></ToUserName><Encrypt><![CDATA[" + encryptedMsg + "]]></Encrypt></xml>"),
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	report := Diagnose(testCallback(t))
+	if !report.OK() {
+		t.Fatalf("Diagnose failed: %+v", report.FirstFailure())
+	}
+	if report.AppId != testAppId {
+		t.Errorf("have AppId %s, want %s", report.AppId, testAppId)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(cb *Callback)
+	}{
+		{"signature", func(cb *Callback) { cb.Token = "wrongtoken" }},
+		{"msg_signature", func(cb *Callback) { cb.Query.Set("msg_signature", "0000") }},
+		{"EncodingAESKey", func(cb *Callback) { cb.EncodingAESKey = "short" }},
+		{"aes_decrypt", func(cb *Callback) { cb.EncodingAESKey = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789abcdefg" }},
+		{"appid", func(cb *Callback) { cb.AppId = "wxother" }},
+		{"ToUserName", func(cb *Callback) { cb.ToUserName = "gh_other" }},
+	}
+	for _, test := range tests {
+		cb := testCallback(t)
+		test.modify(cb)
+		failure := Diagnose(cb).FirstFailure()
+		if failure == nil {
+			t.Errorf("%s: want failure, have none", test.name)
+			continue
+		}
+		if failure.Name != test.name {
+			t.Errorf("have failure %s (%s), want %s", failure.Name, failure.Detail, test.name)
+		}
+	}
+}
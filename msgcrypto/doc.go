@@ -0,0 +1,10 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 微信公众号/企业号回调协议的签名和加解密.
+//
+//  mp, corp 等包内部使用的就是这里的算法, 公开出来方便排查 "check msg_signature failed",
+//  AES 补位错误之类的问题, 见 Diagnose 和 cmd/wechatcrypt.
+package msgcrypto
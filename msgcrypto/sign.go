@@ -0,0 +1,32 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package msgcrypto
+
+import (
+	"github.com/chanxuehong/util/security"
+
+	"github.com/chanxuehong/wechat/internal/util"
+)
+
+// 明文模式/URL认证 签名, 即 URL 中的 signature.
+func Sign(token, timestamp, nonce string) (signature string) {
+	return util.Sign(token, timestamp, nonce)
+}
+
+// 安全模式消息签名, 即 URL 中的 msg_signature.
+func MsgSign(token, timestamp, nonce, encryptedMsg string) (signature string) {
+	return util.MsgSign(token, timestamp, nonce, encryptedMsg)
+}
+
+// 校验 signature.
+func CheckSign(signature, token, timestamp, nonce string) bool {
+	return security.SecureCompareString(signature, Sign(token, timestamp, nonce))
+}
+
+// 校验 msg_signature.
+func CheckMsgSign(msgSignature, token, timestamp, nonce, encryptedMsg string) bool {
+	return security.SecureCompareString(msgSignature, MsgSign(token, timestamp, nonce, encryptedMsg))
+}